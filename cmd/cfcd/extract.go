@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/yuchunyu97/toolset-golang/internal/cfcd/archive"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// extract 解压目录中的所有 zip 包，分卷压缩包（name.zip.001、name.zip.002 ……）会自动合并后解压
+func extract(inputDir string, inputDirInfo os.FileInfo) {
+	needUnzipList, err := listArchives(inputDir)
+	if err != nil {
+		log.Printf("获取文件列表出错 %s", err)
+		return
+	}
+
+	// 加密的压缩包，准备每个压缩包的密码
+	var passwords *passwordProvider
+	if doEncrypt {
+		if passwords, err = newPasswordProvider(passwordFile, needUnzipList); err != nil {
+			log.Printf("%s", err)
+			return
+		}
+	}
+
+	// 在当前目录下创建结果输出文件夹，命名格式 cfcd_extract_20211217175612
+	pwd, _ := os.Getwd()
+	resultDirName := fmt.Sprintf("cfcd_extract_%s_%s",
+		inputDirInfo.Name(), time.Now().Format("20060102150405"))
+	resultDirPath := filepath.Join(pwd, resultDirName)
+	if err = os.Mkdir(resultDirPath, os.ModePerm); err != nil {
+		log.Printf("创建结果输出文件夹 %s 出错 %s", resultDirPath, err)
+		return
+	}
+
+	for _, info := range needUnzipList {
+		password := ""
+		if passwords != nil {
+			password = passwords.Password(info.Name)
+		}
+		dst := filepath.Join(resultDirPath, info.Name)
+
+		log.Printf("开始解压 %s", info.Path)
+		err = archive.Extract(info.Path, dst, password)
+		if errors.Is(err, archive.ErrEncrypted) {
+			log.Printf("解压 %s 失败：压缩包已加密，请使用 -e 参数提供密码", info.Path)
+		} else if err != nil {
+			log.Printf("解压 %s 失败：%s", info.Path, err)
+		} else {
+			log.Printf("解压成功 %s\n\n", dst)
+		}
+	}
+}
+
+// listArchives 获取目录下的所有压缩包，Name 为压缩包对应的文件夹名
+// 分卷压缩包只返回第一个分卷 name.zip.001
+func listArchives(dir string) ([]NeedZipInfo, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var archives []NeedZipInfo
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		name := file.Name()
+		switch {
+		case strings.HasSuffix(name, ".zip"):
+			name = strings.TrimSuffix(name, ".zip")
+		case strings.HasSuffix(name, ".zip.001"):
+			name = strings.TrimSuffix(name, ".zip.001")
+		default:
+			continue
+		}
+		archives = append(archives, NeedZipInfo{
+			Name: name,
+			Path: filepath.Join(dir, file.Name()),
+		})
+	}
+	return archives, nil
+}
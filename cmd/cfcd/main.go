@@ -6,13 +6,15 @@ package main
 // CGO_ENABLED=0 GOOS=windows GOARCH=amd64 go build -o cfcd-v0.0.2.exe main.go
 
 import (
-	"archive/zip"
 	"fmt"
-	"io"
+	"github.com/spf13/pflag"
+	"github.com/yuchunyu97/toolset-golang/internal/cfcd/archive"
+	"github.com/yuchunyu97/toolset-golang/pkg/utils/sizeutil"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,13 +29,92 @@ type NeedZipInfo struct {
 	Path string
 }
 
+var (
+	doEncrypt    bool
+	doExtract    bool
+	reproducible bool
+	doVerify     bool
+	checksumMode string
+	incremental  bool
+	stateFile    string
+	passwordFile string
+	volumeSize   string
+)
+
+func init() {
+	pflag.BoolVarP(&doEncrypt, "encrypt", "e", false,
+		"Encrypt the zip files with AES-256, password from --password-file, $"+PasswordEnv+" or prompt.")
+	pflag.StringVar(&passwordFile, "password-file", "",
+		"File of per-folder passwords, one `folder=password` per line. Implies --encrypt.")
+	pflag.StringVar(&volumeSize, "volume-size", "",
+		"Split each zip file into volumes (name.zip.001, name.zip.002, ...) of at most this size, e.g. 20M.")
+	pflag.BoolVarP(&reproducible, "reproducible", "r", false,
+		"Produce byte-identical zip files for the same folder, timestamps from $SOURCE_DATE_EPOCH or 1980-01-01. "+
+			"With --encrypt the AES salt is derived from the password and file contents instead of random, "+
+			"so the same file encrypted with the same password is identical across runs, which reveals unchanged files.")
+	pflag.BoolVarP(&incremental, "incremental", "I", false,
+		"Only compress folders changed since the last run, link or copy the unchanged zip files from the last result.")
+	pflag.StringVar(&stateFile, "state-file", "",
+		"State file of --incremental, default cfcd_state_<dir>.json in the current directory.")
+	pflag.StringVarP(&checksumMode, "checksum", "s", "",
+		"Write checksums of the zip files to the result folder, `sums` for one SHA256SUMS file, `file` for name.zip.sha256 files.")
+	pflag.BoolVarP(&doVerify, "verify", "c", false,
+		"Verify the zip files in the directory against the recorded checksums and their CRCs.")
+	pflag.BoolVarP(&doExtract, "extract", "x", false,
+		"Extract the zip files (including split volumes) in the directory instead of compressing.")
+
+	pflag.Parse()
+
+	if passwordFile != "" {
+		doEncrypt = true
+	}
+}
+
 func main() {
 	fmt.Printf("欢迎使用压缩小工具\nversion %s\nauthor %s\n\n", ToolVersion, ToolAuthor)
 
+	if checksumMode != "" && checksumMode != checksumSums && checksumMode != checksumFile {
+		log.Printf("校验和模式 %s 错误，可选 %s 或 %s", checksumMode, checksumSums, checksumFile)
+		waitForExit()
+		return
+	}
+
+	// 分卷大小
+	var maxVolumeSize int64
+	if volumeSize != "" {
+		var err error
+		if maxVolumeSize, err = sizeutil.Parse(volumeSize); err != nil {
+			log.Printf("分卷大小 %s 格式错误 %s", volumeSize, err)
+			waitForExit()
+			return
+		}
+	}
+
+	// 可重现模式下压缩包中文件的修改时间
+	modTime := archive.MinModTime
+	if reproducible {
+		if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+			sec, err := strconv.ParseInt(epoch, 10, 64)
+			if err != nil {
+				log.Printf("环境变量 SOURCE_DATE_EPOCH 格式错误 %s", err)
+				waitForExit()
+				return
+			}
+			modTime = time.Unix(sec, 0).UTC()
+		}
+	}
+
 	// 从控制台获取输入的需要被压缩的目录
 	// 目录中所有的文件夹会单独被压缩成 zip 包
+	// 解压时，目录中所有的 zip 包（包括分卷压缩包）会单独被解压
 	var inputZipDir string
-	fmt.Printf("请输入需要压缩的目录：")
+	if doVerify {
+		fmt.Printf("请输入需要校验的目录：")
+	} else if doExtract {
+		fmt.Printf("请输入需要解压的目录：")
+	} else {
+		fmt.Printf("请输入需要压缩的目录：")
+	}
 	if _, err := fmt.Scanln(&inputZipDir); err != nil {
 		log.Printf("输入错误 %s", err)
 		waitForExit()
@@ -60,6 +141,17 @@ func main() {
 	}
 	fmt.Println()
 
+	if doVerify {
+		verify(inputZipDir)
+		waitForExit()
+		return
+	}
+	if doExtract {
+		extract(inputZipDir, inputZipDirInfo)
+		waitForExit()
+		return
+	}
+
 	// 输入的值校验通过，获取当前目录下需要压缩的目录列表
 	var needZipList []NeedZipInfo
 	// 读取目录下文件
@@ -78,6 +170,16 @@ func main() {
 		}
 	}
 
+	// 加密压缩时，准备每个文件夹的密码
+	var passwords *passwordProvider
+	if doEncrypt {
+		if passwords, err = newPasswordProvider(passwordFile, needZipList); err != nil {
+			log.Printf("%s", err)
+			waitForExit()
+			return
+		}
+	}
+
 	// 当前程序执行目录
 	pwd, _ := os.Getwd()
 
@@ -91,94 +193,99 @@ func main() {
 		return
 	}
 
-	for _, needZipInfo := range needZipList {
-		compressDirPath := needZipInfo.Path
-		zipFileName := fmt.Sprintf("%s.zip", needZipInfo.Name)
-		zipFilePath := filepath.Join(resultDirPath, zipFileName)
-
-		log.Printf("开始压缩目录 %s", compressDirPath)
-		if err = Zip(zipFilePath, compressDirPath); err != nil {
-			log.Printf("压缩 %s 失败：%s", compressDirPath, err)
-		} else {
-			log.Printf("压缩成功 %s\n\n", zipFilePath)
+	// 增量压缩，读取上次压缩的状态
+	var state *zipState
+	if incremental {
+		if stateFile == "" {
+			stateFile = filepath.Join(pwd, fmt.Sprintf("cfcd_state_%s.json", inputZipDirInfo.Name()))
 		}
-	}
-
-	fmt.Printf("按任意键退出")
-	_, _ = fmt.Scanln()
-}
-
-func Zip(dst, src string) (err error) {
-	// https://learnku.com/articles/23434/golang-learning-notes-five-archivezip-to-achieve-compression-and-decompression
-	// https://stackoverflow.com/questions/49057032/recursively-zipping-a-directory-in-golang
-
-	// 创建准备写入的文件
-	fw, err := os.Create(dst)
-	defer func() { _ = fw.Close() }()
-	if err != nil {
-		return err
-	}
-
-	// 通过 fw 来创建 zip.Write
-	zw := zip.NewWriter(fw)
-	defer func() {
-		// 检测一下是否成功关闭
-		if err := zw.Close(); err != nil {
-			log.Println(err)
+		// 影响压缩结果的选项，选项或密码变化时所有文件夹都重新压缩
+		options := fmt.Sprintf("encrypt=%v volume=%d reproducible=%v mtime=%d",
+			doEncrypt, maxVolumeSize, reproducible, modTime.Unix())
+		if state, err = loadState(stateFile, options, passwords); err != nil {
+			log.Printf("读取状态文件 %s 出错 %s", stateFile, err)
 			waitForExit()
 			return
 		}
-	}()
+	}
 
-	// 下面来将文件写入 zw ，因为有可能会有很多个目录及文件，所以递归处理
-	return filepath.Walk(src, func(path string, fi os.FileInfo, errBack error) (err error) {
-		if errBack != nil {
-			return errBack
-		}
+	opts := archive.Options{
+		VolumeSize:   maxVolumeSize,
+		Reproducible: reproducible,
+		ModTime:      modTime,
+	}
+	resultFiles, folderStates := compressFolders(needZipList, resultDirPath, state, passwords, opts)
 
-		// 通过文件信息，创建 zip 的文件信息
-		fh, err := zip.FileInfoHeader(fi)
-		if err != nil {
-			return
+	// 保存增量压缩状态，只记录本次压缩成功的文件夹
+	if state != nil {
+		state.Folders = folderStates
+		if err = state.save(stateFile); err != nil {
+			log.Printf("保存状态文件 %s 失败：%s", stateFile, err)
 		}
+	}
 
-		// 替换文件信息中的文件名
-		fh.Name = strings.TrimPrefix(path, src)
-
-		// 这步开始没有加，会发现解压的时候说它不是个目录
-		if fi.IsDir() {
-			fh.Name += "/"
+	// 生成校验和文件
+	if checksumMode != "" {
+		if err = writeChecksums(resultDirPath, resultFiles); err != nil {
+			log.Printf("生成校验和文件失败：%s", err)
+		} else {
+			log.Printf("生成校验和文件成功\n\n")
 		}
+	}
 
-		// 写入文件信息，并返回一个 Write 结构
-		w, err := zw.CreateHeader(fh)
-		if err != nil {
-			return
-		}
+	fmt.Printf("按任意键退出")
+	_, _ = fmt.Scanln()
+}
 
-		// 检测，如果不是标准文件就只写入头信息，不写入文件数据到 w
-		// 如目录，也没有数据需要写
-		if !fh.Mode().IsRegular() {
-			return nil
+// compressFolders 将每个文件夹压缩到结果文件夹中，返回生成的压缩包和压缩成功的文件夹的状态
+// state 不为空时为增量压缩，内容没有变化的文件夹复用上次生成的压缩包；无法计算校验和时重新压缩，不记录状态
+func compressFolders(needZipList []NeedZipInfo, resultDirPath string, state *zipState, passwords *passwordProvider,
+	opts archive.Options) ([]string, map[string]zipFolderState) {
+	var resultFiles []string
+	folderStates := map[string]zipFolderState{}
+	for _, needZipInfo := range needZipList {
+		compressDirPath := needZipInfo.Path
+		zipFileName := fmt.Sprintf("%s.zip", needZipInfo.Name)
+		zipFilePath := filepath.Join(resultDirPath, zipFileName)
+
+		// 内容没有变化的文件夹，复用上次生成的压缩包
+		var folderHash string
+		if state != nil {
+			var err error
+			if folderHash, err = archive.HashDir(compressDirPath); err != nil {
+				log.Printf("计算目录 %s 校验和失败，重新压缩：%s", compressDirPath, err)
+			} else if prev, ok := state.unchanged(needZipInfo.Name, folderHash); ok {
+				files, err := reuseArchives(prev.Files, resultDirPath)
+				if err == nil {
+					log.Printf("目录 %s 没有变化，复用压缩包 %s\n\n", compressDirPath, strings.Join(files, ", "))
+					resultFiles = append(resultFiles, files...)
+					folderStates[needZipInfo.Name] = zipFolderState{Hash: folderHash, Files: files}
+					continue
+				}
+				log.Printf("复用压缩包失败，重新压缩：%s", err)
+				for _, file := range files {
+					_ = os.Remove(file)
+				}
+			}
 		}
 
-		// 打开要压缩的文件
-		fr, err := os.Open(path)
-		defer func() { _ = fr.Close() }()
-		if err != nil {
-			return
+		if passwords != nil {
+			opts.Password = passwords.Password(needZipInfo.Name)
 		}
 
-		// 将打开的文件 Copy 到 w
-		_, err = io.Copy(w, fr)
+		log.Printf("开始压缩目录 %s", compressDirPath)
+		files, err := archive.Zip(zipFilePath, compressDirPath, opts)
 		if err != nil {
-			return
+			log.Printf("压缩 %s 失败：%s", compressDirPath, err)
+		} else {
+			log.Printf("压缩成功 %s\n\n", strings.Join(files, ", "))
+			resultFiles = append(resultFiles, files...)
+			if state != nil && folderHash != "" {
+				folderStates[needZipInfo.Name] = zipFolderState{Hash: folderHash, Files: files}
+			}
 		}
-		// 输出压缩的内容
-		log.Printf("成功压缩文件： %s\n", fh.Name)
-
-		return nil
-	})
+	}
+	return resultFiles, folderStates
 }
 
 func waitForExit() {
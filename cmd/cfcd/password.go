@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PasswordEnv 压缩包密码环境变量
+const PasswordEnv = "CFCD_PASSWORD"
+
+// passwordProvider 按文件夹获取压缩包密码
+// 优先使用密码文件中文件夹对应的密码，其次为环境变量 CFCD_PASSWORD，最后从控制台输入
+type passwordProvider struct {
+	folderPasswords map[string]string
+	defaultPassword string
+}
+
+// loadPasswordFile 读取密码文件
+// 每行格式为 文件夹名=密码，以 # 开头的行为注释
+func loadPasswordFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	passwords := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("第 %d 行格式错误，格式为 文件夹名=密码", lineNum)
+		}
+		name := strings.TrimSpace(line[:idx])
+		password := line[idx+1:]
+		if password == "" {
+			return nil, fmt.Errorf("第 %d 行文件夹 %s 的密码为空", lineNum, name)
+		}
+		passwords[name] = password
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+// newPasswordProvider 初始化密码来源
+// needZipList 中没有在密码文件中配置密码的文件夹，需要使用环境变量或控制台输入的密码
+func newPasswordProvider(passwordFile string, needZipList []NeedZipInfo) (*passwordProvider, error) {
+	p := &passwordProvider{folderPasswords: map[string]string{}}
+	if passwordFile != "" {
+		passwords, err := loadPasswordFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取密码文件 %s 出错 %s", passwordFile, err)
+		}
+		p.folderPasswords = passwords
+	}
+
+	needDefault := false
+	for _, info := range needZipList {
+		if _, ok := p.folderPasswords[info.Name]; !ok {
+			needDefault = true
+			break
+		}
+	}
+	if !needDefault {
+		return p, nil
+	}
+
+	p.defaultPassword = os.Getenv(PasswordEnv)
+	if p.defaultPassword != "" {
+		return p, nil
+	}
+	fmt.Printf("请输入压缩包密码：")
+	if _, err := fmt.Scanln(&p.defaultPassword); err != nil {
+		return nil, fmt.Errorf("输入错误 %s", err)
+	}
+	if p.defaultPassword == "" {
+		return nil, fmt.Errorf("压缩包密码不能为空")
+	}
+	return p, nil
+}
+
+// Password 获取文件夹对应的压缩包密码
+func (p *passwordProvider) Password(folderName string) string {
+	if password, ok := p.folderPasswords[folderName]; ok {
+		return password
+	}
+	return p.defaultPassword
+}
+
+// Fingerprint 所有密码的指纹，用于判断密码是否变化
+// 使用 salt 和 PBKDF2 计算，不能通过指纹还原或快速猜测密码
+func (p *passwordProvider) Fingerprint(salt string) string {
+	names := make([]string, 0, len(p.folderPasswords))
+	for name := range p.folderPasswords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%q=%q\n", name, p.folderPasswords[name])
+	}
+	fmt.Fprintf(&b, "*=%q\n", p.defaultPassword)
+	return hex.EncodeToString(pbkdf2.Key([]byte(b.String()), []byte(salt), 10000, 16, sha256.New))
+}
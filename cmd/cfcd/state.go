@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// zipState 增量压缩状态文件，记录每个文件夹上次压缩时的内容校验和及生成的压缩包
+type zipState struct {
+	Options string                    `json:"options"`        // 影响压缩结果的选项，选项变化时所有文件夹都需要重新压缩
+	Salt    string                    `json:"salt,omitempty"` // 计算密码指纹的 salt，状态文件中不保存密码
+	Folders map[string]zipFolderState `json:"folders"`
+}
+
+type zipFolderState struct {
+	Hash  string   `json:"hash"`
+	Files []string `json:"files"` // 压缩包的绝对路径（分卷时为所有分卷）
+}
+
+// loadState 读取状态文件，文件不存在时返回空的状态
+// 状态文件损坏（如上次保存时程序被中断）时忽略，所有文件夹都重新压缩，压缩完成后覆盖
+// 加密压缩时密码的指纹也作为选项，修改密码后所有文件夹都重新压缩
+func loadState(path, options string, passwords *passwordProvider) (*zipState, error) {
+	state := &zipState{Folders: map[string]zipFolderState{}}
+	var prev zipState
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &prev); err != nil {
+			log.Printf("状态文件 %s 格式错误，所有文件夹都重新压缩：%s", path, err)
+			prev = zipState{}
+		}
+	}
+
+	if passwords != nil {
+		state.Salt = prev.Salt
+		if state.Salt == "" {
+			salt := make([]byte, 16)
+			if _, err = rand.Read(salt); err != nil {
+				return nil, err
+			}
+			state.Salt = hex.EncodeToString(salt)
+		}
+		options += " password=" + passwords.Fingerprint(state.Salt)
+	}
+	state.Options = options
+
+	// 选项变化，之前的压缩结果都不能复用
+	if prev.Options == options && prev.Folders != nil {
+		state.Folders = prev.Folders
+	}
+	return state, nil
+}
+
+// save 保存状态文件
+func (s *zipState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// unchanged 判断文件夹内容是否与上次压缩时相同，且上次生成的压缩包都还存在
+func (s *zipState) unchanged(name, hash string) (zipFolderState, bool) {
+	prev, ok := s.Folders[name]
+	if !ok || prev.Hash != hash || len(prev.Files) == 0 {
+		return prev, false
+	}
+	for _, file := range prev.Files {
+		if _, err := os.Stat(file); err != nil {
+			return prev, false
+		}
+	}
+	return prev, true
+}
+
+// reuseArchives 将上次生成的压缩包硬链接到结果文件夹，不支持硬链接时复制文件
+func reuseArchives(files []string, resultDirPath string) ([]string, error) {
+	var reused []string
+	for _, file := range files {
+		dst := filepath.Join(resultDirPath, filepath.Base(file))
+		if err := os.Link(file, dst); err != nil {
+			if err = copyFile(file, dst); err != nil {
+				return reused, err
+			}
+		}
+		reused = append(reused, dst)
+	}
+	return reused, nil
+}
+
+func copyFile(src, dst string) (err error) {
+	fr, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fr.Close() }()
+
+	fw, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := fw.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	_, err = io.Copy(fw, fr)
+	return err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yuchunyu97/toolset-golang/internal/cfcd/archive"
+)
+
+// incrementalRun 模拟一次增量压缩：读取状态文件，压缩 srcDir 中的文件夹到新的结果文件夹，保存状态文件
+// 返回文件夹名 -> 生成的压缩包
+func incrementalRun(t *testing.T, srcDir, stateFile string, passwords *passwordProvider) map[string][]string {
+	t.Helper()
+	var needZipList []NeedZipInfo
+	for _, name := range []string{"a", "b"} {
+		needZipList = append(needZipList, NeedZipInfo{Name: name, Path: filepath.Join(srcDir, name)})
+	}
+	state, err := loadState(stateFile, "encrypt=false", passwords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, folderStates := compressFolders(needZipList, t.TempDir(), state, passwords, archive.Options{Reproducible: true})
+	state.Folders = folderStates
+	if err = state.save(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string][]string)
+	for name, folder := range folderStates {
+		result[name] = folder.Files
+	}
+	return result
+}
+
+// reused 判断压缩包是否为上次生成的压缩包的硬链接
+func reused(t *testing.T, prev, cur []string) bool {
+	t.Helper()
+	if len(prev) == 0 || len(prev) != len(cur) {
+		t.Fatalf("archives %v, then %v", prev, cur)
+	}
+	for i := range prev {
+		prevInfo, err := os.Stat(prev[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		curInfo, err := os.Stat(cur[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(prevInfo, curInfo) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIncremental(t *testing.T) {
+	tests := []struct {
+		name string
+		// change 在第二次压缩前修改文件夹或状态文件，返回第二次压缩使用的密码
+		change  func(t *testing.T, srcDir, stateFile string) *passwordProvider
+		reuseA  bool
+		reuseB  bool
+		encrypt bool
+	}{
+		{"unchanged", func(*testing.T, string, string) *passwordProvider { return nil }, true, true, false},
+		{"file changed", func(t *testing.T, srcDir, _ string) *passwordProvider {
+			if err := os.WriteFile(filepath.Join(srcDir, "a", "data.txt"), []byte("changed"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			return nil
+		}, false, true, false},
+		{"mtime changed", func(t *testing.T, srcDir, _ string) *passwordProvider {
+			mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			if err := os.Chtimes(filepath.Join(srcDir, "a", "data.txt"), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+			return nil
+		}, true, true, false},
+		{"same password", func(*testing.T, string, string) *passwordProvider {
+			return &passwordProvider{defaultPassword: "secret"}
+		}, true, true, true},
+		{"password changed", func(*testing.T, string, string) *passwordProvider {
+			return &passwordProvider{defaultPassword: "secret2"}
+		}, false, false, true},
+		{"folder password changed", func(*testing.T, string, string) *passwordProvider {
+			return &passwordProvider{defaultPassword: "secret", folderPasswords: map[string]string{"b": "other"}}
+		}, false, false, true},
+		{"corrupt state file", func(t *testing.T, _, stateFile string) *passwordProvider {
+			if err := os.WriteFile(stateFile, []byte(`{"options": "encrypt=false", "folders": {`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			return nil
+		}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			for _, name := range []string{"a", "b"} {
+				if err := os.MkdirAll(filepath.Join(srcDir, name), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(srcDir, name, "data.txt"), []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			stateFile := filepath.Join(t.TempDir(), "state.json")
+
+			var passwords *passwordProvider
+			if tt.encrypt {
+				passwords = &passwordProvider{defaultPassword: "secret"}
+			}
+			first := incrementalRun(t, srcDir, stateFile, passwords)
+			passwords = tt.change(t, srcDir, stateFile)
+			second := incrementalRun(t, srcDir, stateFile, passwords)
+			if got := reused(t, first["a"], second["a"]); got != tt.reuseA {
+				t.Errorf("a reused = %v, want %v", got, tt.reuseA)
+			}
+			if got := reused(t, first["b"], second["b"]); got != tt.reuseB {
+				t.Errorf("b reused = %v, want %v", got, tt.reuseB)
+			}
+
+			// 状态文件已经更新，再次压缩时都复用
+			third := incrementalRun(t, srcDir, stateFile, passwords)
+			for _, name := range []string{"a", "b"} {
+				if !reused(t, second[name], third[name]) {
+					t.Errorf("%s not reused on the third run", name)
+				}
+			}
+		})
+	}
+}
+
+// TestIncrementalMissingFolder 无法计算校验和的文件夹不记录状态，不影响其他文件夹
+func TestIncrementalMissingFolder(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "a", "data.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result := incrementalRun(t, srcDir, filepath.Join(t.TempDir(), "state.json"), nil)
+	if len(result["a"]) != 1 {
+		t.Errorf("a archives = %v", result["a"])
+	}
+	if _, ok := result["b"]; ok {
+		t.Errorf("missing folder b recorded in the state: %v", result["b"])
+	}
+}
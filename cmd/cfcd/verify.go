@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"github.com/yuchunyu97/toolset-golang/internal/cfcd/archive"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	checksumSums = "sums" // 在结果文件夹中生成汇总的 SHA256SUMS 文件
+	checksumFile = "file" // 为每个压缩包生成单独的 .sha256 文件
+)
+
+// writeChecksums 在结果文件夹中生成校验和文件，files 为生成的所有压缩包文件（包括分卷）
+func writeChecksums(resultDirPath string, files []string) error {
+	sums := make(map[string]string)
+	for _, file := range files {
+		sum, err := archive.SumFile(file)
+		if err != nil {
+			return err
+		}
+		sums[filepath.Base(file)] = sum
+	}
+
+	switch checksumMode {
+	case checksumSums:
+		return archive.WriteChecksums(filepath.Join(resultDirPath, archive.SumsFileName), sums)
+	case checksumFile:
+		for name, sum := range sums {
+			path := filepath.Join(resultDirPath, name+archive.SumFileExt)
+			if err := archive.WriteChecksums(path, map[string]string{name: sum}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verify 校验目录中的压缩包，返回错误的数量
+// 先根据 SHA256SUMS 或 .sha256 文件校验每个文件的校验和，再读取每个压缩包校验其中文件的 CRC32
+// 有校验和文件时，不在校验和文件中的压缩包或分卷（如多出的分卷）也是错误
+func verify(inputDir string) int {
+	failedCount := 0
+
+	sums, err := archive.FindChecksums(inputDir)
+	if err != nil {
+		log.Printf("读取校验和文件出错 %s", err)
+		return 1
+	}
+	if len(sums) == 0 {
+		log.Printf("目录 %s 中没有校验和文件，只校验压缩包内容", inputDir)
+	}
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = archive.VerifyChecksum(filepath.Join(inputDir, name), sums[name]); err != nil {
+			log.Printf("校验和错误 %s：%s", name, err)
+			failedCount++
+		} else {
+			log.Printf("校验和正确 %s", name)
+		}
+	}
+	fmt.Println()
+
+	archives, err := listArchives(inputDir)
+	if err != nil {
+		log.Printf("获取文件列表出错 %s", err)
+		return failedCount + 1
+	}
+
+	if len(sums) > 0 {
+		for _, info := range archives {
+			volumes, err := archive.Volumes(info.Path)
+			if err != nil {
+				log.Printf("获取分卷出错 %s：%s", info.Path, err)
+				failedCount++
+				continue
+			}
+			for _, volume := range volumes {
+				if _, ok := sums[filepath.Base(volume)]; !ok {
+					log.Printf("文件 %s 不在校验和文件中", volume)
+					failedCount++
+				}
+			}
+		}
+	}
+
+	var passwords *passwordProvider
+	if doEncrypt {
+		if passwords, err = newPasswordProvider(passwordFile, archives); err != nil {
+			log.Printf("%s", err)
+			return failedCount + 1
+		}
+	}
+
+	for _, info := range archives {
+		password := ""
+		if passwords != nil {
+			password = passwords.Password(info.Name)
+		}
+		skipped, err := archive.VerifyArchive(info.Path, password)
+		switch {
+		case err != nil:
+			log.Printf("压缩包损坏 %s：%s", info.Path, err)
+			failedCount++
+		case skipped > 0:
+			log.Printf("压缩包校验完成 %s，%d 个加密文件未校验，请使用 -e 参数提供密码", info.Path, skipped)
+		default:
+			log.Printf("压缩包校验完成 %s", info.Path)
+		}
+	}
+
+	log.Printf("\n\n校验完成，%d 个错误\n\n", failedCount)
+	return failedCount
+}
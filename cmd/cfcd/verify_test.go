@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/yuchunyu97/toolset-golang/internal/cfcd/archive"
+)
+
+// setChecksumMode 设置校验和模式，测试结束后恢复
+func setChecksumMode(t *testing.T, mode string) {
+	old := checksumMode
+	checksumMode = mode
+	t.Cleanup(func() { checksumMode = old })
+}
+
+// zipFolder 在 dir 中创建文件夹 name 并压缩到 resultDir，返回生成的压缩包
+func zipFolder(t *testing.T, dir, resultDir, name string, opts archive.Options) []string {
+	t.Helper()
+	src := filepath.Join(dir, name)
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 20000)
+	rand.New(rand.NewSource(int64(len(name)))).Read(data)
+	if err := os.WriteFile(filepath.Join(src, "data.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := archive.Zip(filepath.Join(resultDir, name+".zip"), src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestWriteChecksumsModes(t *testing.T) {
+	tests := []struct {
+		mode  string
+		files []string // 生成的校验和文件
+	}{
+		{checksumSums, []string{archive.SumsFileName}},
+		{checksumFile, []string{"a.zip.sha256", "b.zip.001.sha256", "b.zip.002.sha256"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			setChecksumMode(t, tt.mode)
+			dir, resultDir := t.TempDir(), t.TempDir()
+			files := zipFolder(t, dir, resultDir, "a", archive.Options{})
+			files = append(files, zipFolder(t, dir, resultDir, "b", archive.Options{VolumeSize: 15000})...)
+			if err := writeChecksums(resultDir, files); err != nil {
+				t.Fatal(err)
+			}
+
+			sumFiles, _ := filepath.Glob(filepath.Join(resultDir, "*.sha256"))
+			if _, err := os.Stat(filepath.Join(resultDir, archive.SumsFileName)); err == nil {
+				sumFiles = append(sumFiles, filepath.Join(resultDir, archive.SumsFileName))
+			}
+			var names []string
+			for _, file := range sumFiles {
+				names = append(names, filepath.Base(file))
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.files) {
+				t.Errorf("checksum files = %v, want %v", names, tt.files)
+			}
+
+			sums, err := archive.FindChecksums(resultDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sums) != len(files) {
+				t.Errorf("%d checksums for %d files", len(sums), len(files))
+			}
+			for _, file := range files {
+				sum, _ := archive.SumFile(file)
+				if sums[filepath.Base(file)] != sum {
+					t.Errorf("%s: checksum %s, want %s", file, sums[filepath.Base(file)], sum)
+				}
+			}
+		})
+	}
+}
+
+// TestVerify 校验发现修改、缺少和多出的分卷
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, resultDir string)
+		failed bool
+	}{
+		{"intact", func(*testing.T, string) {}, false},
+		{"changed volume", func(t *testing.T, resultDir string) {
+			path := filepath.Join(resultDir, "b.zip.002")
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data[100] ^= 0xff
+			if err = os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"missing volume", func(t *testing.T, resultDir string) {
+			if err := os.Remove(filepath.Join(resultDir, "b.zip.002")); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"extra volume", func(t *testing.T, resultDir string) {
+			if err := os.WriteFile(filepath.Join(resultDir, "b.zip.003"), bytes.Repeat([]byte{0}, 100), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"extra archive", func(t *testing.T, resultDir string) {
+			zipFolder(t, t.TempDir(), resultDir, "c", archive.Options{})
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setChecksumMode(t, checksumSums)
+			dir, resultDir := t.TempDir(), t.TempDir()
+			files := zipFolder(t, dir, resultDir, "a", archive.Options{})
+			files = append(files, zipFolder(t, dir, resultDir, "b", archive.Options{VolumeSize: 15000})...)
+			if len(files) != 3 {
+				t.Fatalf("zip files = %v, want a.zip and 2 volumes of b.zip", files)
+			}
+			if err := writeChecksums(resultDir, files); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.modify(t, resultDir)
+			if failed := verify(resultDir); (failed > 0) != tt.failed {
+				t.Errorf("verify = %d errors, want failure %v", failed, tt.failed)
+			}
+		})
+	}
+}
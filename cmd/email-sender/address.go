@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/yuchunyu97/toolset-golang/pkg/utils/sliceutil"
+	"net/mail"
+	"sort"
+	"strings"
+)
+
+// splitAddressList 按英文逗号、英文分号和中文分号分隔邮箱，引号和尖括号中的分隔符不分隔
+func splitAddressList(cell string) []string {
+	var parts []string
+	var b strings.Builder
+	quoted, angle := false, false
+	for _, r := range cell {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '<' && !quoted:
+			angle = true
+		case r == '>' && !quoted:
+			angle = false
+		case (r == ',' || r == ';' || r == '；') && !quoted && !angle:
+			parts = append(parts, b.String())
+			b.Reset()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	parts = append(parts, b.String())
+
+	return sliceutil.RemoveString(parts, func(item string) bool {
+		return strings.TrimSpace(item) == ""
+	})
+}
+
+// parseAddressList 解析一个单元格中的邮箱，支持显示名称，如 张三 <zhangsan@example.com>
+// exclude 中已有的邮箱会被去掉，返回的邮箱不重复，有格式错误的邮箱时返回所有格式错误的邮箱
+func parseAddressList(cell string, exclude ...string) ([]string, error) {
+	seen := make(map[string]struct{})
+	for _, v := range exclude {
+		if addr, err := mail.ParseAddress(v); err == nil {
+			seen[addressKey(addr.Address)] = struct{}{}
+		}
+	}
+
+	var result, invalid []string
+	for _, part := range splitAddressList(cell) {
+		part = strings.TrimSpace(part)
+		addr, err := mail.ParseAddress(part)
+		if err != nil {
+			invalid = append(invalid, part)
+			continue
+		}
+		key := addressKey(addr.Address)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		result = append(result, formatAddress(addr))
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("邮箱格式错误 %s", strings.Join(invalid, "、"))
+	}
+	return result, nil
+}
+
+// formatAddress 格式化邮箱，用于邮件头，非 ASCII 的显示名称按 RFC 2047 编码，邮箱不编码
+// 邮件库对 Reply-To 等邮件头整体编码，显示名称不能以原文写入；
+// 邮件库按英文逗号分隔 To、Cc 中的邮箱，显示名称中有逗号时（如 "Zhang, San"）也需要编码
+func formatAddress(addr *mail.Address) string {
+	if addr.Name == "" {
+		return addr.Address
+	}
+	formatted := addr.String()
+	if strings.Contains(formatted, ",") {
+		name := "=?utf-8?b?" + base64.StdEncoding.EncodeToString([]byte(addr.Name)) + "?="
+		formatted = name + " <" + addr.Address + ">"
+	}
+	return formatted
+}
+
+// displayAddress 邮箱的显示格式，解码显示名称，用于待发送邮件列表和日志
+func displayAddress(v string) string {
+	addr, err := mail.ParseAddress(v)
+	if err != nil {
+		return v
+	}
+	if addr.Name == "" {
+		return addr.Address
+	}
+	return fmt.Sprintf("%s <%s>", addr.Name, addr.Address)
+}
+
+// displayAddressList 多个邮箱的显示格式
+func displayAddressList(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	result := make([]string, len(list))
+	for i, v := range list {
+		result[i] = displayAddress(v)
+	}
+	return result
+}
+
+// addressKey 邮箱去重使用的 key，忽略大小写
+func addressKey(address string) string {
+	return strings.ToLower(address)
+}
+
+// duplicateRecipients 查找出现在多行中的收件人（包括抄送），返回 邮箱 -> 行号
+func duplicateRecipients(tasks []*emailTask) map[string][]int {
+	rowsByAddress := make(map[string][]int)
+	for _, task := range tasks {
+		var keys []string
+		for _, v := range append(append([]string(nil), task.Email.To...), task.Email.Cc...) {
+			if addr, err := mail.ParseAddress(v); err == nil {
+				keys = append(keys, addressKey(addr.Address))
+			}
+		}
+		for _, key := range sliceutil.RemoveDuplicate(keys) {
+			rowsByAddress[key] = append(rowsByAddress[key], task.Row.Num)
+		}
+	}
+	for key, rows := range rowsByAddress {
+		if len(rows) < 2 {
+			delete(rowsByAddress, key)
+		}
+	}
+	return rowsByAddress
+}
+
+// printDuplicateRecipients 打印出现在多行中的收件人，这些行仍然会发送，请确认是否重复
+func printDuplicateRecipients(duplicates map[string][]int) {
+	if len(duplicates) == 0 {
+		return
+	}
+	addresses := make([]string, 0, len(duplicates))
+	for address := range duplicates {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	fmt.Fprintf(out, "以下 %d 个收件人出现在多行中，请确认是否重复发送：\n\n", len(duplicates))
+	for _, address := range addresses {
+		rows := make([]string, 0, len(duplicates[address]))
+		for _, num := range duplicates[address] {
+			rows = append(rows, fmt.Sprintf("第 %d 行", num))
+		}
+		fmt.Fprintf(out, "%s：%s\n", address, strings.Join(rows, "、"))
+	}
+	fmt.Fprintln(out)
+}
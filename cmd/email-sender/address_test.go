@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAddressList(t *testing.T) {
+	tests := []struct {
+		cell    string
+		exclude []string
+		want    []string // 解码后的显示格式
+	}{
+		{"zhangsan@example.com", nil, []string{"zhangsan@example.com"}},
+		{"张三 <zhangsan@example.com>; lisi@example.com；王五 <wangwu@example.com>", nil,
+			[]string{"张三 <zhangsan@example.com>", "lisi@example.com", "王五 <wangwu@example.com>"}},
+		{`"Zhang, San" <zhangsan@example.com>, "Li; Si" <lisi@example.com>`, nil,
+			[]string{"Zhang, San <zhangsan@example.com>", "Li; Si <lisi@example.com>"}},
+		{`"张, 三" <zhangsan@example.com>`, nil, []string{"张, 三 <zhangsan@example.com>"}},
+		{"ZhangSan@Example.com, zhangsan@example.com, lisi@example.com", []string{"李四 <LiSi@example.com>"},
+			[]string{"ZhangSan@Example.com"}},
+	}
+	for _, tt := range tests {
+		list, err := parseAddressList(tt.cell, tt.exclude...)
+		if err != nil {
+			t.Errorf("parseAddressList(%q) error: %s", tt.cell, err)
+			continue
+		}
+		// 邮件库按英文逗号分隔邮箱，格式化后的邮箱中不能有逗号
+		for _, v := range list {
+			if strings.Contains(v, ",") {
+				t.Errorf("parseAddressList(%q): %q contains a comma", tt.cell, v)
+			}
+		}
+		if got := displayAddressList(list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAddressList(%q) = %q, want %q", tt.cell, got, tt.want)
+		}
+	}
+
+	if _, err := parseAddressList("zhangsan@example.com, 李四, wangwu@"); err == nil {
+		t.Error("invalid addresses accepted")
+	}
+}
+
+// TestDisplayNameComma 显示名称中有逗号时，收件人和抄送的邮件头及 SMTP 收件人都正确
+func TestDisplayNameComma(t *testing.T) {
+	titles := []string{"收件人", "抄送", "主题", "正文", "附件", "姓名"}
+	e := newTestEnv(t, titles, []string{`"Zhang, San" <zhangsan@example.com>`, `"Li, Si" <lisi@example.com>, wangwu@example.com`, "工资条", "", "", "张三"})
+	if code := run(); code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	messages := e.sink.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d messages, want 1", len(messages))
+	}
+	want := []string{"zhangsan@example.com", "lisi@example.com", "wangwu@example.com"}
+	if !reflect.DeepEqual(messages[0].To, want) {
+		t.Errorf("RCPT TO = %v, want %v", messages[0].To, want)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(messages[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for header, want := range map[string][]string{
+		"To": {"Zhang, San <zhangsan@example.com>"},
+		"Cc": {"Li, Si <lisi@example.com>", "wangwu@example.com"},
+	} {
+		list, err := msg.Header.AddressList(header)
+		if err != nil {
+			t.Errorf("%s: %q: %s", header, msg.Header.Get(header), err)
+			continue
+		}
+		var got []string
+		for _, addr := range list {
+			got = append(got, displayAddress(addr.String()))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
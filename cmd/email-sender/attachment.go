@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jordan-wright/email"
+	"github.com/yuchunyu97/toolset-golang/internal/cfcd/archive"
+	"github.com/yuchunyu97/toolset-golang/pkg/utils/sizeutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// attachment 一个附件文件
+type attachment struct {
+	Name string // 压缩时在压缩包中的文件名，文件夹中的文件保留相对路径
+	Path string
+	Size int64
+}
+
+// resolveAttachments 解析附件列，返回所有附件文件
+// 附件列先使用模板变量渲染，再按英文逗号分隔，每一项可以是文件名、文件夹或通配符（语法见 filepath.Match）
+// 文件夹会添加其中（包括子文件夹中）的所有文件
+// 相对路径先在 email-sender-attachments 文件夹中查找，找不到时再在当前目录下查找，
+// 例如 excel-split 拆分的结果可以使用 result_*/{{.姓名}}.xlsx 匹配
+// 有附件不存在时返回所有不存在的附件，而不只是第一个
+func resolveAttachments(cell string, vars map[string]string) ([]attachment, error) {
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return nil, nil
+	}
+	rendered, err := renderText("attachments", cell, vars)
+	if err != nil {
+		return nil, fmt.Errorf("邮件附件模板错误 %s", err)
+	}
+
+	var files []attachment
+	var missing []string
+	for _, item := range strings.Split(rendered, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		matches, err := matchAttachment(item)
+		if err != nil {
+			return nil, fmt.Errorf("邮件附件 %s 格式错误 %s", item, err)
+		}
+		if len(matches) == 0 {
+			missing = append(missing, item)
+			continue
+		}
+		files = append(files, matches...)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("邮件附件不存在：%s（在 %s 文件夹和当前目录下查找）", strings.Join(missing, "、"), AttachmentPath)
+	}
+	return files, nil
+}
+
+// matchAttachment 查找附件文件，依次在 email-sender-attachments 文件夹和当前目录下查找
+// 空文件夹视为不存在
+func matchAttachment(pattern string) ([]attachment, error) {
+	candidates := []string{pattern}
+	if !filepath.IsAbs(pattern) {
+		candidates = []string{filepath.Join(AttachmentPath, pattern), pattern}
+	}
+
+	for _, candidate := range candidates {
+		// 文件名中可能包含 [ 等通配符字符，优先按文件名查找
+		matches := []string{candidate}
+		if _, err := os.Stat(candidate); err != nil {
+			if matches, err = filepath.Glob(candidate); err != nil {
+				return nil, err
+			}
+			sort.Strings(matches)
+		}
+		var files []attachment
+		for _, match := range matches {
+			found, err := attachmentFiles(match)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, found...)
+		}
+		if len(files) > 0 {
+			return files, nil
+		}
+	}
+	return nil, nil
+}
+
+// attachmentFiles path 为文件时返回该文件，为文件夹时返回其中的所有文件，压缩包中的文件名以文件夹名开头
+func attachmentFiles(path string) ([]attachment, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil
+	}
+	if fi.Mode().IsRegular() {
+		return []attachment{{Name: filepath.Base(path), Path: path, Size: fi.Size()}}, nil
+	}
+	if !fi.IsDir() {
+		return nil, nil
+	}
+	var files []attachment
+	parent := filepath.Dir(filepath.Clean(path))
+	// filepath.Walk 按文件名顺序遍历
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(parent, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, attachment{Name: filepath.ToSlash(rel), Path: p, Size: info.Size()})
+		return nil
+	})
+	return files, err
+}
+
+// attachFiles 添加附件，配置了压缩且附件总大小超过 zipOver 时压缩成一个 zip 包再添加
+// 最后检查包括内嵌图片在内的附件总大小是否超过限制
+func attachFiles(em *email.Email, files []attachment, cfg *Config, vars map[string]string) error {
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+
+	if cfg.ZipAttachments && len(files) > 0 && total > cfg.ZipOver {
+		if err := attachZip(em, files, cfg.ZipName, vars); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range files {
+			if _, err := em.AttachFile(f.Path); err != nil {
+				return fmt.Errorf("添加邮件附件 %s 失败 %s", f.Path, err)
+			}
+		}
+	}
+
+	if cfg.AttachmentMaxSize > 0 {
+		if size := attachmentsSize(em); size > cfg.AttachmentMaxSize {
+			return fmt.Errorf("附件总大小 %s 超过限制 %s", sizeutil.Format(size), sizeutil.Format(cfg.AttachmentMaxSize))
+		}
+	}
+	return nil
+}
+
+// attachZip 将附件压缩成一个 zip 包添加到邮件中，压缩包名称可以使用模板变量
+func attachZip(em *email.Email, files []attachment, zipName string, vars map[string]string) error {
+	name, err := renderText("zipName", zipName, vars)
+	if err != nil {
+		return fmt.Errorf("附件压缩包名称模板错误 %s", err)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("附件压缩包名称 %q 错误", name)
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+
+	// 压缩包中的文件名不能重复
+	seen := make(map[string]bool, len(files))
+	zipFiles := make([]archive.File, 0, len(files))
+	for _, f := range files {
+		if seen[f.Name] {
+			return fmt.Errorf("附件 %s 重复，无法压缩", f.Name)
+		}
+		seen[f.Name] = true
+		zipFiles = append(zipFiles, archive.File{Name: f.Name, Path: f.Path})
+	}
+
+	dir, err := os.MkdirTemp("", "email-sender-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	dst := filepath.Join(dir, name)
+	if _, err = archive.ZipFiles(dst, zipFiles, archive.Options{}); err != nil {
+		return fmt.Errorf("压缩附件失败 %s", err)
+	}
+	// AttachFile 会读取文件的全部内容，之后可以删除临时文件
+	if _, err = em.AttachFile(dst); err != nil {
+		return fmt.Errorf("添加邮件附件 %s 失败 %s", name, err)
+	}
+	return nil
+}
+
+// attachmentsSize 附件总大小（编码前），包括内嵌图片
+func attachmentsSize(em *email.Email) int64 {
+	var size int64
+	for _, a := range em.Attachments {
+		size += int64(len(a.Content))
+	}
+	return size
+}
+
+// parseSizeConfig 解析大小配置，为空或 0 时返回 0
+func parseSizeConfig(key, value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	size, err := sizeutil.Parse(value)
+	if err != nil {
+		return 0, fmt.Errorf("配置 %s 格式错误 %s，格式如 20M、512K", key, err)
+	}
+	return size, nil
+}
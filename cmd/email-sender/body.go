@@ -0,0 +1,201 @@
+package main
+
+// 邮件正文处理
+// 根据 HTML 正文自动生成纯文本正文（multipart/alternative），部分邮件网关会将只有 HTML 正文的邮件判定为垃圾邮件
+// HTML 正文中引用的本地图片作为内嵌附件（Content-ID）发送，收件人不需要访问外部地址即可显示
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/jordan-wright/email"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// embedImages 将 HTML 正文中引用本地文件的 <img src> 替换为 cid: 引用，并将图片作为内嵌附件添加到邮件中
+// 图片路径相对于正文文件所在的文件夹，找不到时在 email-sender-attachments 文件夹中查找
+func embedImages(em *email.Email, body []byte, htmlPath string) ([]byte, error) {
+	var buf bytes.Buffer
+	cids := make(map[string]string)
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		// Token 会原地反转义 Raw 返回的内容，需要先复制
+		raw := append([]byte(nil), z.Raw()...)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			buf.Write(raw)
+			continue
+		}
+		token := z.Token()
+		if token.DataAtom != atom.Img {
+			buf.Write(raw)
+			continue
+		}
+
+		changed := false
+		for i, attr := range token.Attr {
+			if attr.Key != "src" || !isLocalImage(attr.Val) {
+				continue
+			}
+			path, err := findImage(attr.Val, htmlPath)
+			if err != nil {
+				return nil, err
+			}
+			cid, ok := cids[path]
+			if !ok {
+				if cid, err = attachInline(em, path); err != nil {
+					return nil, err
+				}
+				cids[path] = cid
+			}
+			token.Attr[i].Val = "cid:" + cid
+			changed = true
+		}
+		if changed {
+			buf.WriteString(token.String())
+		} else {
+			buf.Write(raw)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// isLocalImage 判断 src 是否为本地文件，网络地址、data: 和 cid: 不处理
+func isLocalImage(src string) bool {
+	src = strings.TrimSpace(src)
+	if src == "" || strings.HasPrefix(src, "//") {
+		return false
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return true
+	}
+	// Windows 路径 C:\... 会被解析为 scheme c
+	return u.Scheme == "" || u.Scheme == "file" || len(u.Scheme) == 1
+}
+
+// findImage 查找图片文件，依次在正文文件所在的文件夹和 email-sender-attachments 文件夹中查找
+func findImage(src, htmlPath string) (string, error) {
+	src = strings.TrimSpace(src)
+	if u, err := url.Parse(src); err == nil && len(u.Scheme) != 1 {
+		src = u.Path
+	}
+	candidates := []string{src}
+	if !filepath.IsAbs(src) {
+		candidates = []string{filepath.Join(filepath.Dir(htmlPath), src), filepath.Join(AttachmentPath, src)}
+	}
+	for _, candidate := range candidates {
+		if fi, err := os.Stat(candidate); err == nil && fi.Mode().IsRegular() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("邮件正文中的图片 %s 不存在", src)
+}
+
+// attachInline 将图片作为内嵌附件添加到邮件中，返回 Content-ID
+func attachInline(em *email.Email, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(content)
+	cid := hex.EncodeToString(sum[:8]) + "@email-sender"
+
+	a, err := em.Attach(bytes.NewReader(content), filepath.Base(path), mime.TypeByExtension(filepath.Ext(path)))
+	if err != nil {
+		return "", err
+	}
+	a.HTMLRelated = true
+	a.Header.Set("Content-ID", "<"+cid+">")
+	return cid, nil
+}
+
+var (
+	blankLinesRe = regexp.MustCompile(`\n{3,}`)
+	spacesRe     = regexp.MustCompile(`[ \t\r\f\v]+`)
+)
+
+// htmlToText 将 HTML 正文转换为纯文本，保留段落、换行和链接地址
+func htmlToText(body []byte) []byte {
+	var buf strings.Builder
+	var href string
+	skip := 0
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		token := z.Token()
+		switch tt {
+		case html.TextToken:
+			if skip == 0 {
+				buf.WriteString(spacesRe.ReplaceAllString(strings.ReplaceAll(token.Data, "\n", " "), " "))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch token.DataAtom {
+			case atom.Head, atom.Script, atom.Style, atom.Title:
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case atom.Br:
+				buf.WriteString("\n")
+			case atom.P, atom.Div, atom.Table, atom.Tr, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+				atom.Ul, atom.Ol, atom.Blockquote, atom.Hr:
+				buf.WriteString("\n")
+			case atom.Li:
+				buf.WriteString("\n- ")
+			case atom.Td, atom.Th:
+				buf.WriteString("\t")
+			case atom.A:
+				href = attrValue(token, "href")
+			case atom.Img:
+				if alt := attrValue(token, "alt"); alt != "" && skip == 0 {
+					buf.WriteString("[" + alt + "]")
+				}
+			}
+		case html.EndTagToken:
+			switch token.DataAtom {
+			case atom.Head, atom.Script, atom.Style, atom.Title:
+				if skip > 0 {
+					skip--
+				}
+			case atom.P, atom.Div, atom.Table, atom.Tr, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+				atom.Ul, atom.Ol, atom.Blockquote:
+				buf.WriteString("\n")
+			case atom.A:
+				if href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(href, "mailto:") {
+					buf.WriteString(" (" + href + ")")
+				}
+				href = ""
+			}
+		}
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text := blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return []byte(strings.TrimSpace(text) + "\n")
+}
+
+func attrValue(token html.Token, key string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,192 @@
+package main
+
+// 检查退信
+// 通过 IMAP 在收件箱中查找退信，根据退信中引用的 Message-ID 找到发送日志中对应的邮件，标记为退信
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/bounce"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imap"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/journal"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// runEntries 查找某次运行中发送成功的邮件，runID 为空时使用最近一次运行，返回 Message-ID -> 记录
+func runEntries(j *journal.Journal, runID string) (string, map[string]journal.Entry, error) {
+	entries := j.Entries()
+	if runID == "" {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Status == journal.StatusSent && entries[i].RunID != "" {
+				runID = entries[i].RunID
+				break
+			}
+		}
+		if runID == "" {
+			return "", nil, fmt.Errorf("发送日志 %s 中没有发送成功的邮件", j.Path())
+		}
+	}
+	sent := make(map[string]journal.Entry)
+	for _, e := range entries {
+		if e.RunID == runID && e.Status == journal.StatusSent && e.MessageID != "" {
+			sent[e.MessageID] = e
+		}
+	}
+	if len(sent) == 0 {
+		return "", nil, fmt.Errorf("发送日志 %s 中没有运行 %s 发送成功的邮件", j.Path(), runID)
+	}
+	return runID, sent, nil
+}
+
+// bouncedEntries 发送日志中已经记录过的退信，Message-ID -> 记录
+func bouncedEntries(j *journal.Journal) map[string]journal.Entry {
+	bounced := make(map[string]journal.Entry)
+	for _, e := range j.Entries() {
+		if e.Status == journal.StatusBounced {
+			bounced[e.MessageID] = e
+		}
+	}
+	return bounced
+}
+
+// findBounces 通过 IMAP 查找 since 之后收到的退信，返回 Message-ID -> 退信，只返回 sent 中的邮件
+func findBounces(cfg imap.Config, mailbox string, since time.Time, sent map[string]journal.Entry) (map[string]*bounce.Report, error) {
+	c, err := imap.Dial(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("连接 IMAP 服务器 %s 失败 %s", cfg.Addr, err)
+	}
+	defer func() { _ = c.Logout() }()
+
+	if _, err = c.Select(mailbox); err != nil {
+		return nil, fmt.Errorf("打开邮箱 %s 失败 %s", mailbox, err)
+	}
+	// SINCE 只比较日期，使用前一天避免时区不同时漏掉
+	uids, err := c.UIDSearch("SINCE " + since.AddDate(0, 0, -1).Format("2-Jan-2006"))
+	if err != nil {
+		return nil, fmt.Errorf("搜索邮件失败 %s", err)
+	}
+
+	// 先获取邮件头，只下载可能是退信的邮件
+	headers, err := c.UIDFetch(uids, "BODY.PEEK[HEADER]")
+	if err != nil {
+		return nil, fmt.Errorf("获取邮件失败 %s", err)
+	}
+	var candidates []uint32
+	for _, uid := range uids {
+		m, err := mail.ReadMessage(strings.NewReader(string(headers[uid]) + "\r\n"))
+		if err == nil && bounce.IsBounce(m.Header) {
+			candidates = append(candidates, uid)
+		}
+	}
+	log.Printf("邮箱 %s 中 %s 之后共有 %d 封邮件，其中 %d 封可能是退信\n", mailbox, since.Format("2006-01-02"), len(uids), len(candidates))
+
+	msgs, err := c.UIDFetch(candidates, "BODY.PEEK[]")
+	if err != nil {
+		return nil, fmt.Errorf("获取邮件失败 %s", err)
+	}
+	reports := make(map[string]*bounce.Report)
+	for _, uid := range candidates {
+		report, err := bounce.Parse(msgs[uid])
+		if err != nil {
+			log.Printf("解析退信失败，忽略 UID %d %s", uid, err)
+			continue
+		}
+		// 只有延迟投递等通知、没有投递失败的收件人时不是退信
+		if report == nil || !report.Bounced() {
+			continue
+		}
+		for _, id := range report.MessageIDs {
+			if _, ok := sent[id]; ok {
+				reports[id] = report
+			}
+		}
+	}
+	return reports, nil
+}
+
+// bouncedEntry 生成退信记录
+func bouncedEntry(sent journal.Entry, report *bounce.Report) journal.Entry {
+	entry := sent
+	entry.Status = journal.StatusBounced
+	entry.Time = time.Now()
+	entry.Attempts = 0
+
+	var reasons []string
+	for _, rcpt := range report.Recipients {
+		if !rcpt.Failed() {
+			continue
+		}
+		entry.Bounced = append(entry.Bounced, rcpt.Address)
+		reason := rcpt.Address
+		if rcpt.Status != "" {
+			reason += " " + rcpt.Status
+		}
+		if rcpt.Diagnostic != "" {
+			reason += " " + rcpt.Diagnostic
+		}
+		reasons = append(reasons, reason)
+	}
+	if len(reasons) == 0 {
+		// 不标准的退信，无法获取失败的收件人
+		reasons = append(reasons, report.Subject)
+	}
+	entry.Error = "退信：" + strings.Join(reasons, "；")
+	return entry
+}
+
+// checkRunBounces 检查一次运行的退信，写入发送日志和 email-list Sheet
+func checkRunBounces(f *excelize.File, headRow []string, cfg *Config, j *journal.Journal, runID string) error {
+	if cfg.IMAP.Server == "" {
+		return errors.New("没有配置 IMAP 服务器，请在配置文件中设置 emailSender.imap.server 或使用 --imap-server")
+	}
+	runID, sent, err := runEntries(j, runID)
+	if err != nil {
+		return err
+	}
+	since := time.Now()
+	for _, e := range sent {
+		if e.Time.Before(since) {
+			since = e.Time
+		}
+	}
+	log.Printf("检查运行 %s 的退信，共发送成功 %d 封邮件\n", runID, len(sent))
+
+	reports, err := findBounces(cfg.imapConfig(), cfg.IMAP.Mailbox, since, sent)
+	if err != nil {
+		return err
+	}
+
+	// 已经记录过的退信不重复记录，但仍然写入结果
+	recorded := bouncedEntries(j)
+	var results []journal.Entry
+	for id, report := range reports {
+		entry, ok := recorded[id]
+		if !ok {
+			entry = bouncedEntry(sent[id], report)
+			if err = j.Append(entry); err != nil {
+				log.Printf("写入发送日志失败 %s", err)
+			}
+		}
+		log.Printf("第 %d 行 %s %s\n", entry.Row, entry.Subject, entry.Error)
+		results = append(results, entry)
+	}
+	if len(results) == 0 {
+		log.Printf("没有找到退信\n\n")
+		return nil
+	}
+	log.Printf("共 %d 封邮件被退信\n\n", len(results))
+
+	if err = writeResults(f, headRow, results); err != nil {
+		return fmt.Errorf("写入发送结果失败 %s", err)
+	}
+	resultFile, err := saveResults(f, cfg.ResultFile)
+	if err != nil {
+		return fmt.Errorf("保存发送结果失败 %s", err)
+	}
+	log.Printf("退信结果已写入 %s email-list Sheet\n\n", resultFile)
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/bounce"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imap"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imapsink"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/journal"
+)
+
+// sentMessage 发送日志中的一封邮件，rcpts 为投递失败的收件人，为空时没有退信
+type sentMessage struct {
+	row   int
+	id    string
+	to    []string
+	rcpts []bounce.Recipient
+}
+
+// bounceMailbox 启动 IMAP 服务器，收件箱中放入 msgs 的退信和其他邮件，返回服务器和写入了发送记录的发送日志
+func bounceMailbox(t *testing.T, runID string, msgs []sentMessage) (*imapsink.Server, *journal.Journal) {
+	t.Helper()
+	s := &imapsink.Server{}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	j, err := journal.Open(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+
+	for _, m := range msgs {
+		if err = j.Append(journal.Entry{RunID: runID, Row: m.row, Key: m.id, To: m.to, Subject: "工资条",
+			Status: journal.StatusSent, MessageID: m.id, Time: time.Now().Add(-time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+		if len(m.rcpts) == 0 {
+			continue
+		}
+		orig := fmt.Sprintf("From: hr@example.com\r\nTo: %s\r\nSubject: test\r\nMessage-Id: %s\r\n\r\nhello\r\n", m.to[0], m.id)
+		dsn, err := bounce.NewDSN("mx.example.org", "hr@example.com", []byte(orig), m.rcpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Deliver("INBOX", dsn)
+	}
+
+	// 不是退信的邮件：普通回复和不在发送日志中的邮件的退信
+	s.Deliver("INBOX", []byte("From: zhangsan@example.com\r\nSubject: Re: 工资条\r\n"+
+		"In-Reply-To: <row2@example.com>\r\n\r\nMessage-ID: <row2@example.com>\r\n"))
+	other, err := bounce.NewDSN("mx.example.org", "hr@example.com",
+		[]byte("From: hr@example.com\r\nMessage-Id: <other@example.com>\r\n\r\nhello\r\n"),
+		[]bounce.Recipient{{Address: "x@example.org", Action: "failed", Status: "5.1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Deliver("INBOX", other)
+	return s, j
+}
+
+// testBounces 第 2 行退信，第 3 行只有延迟投递通知，第 4 行部分收件人退信，第 5 行没有退信
+var testBounces = []sentMessage{
+	{row: 2, id: "<row2@example.com>", to: []string{"zhangsan@example.com"}, rcpts: []bounce.Recipient{
+		{Address: "zhangsan@example.com", Action: "failed", Status: "5.1.1", Diagnostic: "550 5.1.1 User unknown"},
+	}},
+	{row: 3, id: "<row3@example.com>", to: []string{"lisi@example.com"}, rcpts: []bounce.Recipient{
+		{Address: "lisi@example.com", Action: "delayed", Status: "4.4.7", Diagnostic: "451 4.4.7 Try again later"},
+	}},
+	{row: 4, id: "<row4@example.com>", to: []string{"wangwu@example.com", "zhaoliu@example.com"}, rcpts: []bounce.Recipient{
+		{Address: "wangwu@example.com", Action: "delivered", Status: "2.0.0"},
+		{Address: "zhaoliu@example.com", Action: "failed", Status: "5.2.2", Diagnostic: "552 5.2.2 Mailbox full"},
+	}},
+	{row: 5, id: "<row5@example.com>", to: []string{"sunqi@example.com"}},
+}
+
+func TestFindBounces(t *testing.T) {
+	s, j := bounceMailbox(t, "r1", testBounces)
+	runID, sent, err := runEntries(j, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runID != "r1" || len(sent) != len(testBounces) {
+		t.Fatalf("runEntries = %s, %d entries", runID, len(sent))
+	}
+
+	reports, err := findBounces(imap.Config{Addr: s.Addr, Security: imap.SecurityNone, Username: "u", Password: "p"},
+		"INBOX", time.Now().Add(-time.Hour), sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for id := range reports {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if want := []string{"<row2@example.com>", "<row4@example.com>"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("bounced Message-IDs = %v, want %v", ids, want)
+	}
+
+	tests := []struct {
+		id      string
+		bounced []string
+		err     string
+	}{
+		{"<row2@example.com>", []string{"zhangsan@example.com"}, "退信：zhangsan@example.com 5.1.1 550 5.1.1 User unknown"},
+		{"<row4@example.com>", []string{"zhaoliu@example.com"}, "退信：zhaoliu@example.com 5.2.2 552 5.2.2 Mailbox full"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			entry := bouncedEntry(sent[tt.id], reports[tt.id])
+			if entry.Status != journal.StatusBounced || entry.MessageID != tt.id || entry.Row != sent[tt.id].Row {
+				t.Errorf("entry = %+v", entry)
+			}
+			if !reflect.DeepEqual(entry.Bounced, tt.bounced) {
+				t.Errorf("bounced recipients = %v, want %v", entry.Bounced, tt.bounced)
+			}
+			if entry.Error != tt.err {
+				t.Errorf("error = %q, want %q", entry.Error, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckRunBounces(t *testing.T) {
+	s, j := bounceMailbox(t, "r1", testBounces)
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "email-list")
+	headRow := []string{"收件人", "抄送", "主题", "正文", "附件"}
+	cfg := &Config{
+		Username:   "hr@example.com",
+		Password:   "secret",
+		ResultFile: filepath.Join(t.TempDir(), "result.xlsx"),
+		IMAP:       IMAPConfig{Server: s.Addr, Security: imap.SecurityNone, Mailbox: "INBOX"},
+	}
+
+	// 第二次检查时已经记录过的退信不重复记录
+	for i := 0; i < 2; i++ {
+		if err := checkRunBounces(f, headRow, cfg, j, ""); err != nil {
+			t.Fatal(err)
+		}
+		bounced := bouncedEntries(j)
+		if len(bounced) != 2 || len(j.Entries()) != len(testBounces)+2 {
+			t.Fatalf("check %d: journal has %d bounced of %d entries", i+1, len(bounced), len(j.Entries()))
+		}
+	}
+
+	result, err := excelize.OpenFile(cfg.ResultFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for row, want := range map[int]string{2: "退信", 3: "", 4: "退信", 5: ""} {
+		cell, _ := excelize.CoordinatesToCellName(len(headRow)+1, row)
+		if got, _ := result.GetCellValue("email-list", cell); got != want {
+			t.Errorf("row %d status = %q, want %q", row, got, want)
+		}
+	}
+}
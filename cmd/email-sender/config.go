@@ -0,0 +1,522 @@
+package main
+
+// 配置
+// 优先级从高到低：命令行参数 > 环境变量 > YAML 配置文件 > Excel 配置文件 email-config Sheet（兼容旧版本）
+// 密码不支持命令行参数，优先级：环境变量 > YAML 配置文件 > 系统钥匙串 > Excel 配置文件
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/xuri/excelize/v2"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/dkim"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imap"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/schedule"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/transport"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/xlsxtable"
+	"github.com/zalando/go-keyring"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KeyringService 系统钥匙串中保存密码的服务名，账号为发件人邮箱
+const KeyringService = "toolset-email-sender"
+
+// Config 邮件发送配置
+type Config struct {
+	Transport   string // 发送方式：smtp、http
+	Server      string // 服务器地址，格式为 serverName:smtpPort
+	Username    string // 发件人邮箱
+	Password    string
+	BccYourself bool // 是否将邮件密送自己
+
+	FromName string            // 发件人名称
+	ReplyTo  string            // 回复地址，多个地址用逗号分隔
+	Headers  map[string]string // 自定义邮件头
+
+	Security           string // 连接加密方式：auto、tls、starttls、none
+	Auth               string // 认证方式：auto、plain、login、cram-md5、xoauth2、none
+	CAFile             string // 自定义的 CA 证书文件
+	InsecureSkipVerify bool   // 不校验服务器证书
+
+	RateLimit          float64 // 每分钟最多发送的邮件数量，为 0 时不限流
+	RateBurst          int     // 最多可以连续发送的邮件数量
+	MaxMessagesPerConn int     // 每个连接最多发送的邮件数量，为 0 时不限制
+
+	Retries    int           // 临时错误的最多重试次数
+	RetryDelay time.Duration // 第一次重试前等待的时间，之后每次翻倍
+	Journal    string        // 发送日志文件
+
+	ResultFile string // 发送结果写入的 Excel 文件，为空时写回 Excel 配置文件
+
+	AttachmentMaxSize int64  // 每封邮件附件总大小的上限（字节），为 0 时不限制
+	ZipAttachments    bool   // 是否将每封邮件的附件压缩成一个 zip 包
+	ZipOver           int64  // 附件总大小超过该值时才压缩，为 0 时总是压缩
+	ZipName           string // 压缩包文件名，可以使用模板变量
+
+	SendAt      time.Time         // 定时发送时间，为零值时立即发送
+	SendWindows []schedule.Window // 发送时间段，不在时间段内时暂停发送
+
+	DKIMDomain     string // DKIM 签名域名，默认为发件人邮箱的域名
+	DKIMSelector   string // DKIM 选择器
+	DKIMPrivateKey string // DKIM 私钥文件（PEM 格式，RSA 或 Ed25519），为空时不签名
+
+	PGPKeyring string // PGP 公钥文件夹，按邮箱查找收件人的公钥
+	PGPEncrypt bool   // 是否对所有邮件进行 PGP 加密
+
+	SuppressionFile  string // 退订名单文件：文本文件（每行一个邮箱）、CSV 文件（第一列）或 Excel 文件（第一个 Sheet 的第一列）
+	SuppressionSheet string // Excel 配置文件中的退订名单 Sheet（第一列）
+
+	UnsubscribeURL      string // 退订链接模板，添加到 List-Unsubscribe 邮件头
+	UnsubscribeMailto   string // 退订邮箱模板，如 unsubscribe@example.com?subject=unsubscribe
+	UnsubscribeOneClick bool   // 退订链接为 HTTPS 时是否添加 List-Unsubscribe-Post 支持一键退订
+
+	IMAP IMAPConfig // 检查退信和保存已发送邮件使用的 IMAP 配置
+	HTTP HTTPConfig // 通过 HTTP 邮件 API 发送时的配置
+
+	TableBody TableBodyConfig // 正文文件名为 @table 时的表格正文配置
+}
+
+// HTTPConfig HTTP 邮件 API 配置，密码为 API Key 或 access token
+type HTTPConfig struct {
+	URL     string            // API 地址
+	Method  string            // 请求方法，默认为 POST
+	Headers map[string]string // 请求头，可以使用 {{.Username}} 和 {{.Password}}
+	Payload string            // 请求体模板（JSON），为空时发送 Base64 编码的完整邮件
+	Timeout time.Duration     // 请求超时时间
+}
+
+// IMAPConfig IMAP 连接配置，用户名和密码默认与 SMTP 相同
+type IMAPConfig struct {
+	Server   string // 服务器地址，格式为 serverName:imapPort
+	Security string // 连接加密方式：auto（993 端口使用 tls，其他端口使用 starttls）、tls、starttls、none
+	Auth     string // 认证方式：auto、xoauth2
+	Username string
+	Password string
+	Mailbox  string // 查找退信的邮箱，默认为 INBOX
+	// SentFolder 发送成功的邮件追加（APPEND）到该文件夹，如 Sent，为空时不保存
+	SentFolder string
+}
+
+// dkimSigner 创建 DKIM 签名，没有配置私钥时返回 nil
+func (cfg *Config) dkimSigner() (*dkim.Signer, error) {
+	if cfg.DKIMPrivateKey == "" {
+		return nil, nil
+	}
+	domain := cfg.DKIMDomain
+	if domain == "" {
+		domain = cfg.Username[strings.LastIndex(cfg.Username, "@")+1:]
+	}
+	signer, err := dkim.NewSigner(domain, cfg.DKIMSelector, cfg.DKIMPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("DKIM 配置错误 %s", err)
+	}
+	return signer, nil
+}
+
+// transportConfig SMTP 连接配置
+func (cfg *Config) transportConfig() transport.Config {
+	return transport.Config{
+		Addr:               cfg.Server,
+		Security:           cfg.Security,
+		Auth:               cfg.Auth,
+		Username:           cfg.Username,
+		Password:           cfg.Password,
+		CAFile:             cfg.CAFile,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+}
+
+// newTransport 根据配置的发送方式创建 SMTP 客户端或 HTTP 客户端
+func (cfg *Config) newTransport() (transport.Transport, error) {
+	if cfg.Transport == transport.KindHTTP {
+		return transport.NewHTTPClient(transport.HTTPConfig{
+			URL:                cfg.HTTP.URL,
+			Method:             cfg.HTTP.Method,
+			Headers:            cfg.HTTP.Headers,
+			Payload:            cfg.HTTP.Payload,
+			Username:           cfg.Username,
+			Password:           cfg.Password,
+			CAFile:             cfg.CAFile,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			Timeout:            cfg.HTTP.Timeout,
+		})
+	}
+	client, err := transport.NewSMTPClient(cfg.transportConfig())
+	if err != nil {
+		return nil, err
+	}
+	client.MaxMessagesPerConn = cfg.MaxMessagesPerConn
+	return client, nil
+}
+
+// imapConfig IMAP 连接配置，没有配置 IMAP 密码时使用 SMTP 密码
+func (cfg *Config) imapConfig() imap.Config {
+	password := cfg.IMAP.Password
+	if password == "" {
+		password = cfg.Password
+	}
+	return imap.Config{
+		Addr:               cfg.IMAP.Server,
+		Security:           cfg.IMAP.Security,
+		Auth:               cfg.IMAP.Auth,
+		Username:           cfg.IMAP.Username,
+		Password:           password,
+		CAFile:             cfg.CAFile,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+}
+
+var (
+	configPath    string
+	savePassword  bool
+	resume        bool
+	resendUnknown bool
+	previewDir    string
+	dkimRecord    bool
+	checkBounces  bool
+	bounceRunID   string
+	assumeYes     bool
+	outputFormat  string
+)
+
+func init() {
+	pflag.StringVar(&configPath, "config", "",
+		"YAML config file, default $HOME/.toolset/config.yaml if exists.")
+	pflag.String("excel", filepath.Join("configs", ConfigFile),
+		"Excel file with the email-list sheet.")
+	pflag.String("attachments-dir", filepath.Join("configs", AttachmentPath),
+		"Folder of the attachments.")
+	pflag.String("transport", transport.KindSMTP, "Send through smtp, or http to use the HTTP mail API configured in emailSender.http.")
+	pflag.String("server", "", "SMTP server, serverName:smtpPort.")
+	pflag.String("username", "", "SMTP username(email).")
+	pflag.Bool("bcc-yourself", false, "Bcc every email to yourself.")
+	pflag.String("from-name", "", "Display name of the sender.")
+	pflag.String("reply-to", "", "Reply-To addresses, separated by commas.")
+	pflag.String("security", transport.SecurityAuto,
+		"Connection security: auto (tls on port 465, otherwise starttls), tls, starttls or none.")
+	pflag.String("auth", transport.AuthAuto,
+		"Auth mechanism: auto, plain, login, cram-md5, xoauth2 (password is the access token) or none.")
+	pflag.String("ca-file", "", "PEM file of CA certificates to verify the server certificate.")
+	pflag.Bool("insecure-skip-verify", false, "Do not verify the server certificate. Insecure.")
+	pflag.Float64("rate-limit", 12, "Max emails sent per minute, 0 for unlimited.")
+	pflag.Int("rate-burst", 1, "Max emails sent in a row before the rate limit applies.")
+	pflag.Int("max-messages-per-conn", 0, "Reconnect after sending this many emails on one connection, 0 for unlimited.")
+	pflag.Int("retries", 3, "Max retries of temporary errors (SMTP 4xx or network errors).")
+	pflag.Duration("retry-delay", 30*time.Second, "Wait before the first retry, doubled on each retry.")
+	pflag.String("journal", "", "Send journal file, default <excel>.journal.jsonl.")
+	pflag.String("send-at", "", "Send at this time, 2006-01-02 15:04 or 15:04 for the next occurrence.")
+	pflag.StringSlice("send-window", nil, "Send only within these windows, e.g. \"Mon-Fri 09:00-18:00\", repeatable.")
+	pflag.String("dkim-key", "", "DKIM private key file (PEM, RSA or Ed25519), empty to not sign.")
+	pflag.String("dkim-selector", "", "DKIM selector.")
+	pflag.String("dkim-domain", "", "DKIM signing domain, default the domain of the username.")
+	pflag.BoolVar(&dkimRecord, "dkim-record", false, "Print the DNS TXT record of the DKIM public key, then exit.")
+	pflag.String("pgp-keyring", "", "Folder of the recipients' OpenPGP public keys (.asc, .gpg).")
+	pflag.Bool("pgp-encrypt", false, "Encrypt every email with OpenPGP (PGP/MIME only, S/MIME is not supported), rows without keys are not sent.")
+	pflag.String("attachment-max-size", "20M", "Max total size of the attachments of one email, e.g. 20M, 0 for unlimited.")
+	pflag.Bool("zip-attachments", false, "Zip the attachments of each email into one archive.")
+	pflag.String("zip-over", "0", "Only zip when the attachments are larger than this size in total, e.g. 5M.")
+	pflag.String("zip-name", "attachments.zip", "File name of the zip archive, template variables allowed.")
+	pflag.String("suppression-file", "", "File of addresses never to send to: one per line, CSV (first column) or .xlsx (first column).")
+	pflag.String("suppression-sheet", "", "Sheet of the Excel file whose first column lists addresses never to send to.")
+	pflag.String("unsubscribe-url", "", "List-Unsubscribe URL, template variables allowed, e.g. https://example.com/unsub?e={{urlquery .收件人邮箱}}.")
+	pflag.String("unsubscribe-mailto", "", "List-Unsubscribe mailto address, template variables allowed, e.g. unsubscribe@example.com.")
+	pflag.String("table-file", "", "Data workbook of the @table body, default the Excel file.")
+	pflag.String("table-sheet", "", "Data sheet of the @table body, default email-list.")
+	pflag.String("table-key", "", "Column of the data sheet to find the row of the @table body, default the same row number.")
+	pflag.StringSlice("table-columns", nil, "Columns shown in the @table body, default all.")
+	pflag.String("table-layout", xlsxtable.LayoutHorizontal, "Layout of the @table body: horizontal (headers on top) or vertical (headers on the left).")
+	pflag.String("result-file", "", "Write the send results to a copy of the Excel file, default write back to the Excel file.")
+	pflag.BoolVar(&resume, "resume", false, "Skip the rows already sent successfully according to the send journal.")
+	pflag.BoolVar(&resendUnknown, "resend-unknown", false,
+		"With --resume, send again the rows whose result is unknown (the connection was lost after the email was submitted).")
+	pflag.StringVar(&previewDir, "preview", "", "Write the emails to .eml files in this folder instead of sending.")
+	pflag.String("http-url", "", "URL of the HTTP mail API, used with --transport http.")
+	pflag.String("imap-server", "", "IMAP server to check bounces and save sent emails, serverName:imapPort.")
+	pflag.String("imap-security", transport.SecurityAuto,
+		"IMAP connection security: auto (tls on port 993, otherwise starttls), tls, starttls or none.")
+	pflag.String("imap-mailbox", "INBOX", "IMAP mailbox to look for bounces.")
+	pflag.String("sent-folder", "", "Append every sent email to this IMAP folder, e.g. Sent, empty to not save.")
+	pflag.BoolVar(&checkBounces, "check-bounces", false,
+		"Check the bounces of a run via IMAP and mark the bounced rows in the results, then exit.")
+	pflag.StringVar(&bounceRunID, "run", "", "Run ID to check bounces, default the latest run in the send journal.")
+	pflag.BoolVarP(&assumeYes, "yes", "y", false,
+		"Send without confirmation and do not wait for a key press at exit, for unattended runs.")
+	pflag.StringVarP(&outputFormat, "output", "o", outputText,
+		"Output format: text, or json to print the planned emails and results as JSON to stdout.")
+	pflag.BoolVar(&savePassword, "save-password", false,
+		"Prompt for the password and save it to the OS keyring, then exit.")
+
+	pflag.Parse()
+
+	// 命令行参数
+	_ = viper.BindPFlag("emailSender.excelFile", pflag.Lookup("excel"))
+	_ = viper.BindPFlag("emailSender.attachmentsDir", pflag.Lookup("attachments-dir"))
+	_ = viper.BindPFlag("emailSender.transport", pflag.Lookup("transport"))
+	_ = viper.BindPFlag("emailSender.server", pflag.Lookup("server"))
+	_ = viper.BindPFlag("emailSender.username", pflag.Lookup("username"))
+	_ = viper.BindPFlag("emailSender.bccYourself", pflag.Lookup("bcc-yourself"))
+	_ = viper.BindPFlag("emailSender.fromName", pflag.Lookup("from-name"))
+	_ = viper.BindPFlag("emailSender.replyTo", pflag.Lookup("reply-to"))
+	_ = viper.BindPFlag("emailSender.security", pflag.Lookup("security"))
+	_ = viper.BindPFlag("emailSender.auth", pflag.Lookup("auth"))
+	_ = viper.BindPFlag("emailSender.caFile", pflag.Lookup("ca-file"))
+	_ = viper.BindPFlag("emailSender.insecureSkipVerify", pflag.Lookup("insecure-skip-verify"))
+	_ = viper.BindPFlag("emailSender.rateLimit", pflag.Lookup("rate-limit"))
+	_ = viper.BindPFlag("emailSender.rateBurst", pflag.Lookup("rate-burst"))
+	_ = viper.BindPFlag("emailSender.maxMessagesPerConn", pflag.Lookup("max-messages-per-conn"))
+	_ = viper.BindPFlag("emailSender.retries", pflag.Lookup("retries"))
+	_ = viper.BindPFlag("emailSender.retryDelay", pflag.Lookup("retry-delay"))
+	_ = viper.BindPFlag("emailSender.journal", pflag.Lookup("journal"))
+	_ = viper.BindPFlag("emailSender.resultFile", pflag.Lookup("result-file"))
+	_ = viper.BindPFlag("emailSender.attachments.maxSize", pflag.Lookup("attachment-max-size"))
+	_ = viper.BindPFlag("emailSender.attachments.zip", pflag.Lookup("zip-attachments"))
+	_ = viper.BindPFlag("emailSender.attachments.zipOver", pflag.Lookup("zip-over"))
+	_ = viper.BindPFlag("emailSender.attachments.zipName", pflag.Lookup("zip-name"))
+	_ = viper.BindPFlag("emailSender.suppression.file", pflag.Lookup("suppression-file"))
+	_ = viper.BindPFlag("emailSender.suppression.sheet", pflag.Lookup("suppression-sheet"))
+	_ = viper.BindPFlag("emailSender.listUnsubscribe.url", pflag.Lookup("unsubscribe-url"))
+	_ = viper.BindPFlag("emailSender.listUnsubscribe.mailto", pflag.Lookup("unsubscribe-mailto"))
+	_ = viper.BindPFlag("emailSender.tableBody.file", pflag.Lookup("table-file"))
+	_ = viper.BindPFlag("emailSender.tableBody.sheet", pflag.Lookup("table-sheet"))
+	_ = viper.BindPFlag("emailSender.tableBody.key", pflag.Lookup("table-key"))
+	_ = viper.BindPFlag("emailSender.tableBody.columns", pflag.Lookup("table-columns"))
+	_ = viper.BindPFlag("emailSender.tableBody.layout", pflag.Lookup("table-layout"))
+	_ = viper.BindPFlag("emailSender.dkim.privateKey", pflag.Lookup("dkim-key"))
+	_ = viper.BindPFlag("emailSender.dkim.selector", pflag.Lookup("dkim-selector"))
+	_ = viper.BindPFlag("emailSender.dkim.domain", pflag.Lookup("dkim-domain"))
+	_ = viper.BindPFlag("emailSender.pgp.keyring", pflag.Lookup("pgp-keyring"))
+	_ = viper.BindPFlag("emailSender.pgp.encrypt", pflag.Lookup("pgp-encrypt"))
+	_ = viper.BindPFlag("emailSender.sendAt", pflag.Lookup("send-at"))
+	_ = viper.BindPFlag("emailSender.sendWindows", pflag.Lookup("send-window"))
+	_ = viper.BindPFlag("emailSender.http.url", pflag.Lookup("http-url"))
+	_ = viper.BindPFlag("emailSender.imap.server", pflag.Lookup("imap-server"))
+	_ = viper.BindPFlag("emailSender.imap.security", pflag.Lookup("imap-security"))
+	_ = viper.BindPFlag("emailSender.imap.mailbox", pflag.Lookup("imap-mailbox"))
+	_ = viper.BindPFlag("emailSender.imap.sentFolder", pflag.Lookup("sent-folder"))
+
+	// 环境变量
+	_ = viper.BindEnv("emailSender.excelFile", "EMAIL_SENDER_EXCEL")
+	_ = viper.BindEnv("emailSender.attachmentsDir", "EMAIL_SENDER_ATTACHMENTS_DIR")
+	_ = viper.BindEnv("emailSender.transport", "EMAIL_SENDER_TRANSPORT")
+	_ = viper.BindEnv("emailSender.server", "EMAIL_SENDER_SERVER")
+	_ = viper.BindEnv("emailSender.username", "EMAIL_SENDER_USERNAME")
+	_ = viper.BindEnv("emailSender.password", "EMAIL_SENDER_PASSWORD")
+	_ = viper.BindEnv("emailSender.bccYourself", "EMAIL_SENDER_BCC_YOURSELF")
+	_ = viper.BindEnv("emailSender.security", "EMAIL_SENDER_SECURITY")
+	_ = viper.BindEnv("emailSender.auth", "EMAIL_SENDER_AUTH")
+	_ = viper.BindEnv("emailSender.caFile", "EMAIL_SENDER_CA_FILE")
+	_ = viper.BindEnv("emailSender.insecureSkipVerify", "EMAIL_SENDER_INSECURE_SKIP_VERIFY")
+	_ = viper.BindEnv("emailSender.rateLimit", "EMAIL_SENDER_RATE_LIMIT")
+	_ = viper.BindEnv("emailSender.http.url", "EMAIL_SENDER_HTTP_URL")
+	_ = viper.BindEnv("emailSender.imap.server", "EMAIL_SENDER_IMAP_SERVER")
+	_ = viper.BindEnv("emailSender.imap.password", "EMAIL_SENDER_IMAP_PASSWORD")
+
+	viper.SetDefault("emailSender.listUnsubscribe.oneClick", true)
+
+	viper.SetConfigType("yaml")
+	if configPath != "" {
+		viper.SetConfigFile(configPath)
+	} else {
+		viper.SetConfigName("config")
+		viper.AddConfigPath("$HOME/.toolset")
+	}
+}
+
+// readConfigFile 加载 YAML 配置文件，未指定 --config 时配置文件不存在不报错
+func readConfigFile() error {
+	err := viper.ReadInConfig()
+	var notFound viper.ConfigFileNotFoundError
+	if err != nil && configPath == "" && errors.As(err, &notFound) {
+		return nil
+	}
+	return err
+}
+
+// loadConfig 读取配置（不包括密码），YAML 配置文件、环境变量和命令行参数中没有的配置从 Excel 的 email-config Sheet 中读取
+func loadConfig(f *excelize.File) (*Config, error) {
+	cfg := &Config{}
+
+	// 从 Excel 中读取配置，旧版本的配置方式
+	cell := func(axis string) string {
+		value, _ := f.GetCellValue("email-config", axis)
+		return strings.TrimSpace(value)
+	}
+
+	cfg.Transport = strings.ToLower(viper.GetString("emailSender.transport"))
+	switch cfg.Transport {
+	case "", transport.KindSMTP:
+		cfg.Transport = transport.KindSMTP
+	case transport.KindHTTP:
+	default:
+		return nil, fmt.Errorf("配置 transport 错误 %s，可选 smtp、http", cfg.Transport)
+	}
+
+	// 通过 HTTP 邮件 API 发送时不需要 SMTP 服务器，--save-password 只保存密码，也不需要
+	cfg.Server = viper.GetString("emailSender.server")
+	if !viper.IsSet("emailSender.server") {
+		cfg.Server = cell("A2")
+	}
+	if cfg.Transport == transport.KindSMTP && !savePassword {
+		if cfg.Server == "" {
+			return nil, errors.New("读取配置 server 失败，" +
+				"请在配置文件中设置 emailSender.server，或将 server 信息写入 email-config Sheet 的 A2 单元格中，如 mail.exchange.com:587")
+		}
+		if len(strings.Split(cfg.Server, ":")) != 2 {
+			return nil, errors.New("配置 server 格式错误，格式为 serverName:smtpPort，用冒号将服务器名和 SMTP 端口连接起来")
+		}
+	}
+
+	cfg.Username = viper.GetString("emailSender.username")
+	if !viper.IsSet("emailSender.username") {
+		cfg.Username = cell("B2")
+	}
+	if cfg.Username == "" {
+		return nil, errors.New("读取配置 email 失败，" +
+			"请在配置文件中设置 emailSender.username，或将 email 信息写入 email-config Sheet 的 B2 单元格中，如 username@exchange.com")
+	}
+
+	cfg.BccYourself = viper.GetBool("emailSender.bccYourself")
+	if !viper.IsSet("emailSender.bccYourself") {
+		cfg.BccYourself = cell("D2") == "yes"
+	}
+
+	cfg.FromName = viper.GetString("emailSender.fromName")
+	cfg.ReplyTo = viper.GetString("emailSender.replyTo")
+	cfg.Headers = viper.GetStringMapString("emailSender.headers")
+
+	cfg.Security = viper.GetString("emailSender.security")
+	cfg.Auth = viper.GetString("emailSender.auth")
+	cfg.CAFile = viper.GetString("emailSender.caFile")
+	cfg.InsecureSkipVerify = viper.GetBool("emailSender.insecureSkipVerify")
+	cfg.RateLimit = viper.GetFloat64("emailSender.rateLimit")
+	cfg.RateBurst = viper.GetInt("emailSender.rateBurst")
+	cfg.MaxMessagesPerConn = viper.GetInt("emailSender.maxMessagesPerConn")
+	cfg.Retries = viper.GetInt("emailSender.retries")
+	cfg.RetryDelay = viper.GetDuration("emailSender.retryDelay")
+	cfg.Journal = viper.GetString("emailSender.journal")
+	if cfg.Journal == "" {
+		cfg.Journal = ConfigFile + ".journal.jsonl"
+	}
+	cfg.ResultFile = viper.GetString("emailSender.resultFile")
+
+	var err error
+	if cfg.AttachmentMaxSize, err = parseSizeConfig("attachments.maxSize", viper.GetString("emailSender.attachments.maxSize")); err != nil {
+		return nil, err
+	}
+	cfg.ZipAttachments = viper.GetBool("emailSender.attachments.zip")
+	if cfg.ZipOver, err = parseSizeConfig("attachments.zipOver", viper.GetString("emailSender.attachments.zipOver")); err != nil {
+		return nil, err
+	}
+	cfg.ZipName = viper.GetString("emailSender.attachments.zipName")
+	cfg.DKIMDomain = viper.GetString("emailSender.dkim.domain")
+	cfg.DKIMSelector = viper.GetString("emailSender.dkim.selector")
+	cfg.DKIMPrivateKey = viper.GetString("emailSender.dkim.privateKey")
+	cfg.PGPKeyring = viper.GetString("emailSender.pgp.keyring")
+	cfg.PGPEncrypt = viper.GetBool("emailSender.pgp.encrypt")
+	cfg.SuppressionFile = viper.GetString("emailSender.suppression.file")
+	cfg.SuppressionSheet = viper.GetString("emailSender.suppression.sheet")
+	cfg.UnsubscribeURL = viper.GetString("emailSender.listUnsubscribe.url")
+	cfg.UnsubscribeMailto = viper.GetString("emailSender.listUnsubscribe.mailto")
+	cfg.UnsubscribeOneClick = viper.GetBool("emailSender.listUnsubscribe.oneClick")
+
+	cfg.HTTP = HTTPConfig{
+		URL:     viper.GetString("emailSender.http.url"),
+		Method:  viper.GetString("emailSender.http.method"),
+		Headers: viper.GetStringMapString("emailSender.http.headers"),
+		Payload: viper.GetString("emailSender.http.payload"),
+		Timeout: viper.GetDuration("emailSender.http.timeout"),
+	}
+	if cfg.Transport == transport.KindHTTP && cfg.HTTP.URL == "" {
+		return nil, errors.New("读取配置 http.url 失败，通过 HTTP 邮件 API 发送时请在配置文件中设置 emailSender.http.url 或使用 --http-url")
+	}
+
+	cfg.TableBody = TableBodyConfig{
+		File:      viper.GetString("emailSender.tableBody.file"),
+		Sheet:     viper.GetString("emailSender.tableBody.sheet"),
+		HeaderRow: viper.GetInt("emailSender.tableBody.headerRow"),
+		Key:       viper.GetString("emailSender.tableBody.key"),
+		Match:     viper.GetString("emailSender.tableBody.match"),
+		Columns:   viper.GetStringSlice("emailSender.tableBody.columns"),
+		Layout:    strings.ToLower(viper.GetString("emailSender.tableBody.layout")),
+		Intro:     viper.GetString("emailSender.tableBody.intro"),
+		Footer:    viper.GetString("emailSender.tableBody.footer"),
+	}
+	switch cfg.TableBody.Layout {
+	case "", xlsxtable.LayoutHorizontal, xlsxtable.LayoutVertical:
+	default:
+		return nil, fmt.Errorf("配置 tableBody.layout 错误 %s，可选 horizontal、vertical", cfg.TableBody.Layout)
+	}
+
+	cfg.IMAP = IMAPConfig{
+		Server:   viper.GetString("emailSender.imap.server"),
+		Security: viper.GetString("emailSender.imap.security"),
+		Auth:     viper.GetString("emailSender.imap.auth"),
+		Username: viper.GetString("emailSender.imap.username"),
+		Password: viper.GetString("emailSender.imap.password"),
+		Mailbox:  viper.GetString("emailSender.imap.mailbox"),
+
+		SentFolder: viper.GetString("emailSender.imap.sentFolder"),
+	}
+	if cfg.IMAP.Auth == "" {
+		cfg.IMAP.Auth = cfg.Auth
+	}
+	if cfg.IMAP.Username == "" {
+		cfg.IMAP.Username = cfg.Username
+	}
+	if cfg.IMAP.Mailbox == "" {
+		cfg.IMAP.Mailbox = "INBOX"
+	}
+
+	if sendAt := viper.GetString("emailSender.sendAt"); sendAt != "" {
+		t, err := schedule.ParseTime(sendAt, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("配置 sendAt 错误 %s", err)
+		}
+		cfg.SendAt = t
+	}
+	windows, err := schedule.ParseWindows(viper.GetStringSlice("emailSender.sendWindows"))
+	if err != nil {
+		return nil, fmt.Errorf("配置 sendWindows 错误 %s", err)
+	}
+	cfg.SendWindows = windows
+
+	return cfg, nil
+}
+
+// loadPassword 读取密码，依次从环境变量、YAML 配置文件、系统钥匙串和 Excel 的 email-config Sheet 中读取
+func loadPassword(f *excelize.File, username string) (string, error) {
+	if password := viper.GetString("emailSender.password"); password != "" {
+		return password, nil
+	}
+	password, err := keyring.Get(KeyringService, username)
+	if err == nil && password != "" {
+		return password, nil
+	}
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		log.Printf("读取系统钥匙串失败 %s", err)
+	}
+	excelPassword, _ := f.GetCellValue("email-config", "C2")
+	if excelPassword != "" {
+		log.Printf("密码保存在 Excel 中不安全，建议使用环境变量 EMAIL_SENDER_PASSWORD 或 --save-password 保存到系统钥匙串")
+		return excelPassword, nil
+	}
+	return "", errors.New("读取配置 password 失败，" +
+		"请设置环境变量 EMAIL_SENDER_PASSWORD，或使用 --save-password 将密码保存到系统钥匙串")
+}
+
+// savePasswordToKeyring 从控制台输入密码，保存到系统钥匙串
+func savePasswordToKeyring(username string) error {
+	var password string
+	fmt.Fprintf(out, "请输入 %s 的密码：", username)
+	if _, err := fmt.Scanln(&password); err != nil {
+		return fmt.Errorf("输入错误 %s", err)
+	}
+	if err := keyring.Set(KeyringService, username, password); err != nil {
+		return fmt.Errorf("保存密码到系统钥匙串失败 %s", err)
+	}
+	return nil
+}
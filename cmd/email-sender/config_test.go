@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/dkim"
+	"github.com/zalando/go-keyring"
+)
+
+// TestRateLimitDefault 默认每分钟最多发送 12 封，不连续发送
+func TestRateLimitDefault(t *testing.T) {
+	for flag, want := range map[string]string{"rate-limit": "12", "rate-burst": "1"} {
+		if got := pflag.Lookup(flag).DefValue; got != want {
+			t.Errorf("--%s default = %s, want %s", flag, got, want)
+		}
+	}
+}
+
+// TestDKIMRecord --dkim-record 的 DNS 记录输出到 out，使用 --output json 时不混入标准输出的 JSON
+func TestDKIMRecord(t *testing.T) {
+	titles := []string{"收件人", "抄送", "主题", "正文", "附件", "姓名"}
+	e := newTestEnv(t, titles)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(e.dir, "dkim.pem")
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e.set("emailSender.dkim.privateKey", keyFile)
+	e.set("emailSender.dkim.selector", "s2026")
+
+	var buf bytes.Buffer
+	oldRecord, oldOut := dkimRecord, out
+	dkimRecord, out = true, &buf
+	defer func() { dkimRecord, out = oldRecord, oldOut }()
+	if code := run(); code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	want, err := dkim.PublicKeyRecord(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"名称：s2026._domainkey.example.com\n", "内容：" + want + "\n"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("output = %q, want %q", buf.String(), s)
+		}
+	}
+}
+
+// TestSavePassword --save-password 不需要配置 SMTP 服务器，提示输出到 out
+func TestSavePassword(t *testing.T) {
+	keyring.MockInit()
+	titles := []string{"收件人", "抄送", "主题", "正文", "附件", "姓名"}
+	e := newTestEnv(t, titles)
+	e.set("emailSender.server", "")
+	e.set("emailSender.password", "")
+	t.Cleanup(func() { _ = keyring.Delete(KeyringService, "hr@example.com") })
+
+	// 没有配置服务器时不能发送
+	if code := run(); code != exitError {
+		t.Fatalf("send without a server: exit code = %d, want %d", code, exitError)
+	}
+
+	stdin := filepath.Join(e.dir, "stdin")
+	if err := os.WriteFile(stdin, []byte("p@ss\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = in.Close() }()
+	var buf bytes.Buffer
+	oldSave, oldStdin, oldOut := savePassword, os.Stdin, out
+	savePassword, os.Stdin, out = true, in, &buf
+	defer func() { savePassword, os.Stdin, out = oldSave, oldStdin, oldOut }()
+
+	if code := run(); code != exitOK {
+		t.Fatalf("save password: exit code = %d", code)
+	}
+	if !strings.Contains(buf.String(), "请输入 hr@example.com 的密码：") {
+		t.Errorf("output = %q", buf.String())
+	}
+	if password, err := keyring.Get(KeyringService, "hr@example.com"); err != nil || password != "p@ss" {
+		t.Errorf("keyring password = %q, %v", password, err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+// PGP 加密，只支持 PGP/MIME，不支持 S/MIME
+// 需要加密的行，所有收件人和抄送人都必须在公钥文件夹中有公钥，否则该行不发送，不会以明文发送
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/jordan-wright/email"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/pgp"
+	"strings"
+)
+
+// encryptRecipients 获取一行邮件加密使用的公钥，不需要加密时返回 nil
+// 行中的 加密 列优先，为空时使用配置 pgp.encrypt
+func encryptRecipients(row emailRow, em *email.Email, cfg *Config, keyring *pgp.Keyring) (openpgp.EntityList, error) {
+	encrypt := cfg.PGPEncrypt
+	if row.Encrypt != "" {
+		encrypt = isYes(row.Encrypt)
+	}
+	if !encrypt {
+		return nil, nil
+	}
+	if keyring == nil {
+		return nil, errors.New("需要加密，但没有配置 PGP 公钥文件夹 pgp.keyring")
+	}
+
+	recipients, err := keyring.Recipients(append(append([]string(nil), em.To...), em.Cc...))
+	if err != nil {
+		return nil, fmt.Errorf("%s，不发送", err)
+	}
+	// 保存到已发送邮件文件夹或密送自己时同时使用发件人的公钥加密，否则自己无法查看
+	// 保存到已发送邮件文件夹时必须有发件人的公钥
+	if cfg.IMAP.SentFolder != "" || cfg.BccYourself {
+		e, ok := keyring.Lookup(cfg.Username)
+		if !ok && cfg.IMAP.SentFolder != "" {
+			return nil, fmt.Errorf("需要加密并保存到已发送邮件文件夹 %s，但没有发件人 %s 的公钥，不发送", cfg.IMAP.SentFolder, cfg.Username)
+		}
+		if ok {
+			recipients = append(recipients, e)
+		}
+	}
+	return recipients, nil
+}
+
+func isYes(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "y", "true", "1", "是":
+		return true
+	}
+	return false
+}
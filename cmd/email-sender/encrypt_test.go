@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/jordan-wright/email"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imapsink"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/pgp"
+)
+
+// writePublicKeys 为每个邮箱生成密钥，将公钥写入 dir，返回邮箱 -> 密钥（包括私钥）
+func writePublicKeys(t *testing.T, dir string, emails ...string) map[string]*openpgp.Entity {
+	t.Helper()
+	keys := make(map[string]*openpgp.Entity, len(emails))
+	for _, addr := range emails {
+		e, err := openpgp.NewEntity("", "", addr, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		w, _ := armor.Encode(&b, openpgp.PublicKeyType, nil)
+		if err = e.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		_ = w.Close()
+		if err = os.WriteFile(filepath.Join(dir, addr+".asc"), b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		keys[addr] = e
+	}
+	return keys
+}
+
+func TestEncryptRecipients(t *testing.T) {
+	dir := t.TempDir()
+	writePublicKeys(t, dir, "zhangsan@example.com", "hr@example.com")
+	keyring, _, err := pgp.LoadKeyring(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		to, cc     []string
+		rowEncrypt string
+		cfg        Config
+		keyring    *pgp.Keyring
+		wantKeys   int
+		wantErr    string
+	}{
+		{name: "not encrypted", to: []string{"lisi@example.com"}, keyring: keyring},
+		{name: "row says no", to: []string{"lisi@example.com"}, rowEncrypt: "否", cfg: Config{PGPEncrypt: true}, keyring: keyring},
+		{name: "all keys", to: []string{"zhangsan@example.com"}, cfg: Config{PGPEncrypt: true}, keyring: keyring, wantKeys: 1},
+		{name: "row says yes", to: []string{"zhangsan@example.com"}, rowEncrypt: "是", keyring: keyring, wantKeys: 1},
+		{name: "missing recipient key", to: []string{"zhangsan@example.com", "lisi@example.com"}, rowEncrypt: "yes", keyring: keyring,
+			wantErr: "没有找到 lisi@example.com 的 PGP 公钥"},
+		{name: "missing cc key", to: []string{"zhangsan@example.com"}, cc: []string{"lisi@example.com"}, cfg: Config{PGPEncrypt: true},
+			keyring: keyring, wantErr: "lisi@example.com"},
+		{name: "no keyring", to: []string{"zhangsan@example.com"}, cfg: Config{PGPEncrypt: true}, wantErr: "pgp.keyring"},
+		{name: "bcc yourself adds sender key", to: []string{"zhangsan@example.com"},
+			cfg: Config{PGPEncrypt: true, BccYourself: true, Username: "hr@example.com"}, keyring: keyring, wantKeys: 2},
+		{name: "bcc yourself without sender key", to: []string{"zhangsan@example.com"},
+			cfg: Config{PGPEncrypt: true, BccYourself: true, Username: "boss@example.com"}, keyring: keyring, wantKeys: 1},
+		{name: "sent folder adds sender key", to: []string{"zhangsan@example.com"},
+			cfg: Config{PGPEncrypt: true, Username: "hr@example.com", IMAP: IMAPConfig{SentFolder: "Sent"}}, keyring: keyring, wantKeys: 2},
+		{name: "sent folder requires sender key", to: []string{"zhangsan@example.com"},
+			cfg: Config{PGPEncrypt: true, Username: "boss@example.com", IMAP: IMAPConfig{SentFolder: "Sent"}}, keyring: keyring,
+			wantErr: "没有发件人 boss@example.com 的公钥"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			em := &email.Email{To: tt.to, Cc: tt.cc}
+			cfg := tt.cfg
+			keys, err := encryptRecipients(emailRow{Encrypt: tt.rowEncrypt}, em, &cfg, tt.keyring)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("encryptRecipients error = %v, want %q", err, tt.wantErr)
+				}
+				if keys != nil {
+					t.Errorf("encryptRecipients returned %d keys with an error", len(keys))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != tt.wantKeys {
+				t.Errorf("encryptRecipients = %d keys, want %d", len(keys), tt.wantKeys)
+			}
+		})
+	}
+}
+
+// TestEncryptNeverPlaintext 缺少公钥的行不发送，不会以明文到达 SMTP 服务器
+func TestEncryptNeverPlaintext(t *testing.T) {
+	titles := []string{"收件人", "抄送", "主题", "正文", "附件", "姓名", "加密"}
+	tests := []struct {
+		name       string
+		rows       [][]string
+		keys       []string
+		sentFolder bool
+		wantTo     []string // 收到的邮件的收件人
+		wantCode   int
+	}{
+		{
+			name: "missing recipient key",
+			rows: [][]string{
+				{"zhangsan@example.com", "", "工资条", "", "", "张三", "是"},
+				{"lisi@example.com", "", "工资条", "", "", "李四", "是"},
+				{"wangwu@example.com", "", "通知", "", "", "王五", "否"},
+			},
+			keys:     []string{"zhangsan@example.com"},
+			wantTo:   []string{"zhangsan@example.com", "wangwu@example.com"},
+			wantCode: exitFailed,
+		},
+		{
+			name: "missing cc key",
+			rows: [][]string{
+				{"zhangsan@example.com", "lisi@example.com", "工资条", "", "", "张三", "是"},
+			},
+			keys:     []string{"zhangsan@example.com"},
+			wantCode: exitFailed,
+		},
+		{
+			name: "sent folder without sender key",
+			rows: [][]string{
+				{"zhangsan@example.com", "", "工资条", "", "", "张三", "是"},
+			},
+			keys:       []string{"zhangsan@example.com"},
+			sentFolder: true,
+			wantCode:   exitFailed,
+		},
+		{
+			name: "sent folder with sender key",
+			rows: [][]string{
+				{"zhangsan@example.com", "", "工资条", "", "", "张三", "是"},
+			},
+			keys:       []string{"zhangsan@example.com", "hr@example.com"},
+			sentFolder: true,
+			wantTo:     []string{"zhangsan@example.com"},
+			wantCode:   exitOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, titles, tt.rows...)
+			keyDir := filepath.Join(e.dir, "keys")
+			if err := os.Mkdir(keyDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			keys := writePublicKeys(t, keyDir, tt.keys...)
+			e.set("emailSender.pgp.keyring", keyDir)
+
+			var imapServer *imapsink.Server
+			if tt.sentFolder {
+				imapServer = &imapsink.Server{}
+				if err := imapServer.Start(); err != nil {
+					t.Fatal(err)
+				}
+				defer func() { _ = imapServer.Close() }()
+				e.set("emailSender.imap.server", imapServer.Addr)
+				e.set("emailSender.imap.security", "none")
+				e.set("emailSender.imap.sentFolder", "Sent")
+			}
+
+			if code := run(); code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+			}
+
+			msgs := e.sink.Messages()
+			var to []string
+			for _, msg := range msgs {
+				to = append(to, msg.To...)
+				// 只有不需要加密的行以明文发送
+				encrypted := bytes.Contains(msg.Data, []byte("multipart/encrypted"))
+				if plain := strings.Join(msg.To, ",") == "wangwu@example.com"; encrypted == plain {
+					t.Errorf("message to %v encrypted = %v", msg.To, encrypted)
+				}
+				if encrypted && bytes.Contains(msg.Data, []byte("10000")) {
+					t.Errorf("encrypted message to %v contains the plaintext body", msg.To)
+				}
+			}
+			if strings.Join(to, ",") != strings.Join(tt.wantTo, ",") {
+				t.Errorf("received messages to %v, want %v", to, tt.wantTo)
+			}
+
+			// 已发送邮件文件夹中的邮件发件人可以解密
+			if imapServer != nil {
+				saved := imapServer.Messages("Sent")
+				if len(saved) != len(tt.wantTo) {
+					t.Fatalf("Sent folder has %d messages, want %d", len(saved), len(tt.wantTo))
+				}
+				for _, msg := range saved {
+					if _, err := decryptMessage(msg.Data, keys["hr@example.com"]); err != nil {
+						t.Errorf("sender cannot decrypt the saved message: %s", err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// decryptMessage 解密 PGP/MIME 邮件中的密文
+func decryptMessage(msg []byte, key *openpgp.Entity) ([]byte, error) {
+	start := bytes.Index(msg, []byte("-----BEGIN PGP MESSAGE-----"))
+	if start < 0 {
+		return nil, os.ErrNotExist
+	}
+	block, err := armor.Decode(bytes.NewReader(msg[start:]))
+	if err != nil {
+		return nil, err
+	}
+	md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{key}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	_, err = b.ReadFrom(md.UnverifiedBody)
+	return b.Bytes(), err
+}
@@ -7,13 +7,17 @@ package main
 // CGO_ENABLED=0 GOOS=windows GOARCH=amd64 go build -o email-sender-v0.0.2.exe .
 
 import (
-	"crypto/tls"
 	"fmt"
-	"github.com/jordan-wright/email"
+	"github.com/spf13/viper"
 	"github.com/xuri/excelize/v2"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/dkim"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/journal"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/pgp"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/transport"
+	"github.com/yuchunyu97/toolset-golang/pkg/utils/sizeutil"
 	"log"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -28,233 +32,437 @@ var (
 	AttachmentPath = "email-sender-attachments"
 )
 
+// 退出码
+const (
+	exitOK      = 0 // 全部发送成功
+	exitError   = 1 // 配置错误等，没有发送
+	exitFailed  = 2 // 有行处理失败或发送失败
+	exitAborted = 3 // 没有确认发送
+)
+
 func main() {
-	fmt.Printf("欢迎使用群发邮件小工具\nversion %s\nauthor %s\n\n", ToolVersion, ToolAuthor)
+	os.Exit(run())
+}
+
+// run 读取配置并发送邮件，返回退出码
+func run() int {
+	if outputFormat == outputJSON {
+		// JSON 输出到标准输出，其他提示信息输出到标准错误
+		out = os.Stderr
+	} else if outputFormat != outputText {
+		log.Printf("不支持的输出格式 %s", outputFormat)
+		return exitError
+	}
+	fmt.Fprintf(out, "欢迎使用群发邮件小工具\nversion %s\nauthor %s\n\n", ToolVersion, ToolAuthor)
+
+	// 加载 YAML 配置文件
+	if err := readConfigFile(); err != nil {
+		log.Printf("读取配置文件失败 %s", err)
+		waitForExit()
+		return exitError
+	}
+	AttachmentPath = viper.GetString("emailSender.attachmentsDir")
+	ConfigFile = viper.GetString("emailSender.excelFile")
 
-	AttachmentPath = filepath.Join("configs", AttachmentPath)
-	ConfigFile = filepath.Join("configs", ConfigFile)
 	f, err := excelize.OpenFile(ConfigFile)
 	if err != nil {
 		log.Printf("读取配置文件 %s 失败 %s", ConfigFile, err)
 		waitForExit()
-		return
+		return exitError
 	}
 
 	// https://github.com/qax-os/excelize
 	// 是否将邮件密送自己
 	// 因为通过 SMTP 发送的邮件已发送邮件中不会显示，开启后可以确定邮件是否正确发送
-	bccYourself := false
-	// 配置字段
-	var server, username, password, bccYourselfConfig string
-	if server, err = f.GetCellValue("email-config", "A2"); err != nil {
-		log.Printf("读取配置 server 失败，"+
-			"请将 server 信息写入 email-config Sheet 的 A2 单元格中，如 mail.exchange.com:587 %s", err)
-		waitForExit()
-		return
-	}
-	if username, err = f.GetCellValue("email-config", "B2"); err != nil {
-		log.Printf("读取配置 email 失败，"+
-			"请将 email 信息写入 email-config Sheet 的 B2 单元格中，如 username@exchange.com %s", err)
-		waitForExit()
-		return
-	}
-	if password, err = f.GetCellValue("email-config", "C2"); err != nil {
-		log.Printf("读取配置 password 失败，"+
-			"请将 password 信息写入 email-config Sheet 的 C2 单元格中 %s", err)
+	// 配置了 IMAP 时也可以使用 sentFolder 将发送成功的邮件保存到已发送邮件文件夹
+	cfg, err := loadConfig(f)
+	if err != nil {
+		log.Printf("%s", err)
 		waitForExit()
-		return
+		return exitError
 	}
-	if bccYourselfConfig, err = f.GetCellValue("email-config", "D2"); err == nil {
-		if bccYourselfConfig == "yes" {
-			bccYourself = true
+
+	// 将密码保存到系统钥匙串
+	if savePassword {
+		if err = savePasswordToKeyring(cfg.Username); err != nil {
+			log.Printf("%s", err)
+			return exitError
 		}
+		log.Printf("密码已保存到系统钥匙串")
+		return exitOK
 	}
 
-	serverInfo := strings.Split(server, ":")
-	if len(serverInfo) != 2 {
-		log.Printf("配置 server 格式错误，格式为 serverName:smtpPort，用冒号将服务器名和 SMTP 端口连接起来")
-		waitForExit()
-		return
+	// 预览模式不需要密码
+	if previewDir == "" {
+		if cfg.Password, err = loadPassword(f, cfg.Username); err != nil {
+			log.Printf("%s", err)
+			waitForExit()
+			return exitError
+		}
 	}
+	server, username, password, bccYourself := cfg.Server, cfg.Username, cfg.Password, cfg.BccYourself
 
 	passwordEnc := ""
 	for range password {
 		passwordEnc += "*"
 	}
-	log.Printf("配置信息：\n\tServer: %s\n\tUsername(Email): %s\n\tPassword: %s\n\tBCC Yourself: %v\n\n",
-		server, username, passwordEnc, bccYourself)
+	if cfg.Transport == transport.KindHTTP {
+		log.Printf("配置信息：\n\tTransport: HTTP\n\tURL: %s\n\tUsername(Email): %s\n\tPassword: %s\n\tBCC Yourself: %v\n\n",
+			cfg.HTTP.URL, username, passwordEnc, bccYourself)
+	} else {
+		log.Printf("配置信息：\n\tServer: %s\n\tSecurity: %s\n\tAuth: %s\n\tUsername(Email): %s\n\tPassword: %s\n\tBCC Yourself: %v\n\n",
+			server, cfg.Security, cfg.Auth, username, passwordEnc, bccYourself)
+	}
+
+	// DKIM 签名
+	signer, err := cfg.dkimSigner()
+	if err != nil {
+		log.Printf("%s", err)
+		waitForExit()
+		return exitError
+	}
+	if dkimRecord {
+		if signer == nil {
+			log.Printf("没有配置 DKIM 私钥")
+			return exitError
+		}
+		record, err := dkim.PublicKeyRecord(signer.Key)
+		if err != nil {
+			log.Printf("%s", err)
+			return exitError
+		}
+		fmt.Fprintf(out, "请添加 DNS TXT 记录\n名称：%s._domainkey.%s\n内容：%s\n", signer.Selector, signer.Domain, record)
+		return exitOK
+	}
+	if signer != nil {
+		log.Printf("使用 DKIM 签名 d=%s s=%s\n\n", signer.Domain, signer.Selector)
+	}
+
+	// PGP 公钥文件夹
+	var keyring *pgp.Keyring
+	if cfg.PGPKeyring != "" {
+		var warnings []error
+		if keyring, warnings, err = pgp.LoadKeyring(cfg.PGPKeyring); err != nil {
+			log.Printf("读取 PGP 公钥文件夹 %s 失败 %s", cfg.PGPKeyring, err)
+			waitForExit()
+			return exitError
+		}
+		for _, warning := range warnings {
+			log.Printf("读取 PGP 公钥失败，忽略 %s", warning)
+		}
+	}
+
+	// 退订名单，名单中的邮箱不发送
+	suppression, err := loadSuppression(f, cfg.SuppressionFile, cfg.SuppressionSheet)
+	if err != nil {
+		log.Printf("%s", err)
+		waitForExit()
+		return exitError
+	}
+	if len(suppression) > 0 {
+		log.Printf("退订名单中共有 %d 个邮箱，将从收件人和抄送人中移除\n\n", len(suppression))
+	}
 
 	// 读取待发送的邮件列表
 	rows, err := f.GetRows("email-list")
 	if err != nil {
 		log.Printf("获取待发送的邮件列表失败，请确保 Sheet email-list 存在 %s", err)
 		waitForExit()
-		return
+		return exitError
 	}
-	var emailToBeSendList []*email.Email
-	// 逐行处理
-	for idx := range rows {
-		if idx > 0 {
-			rowNum := idx + 1
-			log.Printf("开始处理 Excel email-list Sheet 第 %d 行\n", rowNum)
-
-			var cellEmailTo, cellEmailCc, cellEmailSubject, cellEmailHTML, cellEmailAttachments string
-			var cellErr error
-			cellEmailTo, cellErr = f.GetCellValue("email-list", fmt.Sprintf("A%d", rowNum))
-			cellEmailCc, cellErr = f.GetCellValue("email-list", fmt.Sprintf("B%d", rowNum))
-			cellEmailSubject, cellErr = f.GetCellValue("email-list", fmt.Sprintf("C%d", rowNum))
-			cellEmailHTML, cellErr = f.GetCellValue("email-list", fmt.Sprintf("D%d", rowNum))
-			cellEmailAttachments, cellErr = f.GetCellValue("email-list", fmt.Sprintf("E%d", rowNum))
-
-			if cellErr != nil {
-				log.Printf("发生错误，跳过 %s", cellErr)
-				continue
-			}
-
-			// 去除收件人和抄送人邮件两边的空格
-			cellEmailTo = strings.TrimSpace(cellEmailTo)
-			cellEmailCc = strings.TrimSpace(cellEmailCc)
-
-			// 初始化邮件
-			em := email.NewEmail()
-			em.From = username
+	// 第一行为标题行，检查退信和写入发送结果时需要使用
+	if len(rows) == 0 {
+		log.Printf("Sheet email-list 为空，第一行应为标题行")
+		waitForExit()
+		return exitError
+	}
+	var emailToBeSendList []*emailTask
+	var failedRows []rowError
+	templates := newTemplateCache()
+	tables := newTableBody(f, cfg.TableBody)
 
-			// * 收件人邮箱（用英文分号分隔）
-			emailTo := strings.Split(cellEmailTo, ";")
-			if len(emailTo) == 0 {
-				log.Printf("收件人邮箱必填，跳过")
-				continue
-			}
-			for _, v := range emailTo {
-				vv := strings.TrimSpace(v)
-				if vv != "" {
-					em.To = append(em.To, vv)
-				}
-			}
+	// 发送日志，记录每一行的发送状态
+	sendJournal, err := journal.Open(cfg.Journal)
+	if err != nil {
+		log.Printf("打开发送日志 %s 失败 %s", cfg.Journal, err)
+		waitForExit()
+		return exitError
+	}
+	defer func() { _ = sendJournal.Close() }()
+
+	// 检查退信，不发送
+	if checkBounces {
+		if err = checkRunBounces(f, rows[0], cfg, sendJournal, bounceRunID); err != nil {
+			log.Printf("检查退信失败 %s", err)
+			waitForExit()
+			return exitError
+		}
+		waitForExit()
+		return exitOK
+	}
+	skippedCount := 0
+	var suppressedRows []suppressedRow
 
-			// 抄送人邮箱（用英文分号分隔）
-			emailCc := strings.Split(cellEmailCc, ";")
-			if len(emailCc) > 0 {
-				for _, v := range emailCc {
-					vv := strings.TrimSpace(v)
-					if vv != "" {
-						em.Cc = append(em.Cc, vv)
-					}
-				}
-			}
+	// 逐行处理
+	for _, row := range parseRows(rows) {
+		log.Printf("开始处理 Excel email-list Sheet 第 %d 行\n", row.Num)
 
-			// 密送自己
-			if bccYourself {
-				em.Bcc = []string{username}
-			}
+		em, err := buildEmail(row, cfg, templates, tables)
+		if err != nil {
+			log.Printf("发生错误，跳过 %s", err)
+			failedRows = append(failedRows, rowError{Num: row.Num, Err: err})
+			continue
+		}
 
-			// * 邮件主题
-			if cellEmailSubject == "" {
-				log.Printf("邮件主题必填，跳过")
+		// 移除退订名单中的收件人，没有收件人时该行不发送
+		if removed := suppression.filter(em); len(removed) > 0 {
+			log.Printf("以下收件人在退订名单中，已移除 %s", strings.Join(removed, "、"))
+			suppressedRows = append(suppressedRows, suppressedRow{Row: row.Num, Addresses: removed, Skipped: len(em.To) == 0})
+			if len(em.To) == 0 {
+				log.Printf("所有收件人都在退订名单中，跳过")
 				continue
 			}
-			em.Subject = cellEmailSubject
+		}
+		if err = setListUnsubscribe(em, row, cfg); err != nil {
+			log.Printf("发生错误，跳过 %s", err)
+			failedRows = append(failedRows, rowError{Num: row.Num, Err: err})
+			continue
+		}
 
-			// * 邮件正文文件名（文件在当前目录下）
-			if cellEmailHTML == "" {
-				log.Printf("邮件正文文件名必填，跳过")
+		// 继续发送时，跳过发送日志中已经发送成功的邮件
+		// 发送结果未知的邮件可能已经发送，为避免重复发送，使用 --resend-unknown 时才重新发送
+		task := newEmailTask(row, em)
+		if resume {
+			if entry, ok := sendJournal.Sent(task.Key); ok {
+				log.Printf("该邮件已于 %s 发送成功，跳过", entry.Time.Format("2006-01-02 15:04:05"))
+				skippedCount++
 				continue
 			}
-			emailBody, err := os.ReadFile(cellEmailHTML)
-			if err != nil {
-				log.Printf("邮件正文读取失败，跳过 %s", err)
+			if entry, ok := sendJournal.Unknown(task.Key); ok && !resendUnknown {
+				err = fmt.Errorf("该邮件于 %s 发送结果未知，可能已经发送，确认收件人没有收到后使用 --resend-unknown 重新发送",
+					entry.Time.Format("2006-01-02 15:04:05"))
+				log.Printf("发生错误，跳过 %s", err)
+				failedRows = append(failedRows, rowError{Num: row.Num, Err: err})
 				continue
 			}
-			em.HTML = emailBody
-
-			// 邮件附件文件名（文件放在 email-sender-attachments 文件夹中，多个文件用英文逗号分隔）
-			if cellEmailAttachments != "" {
-				emailAttachmentsList := strings.Split(cellEmailAttachments, ",")
-				for _, attachFileName := range emailAttachmentsList {
-					attachFilePath := filepath.Join(AttachmentPath, attachFileName)
-					_, err = em.AttachFile(attachFilePath)
-					if err != nil {
-						log.Printf("添加邮件附件 %s 失败，跳过 %s", attachFilePath, err)
-						break
-					}
-				}
-				// 如果附件没有全部添加成功，则跳过
-				if len(emailAttachmentsList) != len(em.Attachments) {
-					continue
-				}
-			}
+		}
 
-			// 待发送邮件添加成功
-			log.Printf("待发送邮件添加成功")
-			emailToBeSendList = append(emailToBeSendList, em)
+		// 需要加密时查找所有收件人的公钥，没有公钥时不发送
+		if task.Encrypt, err = encryptRecipients(row, em, cfg, keyring); err != nil {
+			log.Printf("发生错误，跳过 %s", err)
+			failedRows = append(failedRows, rowError{Num: row.Num, Err: err})
+			continue
 		}
+
+		// 定时发送时间，行中的设置优先，其次为配置，继续发送时使用发送日志中记录的时间
+		if task.SendAt, err = sendAt(row, cfg, sendJournal, task.Key); err != nil {
+			log.Printf("发生错误，跳过 %s", err)
+			failedRows = append(failedRows, rowError{Num: row.Num, Err: err})
+			continue
+		}
+
+		// 待发送邮件添加成功
+		log.Printf("待发送邮件添加成功")
+		emailToBeSendList = append(emailToBeSendList, task)
 	}
 	log.Printf("--------------------\n\n")
 
+	if skippedCount > 0 {
+		log.Printf("发送日志中已发送成功 %d 封邮件，本次跳过\n\n", skippedCount)
+	}
+
+	// JSON 输出的内容
+	report := newReport(emailToBeSendList, failedRows, skippedCount)
+	report.Suppressed = suppressedRows
+
 	if len(emailToBeSendList) == 0 {
+		printFailedRows(failedRows)
+		printSuppressedRecipients(suppressedRows)
 		log.Printf("待发送邮件列表为空，退出")
-		return
+		return report.write(reportEmpty)
 	}
 
+	// 按定时发送时间排序，立即发送的邮件在前
+	sort.SliceStable(emailToBeSendList, func(i, j int) bool {
+		return emailToBeSendList[i].SendAt.Before(emailToBeSendList[j].SendAt)
+	})
+
 	// 打印出待发送的邮件列表，请用户确认是否发送
-	fmt.Printf("待发送邮件列表如下：\n\n")
-	for idx, emailInfo := range emailToBeSendList {
-		fmt.Printf("NO.%d\nSubject: %v\nAttatchments Count: %d\n",
-			idx+1, emailInfo.Subject, len(emailInfo.Attachments))
+	fmt.Fprintf(out, "待发送邮件列表如下：\n\n")
+	for idx, task := range emailToBeSendList {
+		emailInfo := task.Email
+		fmt.Fprintf(out, "NO.%d（第 %d 行）\nSubject: %v\nAttatchments Count: %d（%s）\n",
+			idx+1, task.Row.Num, emailInfo.Subject, len(emailInfo.Attachments), sizeutil.Format(attachmentsSize(emailInfo)))
 
 		for _, v := range emailInfo.To {
-			fmt.Println("To ->", v)
+			fmt.Fprintln(out, "To ->", displayAddress(v))
 		}
 		for _, v := range emailInfo.Cc {
-			fmt.Println("Cc ->", v)
+			fmt.Fprintln(out, "Cc ->", displayAddress(v))
 		}
 		for _, v := range emailInfo.Bcc {
-			fmt.Println("Bcc ->", v)
+			fmt.Fprintln(out, "Bcc ->", displayAddress(v))
+		}
+		for _, v := range emailInfo.Attachments {
+			fmt.Fprintf(out, "Attachment -> %s（%s）\n", v.Filename, sizeutil.Format(int64(len(v.Content))))
+		}
+		if !task.SendAt.IsZero() {
+			fmt.Fprintln(out, "Send At ->", task.SendAt.Format("2006-01-02 15:04"))
 		}
-		fmt.Println()
+		if len(task.Encrypt) > 0 {
+			fmt.Fprintln(out, "Encrypt -> PGP")
+		}
+		fmt.Fprintln(out)
 	}
 
-	var confirmSend string
-	fmt.Printf("请确认是否进行发送，发送（Y），不发送（N）：")
-	_, _ = fmt.Scanln(&confirmSend)
-	if strings.ToLower(confirmSend) != "y" {
-		log.Printf("不发送，退出")
-		return
+	printFailedRows(failedRows)
+	printSuppressedRecipients(suppressedRows)
+	printDuplicateRecipients(duplicateRecipients(emailToBeSendList))
+	if len(cfg.SendWindows) > 0 {
+		fmt.Fprintf(out, "只在以下时间段内发送：%s\n\n", strings.Join(viper.GetStringSlice("emailSender.sendWindows"), "、"))
+	}
+
+	// 预览模式，只生成 .eml 文件，不发送
+	if previewDir != "" {
+		if err = writePreview(previewDir, emailToBeSendList, signer); err != nil {
+			log.Printf("生成预览失败 %s", err)
+			waitForExit()
+			return exitError
+		}
+		log.Printf("%d 封邮件已保存到 %s 文件夹，可以使用邮件客户端打开预览", len(emailToBeSendList), previewDir)
+		report.PreviewDir = previewDir
+		return report.write(reportPreview)
+	}
+
+	// 使用 --yes 时不需要确认，用于无人值守运行
+	if assumeYes {
+		log.Printf("已使用 --yes 确认发送")
+	} else {
+		var confirmSend string
+		fmt.Fprintf(out, "请确认是否进行发送，发送（Y），不发送（N）：")
+		_, _ = fmt.Scanln(&confirmSend)
+		if strings.ToLower(confirmSend) != "y" {
+			log.Printf("不发送，退出")
+			return report.write(reportAborted)
+		}
 	}
 
 	// 开始发送邮件
 	// 使用 GOLANG 发送邮件 https://segmentfault.com/a/1190000040310170
 	log.Printf("开始发送邮件")
 
-	//设置服务器相关的配置
-	auth := LoginAuth(username, password)
-	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	//设置服务器相关的配置，通过 SMTP 或 HTTP 邮件 API 发送
+	client, err := cfg.newTransport()
+	if err != nil {
+		log.Printf("%s 配置错误 %s", strings.ToUpper(cfg.Transport), err)
+		waitForExit()
+		return exitError
+	}
+	defer func() { _ = client.Close() }()
+	// 防止发送过于频繁被限流
+	limiter := transport.NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+
+	// 发送成功的邮件保存到 IMAP 已发送邮件文件夹，开始发送前连接，配置错误时不发送
+	var sent *sentFolder
+	if cfg.IMAP.SentFolder != "" {
+		if cfg.IMAP.Server == "" {
+			log.Printf("没有配置 IMAP 服务器，无法保存已发送邮件，请在配置文件中设置 emailSender.imap.server 或使用 --imap-server")
+			waitForExit()
+			return exitError
+		}
+		if sent, err = openSentFolder(cfg.imapConfig(), cfg.IMAP.SentFolder); err != nil {
+			log.Printf("%s", err)
+			waitForExit()
+			return exitError
+		}
+		defer func() { _ = sent.Close() }()
+		log.Printf("发送成功的邮件将保存到 IMAP 文件夹 %s", cfg.IMAP.SentFolder)
+	}
+
+	// 临时错误（SMTP 4xx 错误码、HTTP 429 和 5xx 状态码、网络错误）按指数退避重试
+	backoff := transport.Backoff{Retries: cfg.Retries, Delay: cfg.RetryDelay, Max: 10 * time.Minute}
+	runID := time.Now().Format("20060102150405")
+	report.RunID = runID
+
+	// 发送结果，处理失败的行也写入
+	var results []journal.Entry
+	for _, rowErr := range failedRows {
+		results = append(results, journal.Entry{
+			Row:    rowErr.Num,
+			Status: journal.StatusFailed,
+			Error:  rowErr.Err.Error(),
+			Time:   time.Now(),
+		})
+	}
+
+	// 记录定时发送的邮件，程序中断后使用 --resume 重新运行时按原定时间发送
+	scheduleTasks(sendJournal, runID, emailToBeSendList)
 
 	successSendCount := 0
-	for idx, emailInfo := range emailToBeSendList {
-		log.Printf("正在发送第 %d 封邮件给 %s ：%s（%d 个附件）\n",
-			idx+1, emailInfo.To, emailInfo.Subject, len(emailInfo.Attachments))
+	for idx, task := range emailToBeSendList {
+		emailInfo := task.Email
 
-		// 防止发送过于频繁被限流，暂停 5s
-		time.Sleep(time.Second * 5)
+		// 等待到定时发送时间，并且在发送时间段内
+		waitToSend(task, cfg.SendWindows, client)
 
-		err = emailInfo.SendWithStartTLS(server, auth, tlsConfig)
+		log.Printf("正在发送第 %d 封邮件给 %s ：%s（%d 个附件）\n",
+			idx+1, displayAddressList(emailInfo.To), emailInfo.Subject, len(emailInfo.Attachments))
+
+		limiter.Wait()
+
+		var msg []byte
+		attempts, err := backoff.Retry(func() (err error) {
+			msg, err = sendEmail(client, task, signer)
+			return err
+		}, func(attempt int, wait time.Duration, err error) {
+			log.Printf("发送失败 %s，%s 后进行第 %d 次重试\n", err, wait, attempt)
+		})
+
+		entry := task.journalEntry(runID, attempts, err)
+		results = append(results, entry)
+		if journalErr := sendJournal.Append(entry); journalErr != nil {
+			log.Printf("写入发送日志失败 %s", journalErr)
+		}
 		if err != nil {
 			log.Printf("发送失败 %s\n", err)
 			continue
 		}
 
-		log.Printf("发送成功\n")
+		log.Printf("发送成功 Message-ID: %s\n", entry.MessageID)
 		successSendCount += 1
+
+		// 保存失败不影响发送结果
+		if sent != nil {
+			if err = sent.Save(msg, entry.Time); err != nil {
+				log.Printf("保存已发送邮件失败 %s\n", err)
+			}
+		}
 	}
 
 	log.Printf("\n\n发送成功 %d 封邮件，失败 %d 封邮件\n\n", successSendCount, len(emailToBeSendList)-successSendCount)
+	log.Printf("发送记录已写入发送日志 %s，使用 --resume 重新运行可以跳过已发送成功的邮件\n\n", sendJournal.Path())
+
+	// 发送结果写回 email-list Sheet
+	if err = writeResults(f, rows[0], results); err != nil {
+		log.Printf("写入发送结果失败 %s", err)
+	} else if resultFile, err := saveResults(f, cfg.ResultFile); err != nil {
+		log.Printf("保存发送结果失败 %s", err)
+	} else {
+		log.Printf("发送结果已写入 %s email-list Sheet\n\n", resultFile)
+	}
 
-	fmt.Printf("按任意键退出")
-	_, _ = fmt.Scanln()
+	// 处理失败的行已经在 FailedRows 中
+	report.Results = results[len(failedRows):]
+	code := report.write(reportSent)
+	waitForExit()
+	return code
 }
 
+// waitForExit 等待用户按键后退出，使用 --yes 时不等待
 func waitForExit() {
-	fmt.Printf("按任意键退出")
+	if assumeYes {
+		return
+	}
+	fmt.Fprintf(out, "按任意键退出")
 	_, _ = fmt.Scanln()
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/xuri/excelize/v2"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/smtpsink"
+)
+
+// testBody 测试使用的正文模板
+const testBody = "<p>{{.姓名}}，您本月的基本工资为 10000 元</p>"
+
+// testEnv 端到端运行 run() 的测试环境：临时文件夹中的 Excel 和正文文件，以及测试用 SMTP 服务器
+// 配置通过 viper.Set 设置，测试结束后清除
+type testEnv struct {
+	t     *testing.T
+	dir   string
+	excel string
+	body  string
+	sink  *smtpsink.Server
+}
+
+// newTestEnv 创建测试环境，rows 为 email-list Sheet 中标题行之后的行，正文列为空时使用 testBody
+func newTestEnv(t *testing.T, titles []string, rows ...[]string) *testEnv {
+	t.Helper()
+	dir := t.TempDir()
+	// 不读取用户的配置文件
+	t.Setenv("HOME", dir)
+	e := &testEnv{t: t, dir: dir, excel: filepath.Join(dir, "email.xlsx"), body: filepath.Join(dir, "body.html")}
+	if err := os.WriteFile(e.body, []byte(testBody), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "email-list")
+	if err := f.SetSheetRow("email-list", "A1", &titles); err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		row := append([]string(nil), row...)
+		if len(row) > colHTML && row[colHTML] == "" {
+			row[colHTML] = e.body
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := f.SetSheetRow("email-list", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SaveAs(e.excel); err != nil {
+		t.Fatal(err)
+	}
+
+	e.sink = &smtpsink.Server{}
+	if err := e.sink.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = e.sink.Close() })
+
+	e.set("emailSender.excelFile", e.excel)
+	e.set("emailSender.attachmentsDir", dir)
+	e.set("emailSender.server", e.sink.Addr)
+	e.set("emailSender.security", "none")
+	e.set("emailSender.auth", "none")
+	e.set("emailSender.username", "hr@example.com")
+	e.set("emailSender.password", "secret")
+	e.set("emailSender.rateLimit", 0)
+	e.set("emailSender.retries", 0)
+
+	// 不需要确认，也不等待按键退出
+	oldYes, oldOut := assumeYes, out
+	assumeYes, out = true, io.Discard
+	t.Cleanup(func() { assumeYes, out = oldYes, oldOut })
+	return e
+}
+
+// set 设置配置，测试结束后清除
+func (e *testEnv) set(key string, value interface{}) {
+	viper.Set(key, value)
+	e.t.Cleanup(func() { viper.Set(key, nil) })
+}
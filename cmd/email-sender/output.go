@@ -0,0 +1,126 @@
+package main
+
+// 输出
+// 默认输出便于阅读的文本，--output json 时在最后将待发送的邮件和发送结果以 JSON 格式输出到标准输出，便于脚本和 CI 处理
+
+import (
+	"encoding/json"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/journal"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// 输出格式
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// out 提示信息和待发送邮件列表的输出位置，JSON 输出时为标准错误
+var out io.Writer = os.Stdout
+
+// 运行结果
+const (
+	reportEmpty   = "empty"   // 没有待发送的邮件
+	reportPreview = "preview" // 预览模式，没有发送
+	reportAborted = "aborted" // 没有确认发送
+	reportSent    = "sent"    // 已发送
+)
+
+// plannedEmail 待发送的邮件
+type plannedEmail struct {
+	Row         int        `json:"row"`
+	Key         string     `json:"key"`
+	From        string     `json:"from"`
+	To          []string   `json:"to"`
+	Cc          []string   `json:"cc,omitempty"`
+	Bcc         []string   `json:"bcc,omitempty"`
+	Subject     string     `json:"subject"`
+	Attachments []string   `json:"attachments,omitempty"`
+	SendAt      *time.Time `json:"sendAt,omitempty"`
+	Encrypt     bool       `json:"encrypt,omitempty"`
+}
+
+// failedRow 处理失败的行
+type failedRow struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// runReport 一次运行的结果
+type runReport struct {
+	Status     string          `json:"status"`
+	RunID      string          `json:"runId,omitempty"`
+	PreviewDir string          `json:"previewDir,omitempty"`
+	Planned    []plannedEmail  `json:"planned"`
+	FailedRows []failedRow     `json:"failedRows"`
+	Skipped    int             `json:"skipped"`              // --resume 跳过的已发送成功的行
+	Suppressed []suppressedRow `json:"suppressed,omitempty"` // 有收件人在退订名单中的行
+	Results    []journal.Entry `json:"results,omitempty"`    // 每封邮件的发送结果
+	Sent       int             `json:"sent"`
+	Failed     int             `json:"failed"`
+}
+
+func newReport(tasks []*emailTask, failedRows []rowError, skipped int) *runReport {
+	r := &runReport{Planned: []plannedEmail{}, FailedRows: []failedRow{}, Skipped: skipped}
+	for _, task := range tasks {
+		em := task.Email
+		p := plannedEmail{
+			Row:     task.Row.Num,
+			Key:     task.Key,
+			From:    displayAddress(em.From),
+			To:      displayAddressList(em.To),
+			Cc:      displayAddressList(em.Cc),
+			Bcc:     displayAddressList(em.Bcc),
+			Subject: em.Subject,
+			Encrypt: len(task.Encrypt) > 0,
+		}
+		for _, a := range em.Attachments {
+			if !a.HTMLRelated {
+				p.Attachments = append(p.Attachments, a.Filename)
+			}
+		}
+		if !task.SendAt.IsZero() {
+			sendAt := task.SendAt
+			p.SendAt = &sendAt
+		}
+		r.Planned = append(r.Planned, p)
+	}
+	for _, rowErr := range failedRows {
+		r.FailedRows = append(r.FailedRows, failedRow{Row: rowErr.Num, Error: rowErr.Err.Error()})
+	}
+	return r
+}
+
+// write 输出 JSON（--output json 时），返回退出码
+func (r *runReport) write(status string) int {
+	r.Status = status
+	for _, entry := range r.Results {
+		switch entry.Status {
+		case journal.StatusSent:
+			r.Sent++
+		case journal.StatusFailed, journal.StatusUnknown:
+			r.Failed++
+		}
+	}
+
+	if outputFormat == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(r); err != nil {
+			log.Printf("输出 JSON 失败 %s", err)
+			return exitError
+		}
+	}
+
+	switch {
+	case status == reportAborted:
+		return exitAborted
+	case len(r.FailedRows) > 0 || r.Failed > 0:
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,105 @@
+package main
+
+// 发送结果写回 email-list Sheet
+// 在标题行最后追加发送状态、发送时间、错误信息和 Message-ID 列，已有这些列时覆盖，发送失败和退信的行标红
+
+import (
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/journal"
+	"path/filepath"
+	"strings"
+)
+
+// 发送结果列的标题
+const (
+	resultHeaderStatus    = "发送状态"
+	resultHeaderTime      = "发送时间"
+	resultHeaderError     = "错误信息"
+	resultHeaderMessageID = "Message-ID"
+)
+
+var resultHeaders = []string{resultHeaderStatus, resultHeaderTime, resultHeaderError, resultHeaderMessageID}
+
+// 发送状态在 Excel 中显示的内容，方便筛选
+var resultStatusText = map[journal.Status]string{
+	journal.StatusSent:    "成功",
+	journal.StatusFailed:  "失败",
+	journal.StatusBounced: "退信",
+	journal.StatusUnknown: "未知",
+}
+
+// writeResults 将发送结果写入 email-list Sheet，headRow 为标题行
+// results 中没有的行（如 --resume 跳过的行）保留原来的内容
+func writeResults(f *excelize.File, headRow []string, results []journal.Entry) error {
+	const sheet = "email-list"
+
+	// 查找已有的结果列，没有时追加到最后
+	cols := make(map[string]int, len(resultHeaders))
+	next := len(headRow) + 1
+	for _, header := range resultHeaders {
+		for i, title := range headRow {
+			if strings.TrimSpace(title) == header {
+				cols[header] = i + 1
+				break
+			}
+		}
+		if cols[header] == 0 {
+			cols[header] = next
+			next++
+			cell, _ := excelize.CoordinatesToCellName(cols[header], 1)
+			if err := f.SetCellValue(sheet, cell, header); err != nil {
+				return err
+			}
+		}
+	}
+
+	failedStyle, err := f.NewStyle(&excelize.Style{
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"#FFC7CE"}, Pattern: 1},
+		Font: &excelize.Font{Color: "#9C0006"},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range results {
+		values := map[string]interface{}{
+			resultHeaderStatus:    resultStatusText[entry.Status],
+			resultHeaderTime:      entry.Time.Format("2006-01-02 15:04:05"),
+			resultHeaderError:     entry.Error,
+			resultHeaderMessageID: entry.MessageID,
+		}
+		style := 0
+		if entry.Status != journal.StatusSent {
+			style = failedStyle
+		}
+		for _, header := range resultHeaders {
+			cell, _ := excelize.CoordinatesToCellName(cols[header], entry.Row)
+			if err = f.SetCellValue(sheet, cell, values[header]); err != nil {
+				return err
+			}
+			if err = f.SetCellStyle(sheet, cell, cell, style); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveResults 保存发送结果，resultFile 为空时写回原文件，原文件无法写入（如正在被 Excel 打开）时另存为副本，返回保存的文件
+func saveResults(f *excelize.File, resultFile string) (string, error) {
+	if resultFile != "" {
+		return resultFile, f.SaveAs(resultFile)
+	}
+	path := f.Path
+	err := f.Save()
+	if err == nil {
+		return path, nil
+	}
+	ext := filepath.Ext(path)
+	resultFile = strings.TrimSuffix(path, ext) + "-result" + ext
+	if saveErr := f.SaveAs(resultFile); saveErr != nil {
+		return "", fmt.Errorf("写入 %s 失败 %s，另存为 %s 失败 %s", path, err, resultFile, saveErr)
+	}
+	return resultFile, nil
+}
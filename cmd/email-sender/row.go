@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jordan-wright/email"
+	"github.com/yuchunyu97/toolset-golang/pkg/utils/sliceutil"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// email-list Sheet 中固定列的位置，其余的列作为模板变量
+const (
+	colTo = iota
+	colCc
+	colSubject
+	colHTML
+	colAttachments
+)
+
+// emailRow email-list Sheet 中的一行
+type emailRow struct {
+	Num         int // Excel 行号
+	To          string
+	Cc          string
+	Subject     string
+	HTML        string
+	Attachments string
+	// Vars 模板变量，列标题 -> 单元格内容，包括所有列
+	Vars map[string]string
+
+	// 可选列，标题为 发件人名称（From-Name）、回复地址（Reply-To），以及标题以 X- 开头的自定义邮件头，为空时使用配置
+	FromName string
+	ReplyTo  string
+	Headers  map[string]string
+	// SendAt 定时发送时间，列标题为 定时发送（Send-At），为空时立即发送
+	SendAt string
+	// Encrypt 是否进行 PGP 加密，列标题为 加密（Encrypt），为空时使用配置
+	Encrypt string
+}
+
+// 可选列的标题
+var (
+	fromNameTitles = []string{"发件人名称", "From-Name"}
+	replyToTitles  = []string{"回复地址", "Reply-To"}
+	sendAtTitles   = []string{"定时发送", "Send-At"}
+	encryptTitles  = []string{"加密", "Encrypt"}
+)
+
+// rowError 处理失败的行，在待发送邮件列表中展示
+type rowError struct {
+	Num int
+	Err error
+}
+
+// printFailedRows 打印处理失败的行，这些行不会发送，需要修改后重新发送
+func printFailedRows(failedRows []rowError) {
+	if len(failedRows) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "以下 %d 行处理失败，不会发送：\n\n", len(failedRows))
+	for _, rowErr := range failedRows {
+		fmt.Fprintf(out, "第 %d 行：%s\n", rowErr.Num, rowErr.Err)
+	}
+	fmt.Fprintln(out)
+}
+
+// parseRows 解析 email-list Sheet，第一行为标题行
+func parseRows(rows [][]string) []emailRow {
+	if len(rows) == 0 {
+		return nil
+	}
+	headRow := rows[0]
+
+	var result []emailRow
+	for idx, row := range rows[1:] {
+		cell := func(i int) string {
+			if i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+
+		// 跳过空行
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+
+		r := emailRow{
+			Num:         idx + 2,
+			To:          cell(colTo),
+			Cc:          cell(colCc),
+			Subject:     cell(colSubject),
+			HTML:        cell(colHTML),
+			Attachments: cell(colAttachments),
+			Vars:        make(map[string]string, len(headRow)),
+			Headers:     map[string]string{},
+		}
+		for i, title := range headRow {
+			title = strings.TrimSpace(title)
+			if title == "" {
+				continue
+			}
+			value := strings.TrimSpace(cell(i))
+			r.Vars[title] = cell(i)
+			switch {
+			case sliceutil.HasString(fromNameTitles, title):
+				r.FromName = value
+			case sliceutil.HasString(replyToTitles, title):
+				r.ReplyTo = value
+			case sliceutil.HasString(sendAtTitles, title):
+				r.SendAt = value
+			case sliceutil.HasString(encryptTitles, title):
+				r.Encrypt = value
+			case strings.HasPrefix(strings.ToUpper(title), "X-") && value != "":
+				r.Headers[title] = value
+			}
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// buildEmail 根据一行内容和配置生成待发送的邮件
+func buildEmail(row emailRow, cfg *Config, templates *templateCache, tables *tableBody) (*email.Email, error) {
+	// 初始化邮件
+	em := email.NewEmail()
+	em.From = cfg.Username
+
+	// 发件人名称，如 人力资源部 <hr@example.com>
+	fromName := cfg.FromName
+	if row.FromName != "" {
+		fromName = row.FromName
+	}
+	if fromName != "" {
+		em.From = formatAddress(&mail.Address{Name: fromName, Address: cfg.Username})
+	}
+
+	// * 收件人邮箱（多个邮箱用逗号或分号分隔），重复的邮箱只保留一个
+	to, err := parseAddressList(row.To)
+	if err != nil {
+		return nil, fmt.Errorf("收件人%s", err)
+	}
+	if len(to) == 0 {
+		return nil, errors.New("收件人邮箱必填")
+	}
+	em.To = to
+
+	// 抄送人邮箱（多个邮箱用逗号或分号分隔），已经在收件人中的邮箱不再抄送
+	if em.Cc, err = parseAddressList(row.Cc, em.To...); err != nil {
+		return nil, fmt.Errorf("抄送人%s", err)
+	}
+
+	// 密送自己
+	if cfg.BccYourself {
+		em.Bcc = []string{cfg.Username}
+	}
+
+	// 回复地址
+	replyTo := cfg.ReplyTo
+	if row.ReplyTo != "" {
+		replyTo = row.ReplyTo
+	}
+	if em.ReplyTo, err = parseAddressList(replyTo); err != nil {
+		return nil, fmt.Errorf("回复地址%s", err)
+	}
+
+	// 自定义邮件头，行中的设置覆盖配置
+	for _, headers := range []map[string]string{cfg.Headers, row.Headers} {
+		for key, value := range headers {
+			if err = setHeader(em, key, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// * 邮件主题，可以使用模板变量
+	if row.Subject == "" {
+		return nil, errors.New("邮件主题必填")
+	}
+	subject, err := renderText("subject", row.Subject, row.Vars)
+	if err != nil {
+		return nil, fmt.Errorf("邮件主题模板错误 %s", err)
+	}
+	em.Subject = subject
+
+	// * 邮件正文文件名（文件在当前目录下），文件内容为 html/template 模板
+	// 为 @table 时将数据工作簿中对应的一行渲染为表格作为正文
+	if row.HTML == "" {
+		return nil, errors.New("邮件正文文件名必填")
+	}
+	if isTableBody(row.HTML) {
+		if em.HTML, err = tables.render(row, row.HTML); err != nil {
+			return nil, err
+		}
+	} else {
+		body, err := templates.render(row.HTML, row.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("邮件正文模板错误 %s", err)
+		}
+		// 正文中引用的本地图片作为内嵌附件发送
+		if em.HTML, err = embedImages(em, body, row.HTML); err != nil {
+			return nil, err
+		}
+	}
+	// 自动生成纯文本正文
+	em.Text = htmlToText(em.HTML)
+
+	// 邮件附件文件名（文件放在 email-sender-attachments 文件夹中，多个文件用英文逗号分隔）
+	// 支持模板变量、文件夹和通配符，如 result_*/{{.姓名}}*.xlsx
+	files, err := resolveAttachments(row.Attachments, row.Vars)
+	if err != nil {
+		return nil, err
+	}
+	if err = attachFiles(em, files, cfg, row.Vars); err != nil {
+		return nil, err
+	}
+
+	return em, nil
+}
+
+// 不允许通过自定义邮件头修改的邮件头
+var reservedHeaders = []string{
+	"From", "To", "Cc", "Bcc", "Subject", "Reply-To", "Date", "Message-Id",
+	"Mime-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// setHeader 设置自定义邮件头
+func setHeader(em *email.Email, key, value string) error {
+	key = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key))
+	if key == "" || strings.ContainsAny(key, " :\r\n") || sliceutil.HasString(reservedHeaders, key) {
+		return fmt.Errorf("不支持自定义邮件头 %q", key)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("邮件头 %s 的内容不能包含换行", key)
+	}
+	em.Headers.Set(key, value)
+	return nil
+}
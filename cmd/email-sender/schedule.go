@@ -0,0 +1,74 @@
+package main
+
+// 定时发送和发送时间段
+
+import (
+	"fmt"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/journal"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/schedule"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/transport"
+	"log"
+	"time"
+)
+
+// sendAt 计算一行的定时发送时间，使用 --resume 继续发送时优先使用发送日志中记录的时间（上次运行确认发送后中断），
+// 09:00 等相对时间不会按本次运行的时间重新计算，已经过了记录的时间时立即发送；
+// 其次为行中的 定时发送 列和配置 sendAt，返回零值时立即发送
+func sendAt(row emailRow, cfg *Config, j *journal.Journal, key string) (time.Time, error) {
+	if resume {
+		if entry, ok := j.Scheduled(key); ok && entry.SendAt != nil {
+			return *entry.SendAt, nil
+		}
+	}
+	if row.SendAt != "" {
+		t, err := schedule.ParseTime(row.SendAt, time.Now())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("定时发送%s", err)
+		}
+		return t, nil
+	}
+	return cfg.SendAt, nil
+}
+
+// scheduleTasks 将定时发送的邮件写入发送日志
+func scheduleTasks(j *journal.Journal, runID string, tasks []*emailTask) {
+	now := time.Now()
+	for _, task := range tasks {
+		if !task.SendAt.After(now) {
+			continue
+		}
+		sendAt := task.SendAt
+		entry := journal.Entry{
+			RunID:   runID,
+			Row:     task.Row.Num,
+			Key:     task.Key,
+			To:      task.Email.To,
+			Subject: task.Email.Subject,
+			Status:  journal.StatusScheduled,
+			SendAt:  &sendAt,
+		}
+		if err := j.Append(entry); err != nil {
+			log.Printf("写入发送日志失败 %s", err)
+		}
+	}
+}
+
+// waitToSend 等待到邮件的定时发送时间，并且在发送时间段内
+// 等待时间较长时先断开连接，发送时重新连接
+func waitToSend(task *emailTask, windows []schedule.Window, client transport.Transport) {
+	now := time.Now()
+	at := now
+	if task.SendAt.After(at) {
+		at = task.SendAt
+	}
+	at = schedule.Next(at, windows)
+	wait := at.Sub(now)
+	if wait <= 0 {
+		return
+	}
+	log.Printf("等待到 %s 发送（%s）", at.Format("2006-01-02 15:04:05"), wait.Round(time.Second))
+	if wait > time.Minute {
+		_ = client.Close()
+	}
+	time.Sleep(wait)
+}
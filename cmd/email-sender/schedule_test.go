@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/journal"
+)
+
+// TestSendAtResume 继续发送时优先使用发送日志中记录的定时发送时间
+func TestSendAtResume(t *testing.T) {
+	oldResume := resume
+	defer func() { resume = oldResume }()
+
+	j, err := journal.Open(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = j.Close() }()
+	// 上次运行记录的时间已经过了，也不按本次运行的时间重新计算 09:00
+	journaled := time.Now().Add(-time.Hour).Truncate(time.Second)
+	scheduled := func(key string) {
+		if err := j.Append(journal.Entry{Key: key, Status: journal.StatusScheduled, SendAt: &journaled}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scheduled("a")
+	scheduled("b")
+	if err = j.Append(journal.Entry{Key: "b", Status: journal.StatusSent}); err != nil {
+		t.Fatal(err)
+	}
+
+	configured := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	cfg := &Config{SendAt: configured}
+	rowAt, err := sendAt(emailRow{SendAt: "09:00"}, cfg, j, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		resume bool
+		row    emailRow
+		key    string
+		want   time.Time
+	}{
+		{"resume", true, emailRow{SendAt: "09:00"}, "a", journaled},
+		{"resume without row time", true, emailRow{}, "a", journaled},
+		{"no resume", false, emailRow{SendAt: "09:00"}, "a", rowAt},
+		{"resume already sent", true, emailRow{SendAt: "09:00"}, "b", rowAt},
+		{"resume not journaled", true, emailRow{SendAt: "09:00"}, "c", rowAt},
+		{"config", true, emailRow{}, "c", configured},
+	}
+	for _, tt := range tests {
+		resume = tt.resume
+		got, err := sendAt(tt.row, cfg, j, tt.key)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: sendAt = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err = sendAt(emailRow{SendAt: "明天"}, cfg, j, "c"); err == nil {
+		t.Error("invalid send time accepted")
+	}
+}
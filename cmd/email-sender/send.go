@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/jordan-wright/email"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/dkim"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/journal"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/pgp"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/transport"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// envelope 获取邮件的发件人邮箱和所有收件人（包括抄送和密送）邮箱
+func envelope(em *email.Email) (from string, to []string, err error) {
+	sender, err := mail.ParseAddress(em.From)
+	if err != nil {
+		return "", nil, fmt.Errorf("发件人邮箱 %s 格式错误 %s", em.From, err)
+	}
+	for _, list := range [][]string{em.To, em.Cc, em.Bcc} {
+		for _, v := range list {
+			addr, err := mail.ParseAddress(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("收件人邮箱 %s 格式错误 %s", v, err)
+			}
+			to = append(to, addr.Address)
+		}
+	}
+	return sender.Address, to, nil
+}
+
+// sendEmail 发送邮件，返回发送的邮件内容，邮件没有 Message-ID 时生成，重试时使用同一个 Message-ID
+// signer 不为空时对邮件进行 DKIM 签名
+func sendEmail(client transport.Transport, task *emailTask, signer *dkim.Signer) ([]byte, error) {
+	from, to, err := envelope(task.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err = setMessageID(task.Email, from); err != nil {
+		return nil, err
+	}
+	msg, err := messageBytes(task, signer)
+	if err != nil {
+		return nil, err
+	}
+	return msg, client.Send(from, to, msg)
+}
+
+// messageBytes 生成完整的邮件内容，需要加密时先进行 PGP 加密，signer 不为空时再进行 DKIM 签名
+func messageBytes(task *emailTask, signer *dkim.Signer) ([]byte, error) {
+	msg, err := task.Email.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(task.Encrypt) > 0 {
+		if msg, err = pgp.Encrypt(msg, task.Encrypt); err != nil {
+			return nil, fmt.Errorf("PGP 加密失败 %s", err)
+		}
+	}
+	if signer != nil {
+		if msg, err = signer.Sign(msg); err != nil {
+			return nil, fmt.Errorf("DKIM 签名失败 %s", err)
+		}
+	}
+	return msg, nil
+}
+
+// setMessageID 邮件没有 Message-ID 时生成
+func setMessageID(em *email.Email, from string) error {
+	if em.Headers.Get("Message-Id") != "" {
+		return nil
+	}
+	id, err := generateMessageID(from)
+	if err != nil {
+		return err
+	}
+	em.Headers.Set("Message-Id", id)
+	return nil
+}
+
+// writePreview 将待发送的邮件保存为 .eml 文件，不发送，可以用邮件客户端打开预览
+func writePreview(dir string, tasks []*emailTask, signer *dkim.Signer) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for idx, task := range tasks {
+		from, _, err := envelope(task.Email)
+		if err != nil {
+			return fmt.Errorf("第 %d 行：%s", task.Row.Num, err)
+		}
+		if err = setMessageID(task.Email, from); err != nil {
+			return err
+		}
+		msg, err := messageBytes(task, signer)
+		if err != nil {
+			return fmt.Errorf("第 %d 行：%s", task.Row.Num, err)
+		}
+		name := filepath.Join(dir, fmt.Sprintf("%03d-row%d.eml", idx+1, task.Row.Num))
+		if err = os.WriteFile(name, msg, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emailTask 待发送的邮件
+type emailTask struct {
+	Row   emailRow
+	Email *email.Email
+	// Key 邮件的标识，由收件人、主题、正文文件、渲染后的正文和附件生成，用于在发送日志中查找该邮件是否已经发送过
+	// 包含渲染后的正文，收件人和主题相同但模板变量不同的行不会被当成同一封邮件
+	Key string
+	// SendAt 定时发送时间，为零值时立即发送
+	SendAt time.Time
+	// Encrypt 使用这些公钥进行 PGP 加密，为空时不加密
+	Encrypt openpgp.EntityList
+}
+
+func newEmailTask(row emailRow, em *email.Email) *emailTask {
+	h := sha256.New()
+	for _, v := range [][]string{em.To, em.Cc, {em.Subject, row.HTML, row.Attachments}} {
+		fmt.Fprintf(h, "%q\n", v)
+	}
+	body := sha256.New()
+	body.Write(em.HTML)
+	body.Write([]byte{0})
+	body.Write(em.Text)
+	fmt.Fprintf(h, "%x\n", body.Sum(nil))
+	return &emailTask{Row: row, Email: em, Key: hex.EncodeToString(h.Sum(nil))[:32]}
+}
+
+// journalEntry 生成发送日志记录
+func (t *emailTask) journalEntry(runID string, attempts int, err error) journal.Entry {
+	entry := journal.Entry{
+		RunID:     runID,
+		Row:       t.Row.Num,
+		Key:       t.Key,
+		To:        t.Email.To,
+		Subject:   t.Email.Subject,
+		Status:    journal.StatusSent,
+		MessageID: t.Email.Headers.Get("Message-Id"),
+		Attempts:  attempts,
+		Time:      time.Now(),
+	}
+	if err != nil {
+		entry.Status = journal.StatusFailed
+		if transport.IsUnknown(err) {
+			entry.Status = journal.StatusUnknown
+		}
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// generateMessageID 生成 Message-ID，格式为 <时间戳.随机数@发件人域名>
+func generateMessageID(from string) (string, error) {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jordan-wright/email"
+)
+
+func TestEmailTaskKey(t *testing.T) {
+	row := emailRow{Num: 2, HTML: "body.html"}
+	newEmail := func(html string) *email.Email {
+		return &email.Email{To: []string{"zhangsan@example.com"}, Subject: "工资条", HTML: []byte(html)}
+	}
+	key := newEmailTask(row, newEmail("<p>张三，10000</p>")).Key
+
+	if got := newEmailTask(emailRow{Num: 3, HTML: "body.html"}, newEmail("<p>张三，10000</p>")).Key; got != key {
+		t.Errorf("same email in another row: key = %s, want %s", got, key)
+	}
+	// 收件人、主题相同，模板渲染后的正文不同时不是同一封邮件
+	if got := newEmailTask(row, newEmail("<p>张三，12000</p>")).Key; got == key {
+		t.Error("different body has the same key")
+	}
+	text := newEmail("<p>张三，10000</p>")
+	text.Text = []byte("张三，10000")
+	if got := newEmailTask(row, text).Key; got == key {
+		t.Error("different text body has the same key")
+	}
+}
+
+// TestResumeBodyChanged 继续发送时，正文文件修改后重新发送，没有修改时跳过
+func TestResumeBodyChanged(t *testing.T) {
+	titles := []string{"收件人", "抄送", "主题", "正文", "附件", "姓名"}
+	e := newTestEnv(t, titles, []string{"zhangsan@example.com", "", "工资条", "", "", "张三"})
+	oldResume := resume
+	resume = true
+	defer func() { resume = oldResume }()
+
+	steps := []struct {
+		name string
+		body string // 为空时不修改正文
+		sent int    // 累计收到的邮件数
+	}{
+		{"first run", "", 1},
+		{"unchanged", "", 1},
+		{"body changed", "<p>{{.姓名}}，您本月的基本工资为 12000 元</p>", 2},
+		{"unchanged again", "", 2},
+	}
+	for _, step := range steps {
+		if step.body != "" {
+			if err := os.WriteFile(e.body, []byte(step.body), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if code := run(); code != exitOK {
+			t.Fatalf("%s: exit code = %d", step.name, code)
+		}
+		if n := len(e.sink.Messages()); n != step.sent {
+			t.Fatalf("%s: received %d messages, want %d", step.name, n, step.sent)
+		}
+	}
+}
+
+// TestResumeUnknown 发送结果未知的邮件使用 --resume 时不重新发送，同时使用 --resend-unknown 时重新发送
+func TestResumeUnknown(t *testing.T) {
+	titles := []string{"收件人", "抄送", "主题", "正文", "附件", "姓名"}
+	e := newTestEnv(t, titles, []string{"zhangsan@example.com", "", "工资条", "", "", "张三"})
+	journalFile := filepath.Join(e.dir, "journal.jsonl")
+	e.set("emailSender.journal", journalFile)
+	oldResume, oldResendUnknown := resume, resendUnknown
+	defer func() { resume, resendUnknown = oldResume, oldResendUnknown }()
+
+	if code := run(); code != exitOK {
+		t.Fatalf("first run: exit code = %d", code)
+	}
+	// 模拟提交邮件后连接中断
+	data, err := os.ReadFile(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte(`"status":"sent"`), []byte(`"status":"unknown"`), 1)
+	if err = os.WriteFile(journalFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name          string
+		resendUnknown bool
+		code          int
+		sent          int // 累计收到的邮件数
+	}{
+		{"resume", false, exitFailed, 1},
+		{"resend unknown", true, exitOK, 2},
+		{"resume after resent", false, exitOK, 2},
+	}
+	resume = true
+	for _, step := range steps {
+		resendUnknown = step.resendUnknown
+		if code := run(); code != step.code {
+			t.Errorf("%s: exit code = %d, want %d", step.name, code, step.code)
+		}
+		if n := len(e.sink.Messages()); n != step.sent {
+			t.Fatalf("%s: received %d messages, want %d", step.name, n, step.sent)
+		}
+	}
+}
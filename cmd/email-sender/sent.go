@@ -0,0 +1,76 @@
+package main
+
+// 保存已发送邮件
+// 通过 SMTP 发送的邮件不会出现在邮箱的已发送邮件中，发送成功后通过 IMAP APPEND 追加到已发送邮件文件夹
+
+import (
+	"errors"
+	"fmt"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imap"
+	"time"
+)
+
+// sentFolder 将发送成功的邮件保存到 IMAP 文件夹，连接建立后复用，断开时重新连接
+type sentFolder struct {
+	cfg    imap.Config
+	folder string
+	c      *imap.Client
+}
+
+// openSentFolder 连接 IMAP 服务器，文件夹不存在时创建
+func openSentFolder(cfg imap.Config, folder string) (*sentFolder, error) {
+	s := &sentFolder{cfg: cfg, folder: folder}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sentFolder) connect() error {
+	c, err := imap.Dial(s.cfg)
+	if err != nil {
+		return fmt.Errorf("连接 IMAP 服务器 %s 失败 %s", s.cfg.Addr, err)
+	}
+	// 确认文件夹存在，不存在时创建
+	if _, err = c.Select(s.folder); err != nil {
+		if err = c.Create(s.folder); err != nil {
+			_ = c.Logout()
+			return fmt.Errorf("创建文件夹 %s 失败 %s", s.folder, err)
+		}
+	}
+	s.c = c
+	return nil
+}
+
+// Save 将邮件追加到文件夹，标记为已读，连接断开时重新连接一次
+func (s *sentFolder) Save(msg []byte, date time.Time) error {
+	if s.c == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	err := s.c.Append(s.folder, []string{`\Seen`}, date, msg)
+	var imapErr *imap.Error
+	if err != nil && !errors.As(err, &imapErr) {
+		_ = s.c.Close()
+		s.c = nil
+		if err = s.connect(); err != nil {
+			return err
+		}
+		err = s.c.Append(s.folder, []string{`\Seen`}, date, msg)
+	}
+	if err != nil {
+		return fmt.Errorf("保存到文件夹 %s 失败 %s", s.folder, err)
+	}
+	return nil
+}
+
+// Close 退出登录
+func (s *sentFolder) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	err := s.c.Logout()
+	s.c = nil
+	return err
+}
@@ -0,0 +1,209 @@
+package main
+
+// 退订
+// 退订名单中的邮箱总是从收件人和抄送人中移除，名单可以是文本文件、CSV 文件、Excel 文件或 Excel 配置文件中的 Sheet
+// 配置了退订链接时添加 List-Unsubscribe 邮件头（RFC 2369），HTTPS 链接同时添加 List-Unsubscribe-Post（RFC 8058，一键退订）
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jordan-wright/email"
+	"github.com/xuri/excelize/v2"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// suppressionList 退订名单，邮箱（小写）-> 来源
+type suppressionList map[string]string
+
+// loadSuppression 读取退订名单，file 为文件，sheet 为 Excel 配置文件 f 中的 Sheet，都为空时返回 nil
+func loadSuppression(f *excelize.File, file, sheet string) (suppressionList, error) {
+	list := suppressionList{}
+	if file != "" {
+		var err error
+		if strings.EqualFold(filepath.Ext(file), ".xlsx") {
+			err = list.loadWorkbook(file)
+		} else {
+			err = list.loadText(file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取退订名单 %s 失败 %s", file, err)
+		}
+	}
+	if sheet != "" {
+		if err := list.loadSheet(f, sheet, sheet); err != nil {
+			return nil, fmt.Errorf("读取退订名单 Sheet %s 失败 %s", sheet, err)
+		}
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list, nil
+}
+
+// add 添加一个邮箱，不是邮箱的内容（如标题行）忽略
+func (s suppressionList) add(value, source string) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "@") {
+		return
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		log.Printf("退订名单 %s 中的邮箱 %s 格式错误，忽略", source, value)
+		return
+	}
+	s[addressKey(addr.Address)] = source
+}
+
+// loadText 每行一个邮箱，# 开头的行为注释，CSV 文件使用第一列
+func (s suppressionList) loadText(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexAny(line, ",;\t"); i >= 0 {
+			line = line[:i]
+		}
+		s.add(strings.Trim(line, `"`), fmt.Sprintf("%s 第 %d 行", filepath.Base(path), num))
+	}
+	return scanner.Err()
+}
+
+// loadWorkbook 读取 Excel 文件第一个 Sheet 的第一列
+func (s suppressionList) loadWorkbook(path string) error {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return s.loadSheet(f, f.GetSheetName(0), filepath.Base(path))
+}
+
+// loadSheet 读取 Sheet 的第一列
+func (s suppressionList) loadSheet(f *excelize.File, sheet, source string) error {
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if len(row) > 0 {
+			s.add(row[0], fmt.Sprintf("%s 第 %d 行", source, i+1))
+		}
+	}
+	return nil
+}
+
+// filter 从收件人和抄送人中移除退订名单中的邮箱，返回移除的邮箱
+func (s suppressionList) filter(em *email.Email) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	var removed []string
+	keep := func(list []string) []string {
+		var result []string
+		for _, v := range list {
+			if addr, err := mail.ParseAddress(v); err == nil {
+				if _, ok := s[addressKey(addr.Address)]; ok {
+					removed = append(removed, addr.Address)
+					continue
+				}
+			}
+			result = append(result, v)
+		}
+		return result
+	}
+	em.To = keep(em.To)
+	em.Cc = keep(em.Cc)
+	return removed
+}
+
+// suppressedRow 有收件人被移除的行
+type suppressedRow struct {
+	Row       int      `json:"row"`
+	Addresses []string `json:"addresses"`
+	Skipped   bool     `json:"skipped"` // 所有收件人都被移除，该行不发送
+}
+
+// printSuppressedRecipients 打印被移除的收件人
+func printSuppressedRecipients(rows []suppressedRow) {
+	if len(rows) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Row < rows[j].Row })
+	fmt.Fprintf(out, "以下收件人在退订名单中，已从收件人和抄送人中移除：\n\n")
+	for _, row := range rows {
+		note := ""
+		if row.Skipped {
+			note = "（没有其他收件人，该行不发送）"
+		}
+		fmt.Fprintf(out, "第 %d 行：%s%s\n", row.Row, strings.Join(row.Addresses, "、"), note)
+	}
+	fmt.Fprintln(out)
+}
+
+// setListUnsubscribe 根据配置的退订链接模板添加 List-Unsubscribe 邮件头
+// 模板变量为该行的所有列，以及第一个收件人的邮箱 {{.收件人邮箱}}
+func setListUnsubscribe(em *email.Email, row emailRow, cfg *Config) error {
+	if cfg.UnsubscribeURL == "" && cfg.UnsubscribeMailto == "" {
+		return nil
+	}
+	vars := make(map[string]string, len(row.Vars)+1)
+	for k, v := range row.Vars {
+		vars[k] = v
+	}
+	if addr, err := mail.ParseAddress(em.To[0]); err == nil {
+		vars["收件人邮箱"] = addr.Address
+	}
+
+	var links []string
+	oneClick := false
+	if cfg.UnsubscribeURL != "" {
+		link, err := renderText("unsubscribeURL", cfg.UnsubscribeURL, vars)
+		if err != nil {
+			return fmt.Errorf("退订链接模板错误 %s", err)
+		}
+		link = strings.TrimSpace(link)
+		lower := strings.ToLower(link)
+		if !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "http://") {
+			return fmt.Errorf("退订链接 %s 必须以 https:// 或 http:// 开头", link)
+		}
+		links = append(links, link)
+		// 一键退订要求使用 HTTPS
+		oneClick = cfg.UnsubscribeOneClick && strings.HasPrefix(lower, "https://")
+	}
+	if cfg.UnsubscribeMailto != "" {
+		link, err := renderText("unsubscribeMailto", cfg.UnsubscribeMailto, vars)
+		if err != nil {
+			return fmt.Errorf("退订邮箱模板错误 %s", err)
+		}
+		link = strings.TrimSpace(link)
+		if !strings.HasPrefix(strings.ToLower(link), "mailto:") {
+			link = "mailto:" + link
+		}
+		links = append(links, link)
+	}
+
+	for i, link := range links {
+		if strings.ContainsAny(link, "\r\n<> ") {
+			return fmt.Errorf("退订链接 %q 不能包含空格、换行和尖括号，请使用 urlquery 转义，如 {{urlquery .收件人邮箱}}", link)
+		}
+		links[i] = "<" + link + ">"
+	}
+	em.Headers.Set("List-Unsubscribe", strings.Join(links, ", "))
+	if oneClick {
+		em.Headers.Set("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	return nil
+}
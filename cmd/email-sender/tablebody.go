@@ -0,0 +1,185 @@
+package main
+
+// 表格正文
+// 邮件正文文件名为 @table 时，将数据工作簿中对应的一行渲染为带样式的 HTML 表格作为邮件正文，不需要为每一行准备 HTML 文件
+// @table:列1,列2 只显示指定的列，覆盖配置中的 tableBody.columns
+// 默认使用 email-list Sheet 中的同一行；配置了 tableBody.key 时在数据 Sheet 的 key 列中查找与 email-list 中 match 列内容相同的行
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/xlsxtable"
+	"github.com/yuchunyu97/toolset-golang/pkg/utils/sliceutil"
+	"html"
+	"strings"
+)
+
+// tableBodyPrefix 正文文件名为该前缀时使用表格正文
+const tableBodyPrefix = "@table"
+
+// TableBodyConfig 表格正文配置
+type TableBodyConfig struct {
+	File      string   // 数据工作簿，为空时使用 Excel 配置文件
+	Sheet     string   // 数据 Sheet，为空时使用 email-list
+	HeaderRow int      // 标题行的行号，默认为 1
+	Key       string   // 数据 Sheet 中用于查找行的列，为空时使用与 email-list 中相同的行号
+	Match     string   // email-list 中与 Key 列对应的列，默认与 Key 相同
+	Columns   []string // 显示的列，为空时显示所有列（使用 email-list 时不包括收件人、主题等固定列和发送结果列）
+	Layout    string   // 表格布局：horizontal（标题在上）、vertical（标题在左）
+	Intro     string   // 表格前的文字，可以使用模板变量
+	Footer    string   // 表格后的文字，可以使用模板变量
+}
+
+// tableBody 表格正文，第一次使用时打开数据工作簿
+type tableBody struct {
+	f     *excelize.File // Excel 配置文件
+	cfg   TableBodyConfig
+	sheet *xlsxtable.Sheet
+	err   error
+	// emailList 数据 Sheet 是否为 email-list Sheet
+	emailList bool
+	// columns 没有指定列时显示的列
+	columns []string
+}
+
+func newTableBody(f *excelize.File, cfg TableBodyConfig) *tableBody {
+	return &tableBody{f: f, cfg: cfg}
+}
+
+// isTableBody 正文文件名是否为表格正文
+func isTableBody(name string) bool {
+	name = strings.TrimSpace(name)
+	return name == tableBodyPrefix || strings.HasPrefix(name, tableBodyPrefix+":")
+}
+
+// open 打开数据 Sheet，只打开一次，出错时之后的每一行都返回同样的错误
+func (t *tableBody) open() (*xlsxtable.Sheet, error) {
+	if t.sheet != nil || t.err != nil {
+		return t.sheet, t.err
+	}
+	f := t.f
+	if t.cfg.File != "" && t.cfg.File != ConfigFile {
+		if f, t.err = excelize.OpenFile(t.cfg.File); t.err != nil {
+			t.err = fmt.Errorf("读取表格正文数据工作簿 %s 失败 %s", t.cfg.File, t.err)
+			return nil, t.err
+		}
+	}
+	name := t.cfg.Sheet
+	if name == "" {
+		name = "email-list"
+	}
+	// email-list Sheet 的标题行总是第一行
+	t.emailList = f == t.f && name == "email-list"
+	if t.emailList || t.cfg.HeaderRow < 1 {
+		t.cfg.HeaderRow = 1
+	}
+	if t.sheet, t.err = xlsxtable.Open(f, name, t.cfg.HeaderRow); t.err != nil {
+		t.err = fmt.Errorf("读取表格正文数据 Sheet %s 失败 %s", name, t.err)
+		return nil, t.err
+	}
+	t.columns = t.cfg.Columns
+	if len(t.columns) == 0 && t.emailList {
+		t.columns = t.emailListColumns()
+	}
+	return t.sheet, nil
+}
+
+// emailListColumns 使用 email-list Sheet 时默认显示的列，不包括收件人、主题等固定列、可选列和发送结果列
+func (t *tableBody) emailListColumns() []string {
+	rows, _ := t.f.GetRows("email-list")
+	if len(rows) == 0 {
+		return nil
+	}
+	optional := append(append(append(append(append([]string(nil), fromNameTitles...), replyToTitles...),
+		sendAtTitles...), encryptTitles...), resultHeaders...)
+	var columns []string
+	for i, title := range rows[0] {
+		title = strings.TrimSpace(title)
+		if i <= colAttachments || title == "" || sliceutil.HasString(optional, title) ||
+			strings.HasPrefix(strings.ToUpper(title), "X-") {
+			continue
+		}
+		columns = append(columns, title)
+	}
+	return columns
+}
+
+// render 生成一行的表格正文，name 为正文文件名（@table 或 @table:列1,列2）
+func (t *tableBody) render(row emailRow, name string) ([]byte, error) {
+	sheet, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+
+	// 查找数据行
+	num := row.Num
+	if t.cfg.Key != "" {
+		match := t.cfg.Match
+		if match == "" {
+			match = t.cfg.Key
+		}
+		value, ok := row.Vars[match]
+		if !ok {
+			return nil, fmt.Errorf("email-list Sheet 中没有 %s 列，无法查找表格正文数据", match)
+		}
+		if num, err = sheet.Find(t.cfg.Key, value); err != nil {
+			return nil, fmt.Errorf("查找表格正文数据失败 %s", err)
+		}
+	} else {
+		// 数据 Sheet 的标题行不在第一行时，标题行之后的行按顺序与 email-list 中的行对应
+		num = row.Num + t.cfg.HeaderRow - 1
+	}
+
+	columns, err := t.columnsOf(name)
+	if err != nil {
+		return nil, err
+	}
+	table, err := sheet.Render(num, columns, t.cfg.Layout)
+	if err != nil {
+		return nil, fmt.Errorf("生成表格正文失败 %s", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"></head>\n<body>\n")
+	if err = t.writeText(&b, "tableBody.intro", t.cfg.Intro, row.Vars); err != nil {
+		return nil, err
+	}
+	b.WriteString(table)
+	if err = t.writeText(&b, "tableBody.footer", t.cfg.Footer, row.Vars); err != nil {
+		return nil, err
+	}
+	b.WriteString("</body>\n</html>\n")
+	return []byte(b.String()), nil
+}
+
+// columnsOf 显示的列，正文文件名中指定的列优先，其次为配置
+func (t *tableBody) columnsOf(name string) ([]string, error) {
+	list := strings.TrimPrefix(strings.TrimSpace(name), tableBodyPrefix)
+	if !strings.HasPrefix(list, ":") {
+		return t.columns, nil
+	}
+	var columns []string
+	for _, column := range strings.Split(list[1:], ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("表格正文没有指定列，格式为 @table:列1,列2")
+	}
+	return columns, nil
+}
+
+// writeText 渲染表格前后的文字，转义 HTML，保留换行
+func (t *tableBody) writeText(b *strings.Builder, name, text string, vars map[string]string) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	rendered, err := renderText(name, text, vars)
+	if err != nil {
+		return fmt.Errorf("配置 %s 模板错误 %s", name, err)
+	}
+	fmt.Fprintf(b, "<p>%s</p>\n", strings.ReplaceAll(html.EscapeString(strings.TrimSpace(rendered)), "\n", "<br>"))
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+// 邮件模板
+// email-list Sheet 中每一列的标题都可以作为模板变量，如 {{.姓名}}、{{.金额}}
+// 邮件主题使用 text/template，邮件正文使用 html/template，变量内容会自动转义
+// 模板语法：https://pkg.go.dev/text/template
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// templateCache 邮件正文模板缓存，同一个正文文件只读取和解析一次
+type templateCache struct {
+	templates map[string]*htmltemplate.Template
+	// raw 不包含模板语法的正文文件，原样发送
+	// html/template 会删除 HTML 注释（如 Outlook 的条件注释），因此不作为模板解析
+	raw  map[string][]byte
+	errs map[string]error
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{
+		templates: map[string]*htmltemplate.Template{},
+		raw:       map[string][]byte{},
+		errs:      map[string]error{},
+	}
+}
+
+func (c *templateCache) load(path string) error {
+	if err, ok := c.errs[path]; ok {
+		return err
+	}
+	if _, ok := c.templates[path]; ok {
+		return nil
+	}
+	if _, ok := c.raw[path]; ok {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err == nil {
+		if !bytes.Contains(content, []byte("{{")) {
+			c.raw[path] = content
+			return nil
+		}
+		var t *htmltemplate.Template
+		t, err = htmltemplate.New(filepath.Base(path)).Option("missingkey=error").Parse(string(content))
+		if err == nil {
+			c.templates[path] = t
+			return nil
+		}
+	}
+	c.errs[path] = err
+	return err
+}
+
+// render 使用模板变量 vars 渲染邮件正文文件 path
+func (c *templateCache) render(path string, vars map[string]string) ([]byte, error) {
+	if err := c.load(path); err != nil {
+		return nil, err
+	}
+	if content, ok := c.raw[path]; ok {
+		return content, nil
+	}
+	t := c.templates[path]
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderText 使用模板变量 vars 渲染邮件主题、附件等文本
+func renderText(name, text string, vars map[string]string) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,227 @@
+package main
+
+// SMTP Sink
+// 用于测试 email-sender 的 SMTP 服务器，接收并记录所有邮件，不会投递
+// 可以同时启动 IMAP 服务器，为匹配 --bounce 的收件人生成退信放入收件箱
+// 也可以同时启动 HTTP 邮件 API，用于测试 email-sender --transport http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/spf13/pflag"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/bounce"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/httpsink"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imapsink"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/smtpsink"
+	"log"
+	"mime"
+	"net/mail"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	listen   string
+	security string
+	username string
+	password string
+	dir      string
+	caFile   string
+	imapAddr string
+	bounces  []string
+
+	httpAddr      string
+	httpToken     string
+	httpFailFirst int
+)
+
+func init() {
+	pflag.StringVarP(&listen, "listen", "l", "127.0.0.1:2525", "Listen address.")
+	pflag.StringVar(&security, "security", "starttls", "Connection security: starttls, tls or none.")
+	pflag.StringVarP(&username, "username", "u", "", "Require auth with this username, default accept any username.")
+	pflag.StringVarP(&password, "password", "p", "", "Password of the username.")
+	pflag.StringVarP(&dir, "dir", "d", "smtp-sink", "Folder to save the received emails as .eml files, empty to not save.")
+	pflag.StringVar(&caFile, "ca-file", "smtp-sink-ca.pem", "Write the self-signed certificate to this file, used as --ca-file of email-sender.")
+	pflag.StringVar(&imapAddr, "imap", "", "Also start an IMAP server on this address, e.g. 127.0.0.1:1143, used by email-sender --check-bounces and --sent-folder.")
+	pflag.StringSliceVar(&bounces, "bounce", nil,
+		"Recipient patterns (e.g. \"*@invalid.example\") to bounce, the DSN is put into the IMAP INBOX, repeatable.")
+	pflag.StringVar(&httpAddr, "http", "", "Also start an HTTP mail API on this address, e.g. 127.0.0.1:8025, used by email-sender --transport http.")
+	pflag.StringVar(&httpToken, "http-token", "", "Require Authorization: Bearer <token> for the HTTP mail API.")
+	pflag.IntVar(&httpFailFirst, "http-fail-first", 0, "Reply 503 to the first N requests of the HTTP mail API, to test retries.")
+
+	pflag.Parse()
+}
+
+func main() {
+	var imapServer *imapsink.Server
+	if imapAddr != "" {
+		imapServer = &imapsink.Server{
+			Addr:     imapAddr,
+			Username: username,
+			Password: password,
+			OnAppend: func(mailbox string, msg imapsink.Message) {
+				log.Printf("IMAP 追加邮件到 %s（%d 字节，标记：%s）", mailbox, len(msg.Data), strings.Join(msg.Flags, " "))
+			},
+		}
+	}
+
+	s := &smtpsink.Server{
+		Addr:     listen,
+		Username: username,
+		Password: password,
+		Dir:      dir,
+		OnMessage: func(msg smtpsink.Message) {
+			subject := ""
+			if m, err := mail.ReadMessage(bytes.NewReader(msg.Data)); err == nil {
+				subject = m.Header.Get("Subject")
+				if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+					subject = decoded
+				}
+			}
+			log.Printf("收到邮件 From: %s To: %s Subject: %s（%d 字节，认证：%s，TLS：%v）",
+				msg.From, strings.Join(msg.To, ", "), subject, len(msg.Data), msg.Auth, msg.TLS)
+			if imapServer != nil {
+				bounceMessage(imapServer, msg)
+			}
+		},
+	}
+
+	var httpServer *httpsink.Server
+	if httpAddr != "" {
+		var requests int32
+		httpServer = &httpsink.Server{
+			Addr:  httpAddr,
+			Token: httpToken,
+			Fail: func(req httpsink.Request) int {
+				if n := atomic.AddInt32(&requests, 1); n <= int32(httpFailFirst) {
+					log.Printf("HTTP 模拟失败 %s %s（%d/%d）", req.Method, req.Path, n, httpFailFirst)
+					return 503
+				}
+				return 0
+			},
+			OnRequest: logHTTPRequest,
+		}
+	}
+
+	switch security {
+	case "starttls", "tls":
+		tlsConfig, certPEM, err := smtpsink.SelfSignedTLS()
+		if err != nil {
+			log.Fatalf("生成证书失败 %s", err)
+		}
+		if err = os.WriteFile(caFile, certPEM, 0644); err != nil {
+			log.Fatalf("写入证书失败 %s", err)
+		}
+		s.TLSConfig = tlsConfig
+		s.ImplicitTLS = security == "tls"
+		if imapServer != nil {
+			imapServer.TLSConfig = tlsConfig
+			imapServer.ImplicitTLS = security == "tls"
+		}
+		if httpServer != nil {
+			httpServer.TLSConfig = tlsConfig
+		}
+	case "none":
+	default:
+		log.Fatalf("不支持的加密方式 %s", security)
+	}
+
+	if err := s.Start(); err != nil {
+		log.Fatalf("启动失败 %s", err)
+	}
+	fmt.Printf("SMTP Sink 已启动 %s（加密方式：%s）\n", s.Addr, security)
+	if imapServer != nil {
+		if err := imapServer.Start(); err != nil {
+			log.Fatalf("启动 IMAP 服务器失败 %s", err)
+		}
+		defer func() { _ = imapServer.Close() }()
+		fmt.Printf("IMAP 服务器已启动 %s，退信放入 INBOX\n", imapServer.Addr)
+	}
+	if httpServer != nil {
+		if err := httpServer.Start(); err != nil {
+			log.Fatalf("启动 HTTP 邮件 API 失败 %s", err)
+		}
+		defer func() { _ = httpServer.Close() }()
+		fmt.Printf("HTTP 邮件 API 已启动 %s\n", httpServer.URL())
+	}
+	if s.TLSConfig != nil {
+		fmt.Printf("自签名证书已写入 %s，请使用 email-sender --ca-file %s\n", caFile, caFile)
+	}
+	if dir != "" {
+		fmt.Printf("收到的邮件保存在 %s 文件夹中\n", dir)
+	}
+	fmt.Printf("按 Ctrl+C 退出\n\n")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	_ = s.Close()
+	log.Printf("共收到 %d 封邮件", len(s.Messages()))
+	if httpServer != nil {
+		log.Printf("HTTP 邮件 API 共收到 %d 个请求", len(httpServer.Requests()))
+	}
+}
+
+// logHTTPRequest 打印 HTTP 邮件 API 收到的请求，请求体中有 raw 字段（Base64 编码的邮件）时保存邮件
+func logHTTPRequest(req httpsink.Request) {
+	keys := make([]string, 0, len(req.JSON))
+	for k := range req.JSON {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	log.Printf("HTTP 收到请求 %s %s %s（%d 字节，字段：%s，TLS：%v）",
+		req.ID, req.Method, req.Path, len(req.Body), strings.Join(keys, ", "), req.TLS)
+
+	raw, ok := req.JSON["raw"].(string)
+	if !ok || dir == "" {
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		log.Printf("HTTP 请求 raw 字段不是 Base64 编码 %s", err)
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err == nil {
+		err = os.WriteFile(filepath.Join(dir, req.ID+".eml"), data, 0644)
+	}
+	if err != nil {
+		log.Printf("保存邮件失败 %s", err)
+	}
+}
+
+// bounceMessage 为匹配 --bounce 的收件人生成退信，放入 IMAP 收件箱
+func bounceMessage(imapServer *imapsink.Server, msg smtpsink.Message) {
+	var rcpts []bounce.Recipient
+	for _, to := range msg.To {
+		for _, pattern := range bounces {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(to)); ok {
+				rcpts = append(rcpts, bounce.Recipient{
+					Address:    to,
+					Action:     "failed",
+					Status:     "5.1.1",
+					Diagnostic: "550 5.1.1 <" + to + ">: Recipient address rejected: User unknown",
+				})
+				break
+			}
+		}
+	}
+	if len(rcpts) == 0 {
+		return
+	}
+	dsn, err := bounce.NewDSN("smtp-sink.localhost", msg.From, msg.Data, rcpts)
+	if err != nil {
+		log.Printf("生成退信失败 %s", err)
+		return
+	}
+	imapServer.Deliver("INBOX", dsn)
+	for _, rcpt := range rcpts {
+		log.Printf("退信 %s", rcpt.Address)
+	}
+}
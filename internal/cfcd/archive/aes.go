@@ -0,0 +1,370 @@
+package archive
+
+// WinZip AES 加密（AE-2）
+// 规范文档：https://www.winzip.com/en/support/aes-encryption/
+//
+// 加密后的文件数据格式为：salt | 密码校验值(2 字节) | 加密数据 | HMAC-SHA1 认证码(10 字节)
+// 加密数据为先压缩后再使用 AES-CTR 加密的结果，AE-2 格式不记录 CRC32，由认证码保证数据完整性
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	methodWinZipAES = 99     // WinZip AES 加密的压缩方法标识
+	extraWinZipAES  = 0x9901 // WinZip AES 扩展字段 ID
+
+	aesVersionAE2   = 2 // AE-2，不记录 CRC32
+	aesStrength256  = 3 // AES-256
+	aesPwvLen       = 2
+	aesMacLen       = 10
+	aesKdfIteration = 1000
+)
+
+var (
+	// ErrPassword 密码错误
+	ErrPassword = errors.New("archive: invalid password")
+	// ErrAuthentication 加密数据认证失败，数据被篡改或损坏
+	ErrAuthentication = errors.New("archive: authentication failed")
+	// ErrEncrypted 文件已加密，但未提供密码
+	ErrEncrypted = errors.New("archive: file is encrypted")
+)
+
+// aesKeyLen 不同加密强度对应的 AES 密钥长度，salt 长度为密钥长度的一半
+func aesKeyLen(strength byte) (int, error) {
+	switch strength {
+	case 1:
+		return 16, nil
+	case 2:
+		return 24, nil
+	case 3:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("archive: unknown aes strength %d", strength)
+}
+
+// deriveKeys 通过 PBKDF2-HMAC-SHA1 生成加密密钥、认证密钥和密码校验值
+func deriveKeys(password string, salt []byte, keyLen int) (encKey, macKey, pwv []byte) {
+	dk := pbkdf2.Key([]byte(password), salt, aesKdfIteration, 2*keyLen+aesPwvLen, sha1.New)
+	return dk[:keyLen], dk[keyLen : 2*keyLen], dk[2*keyLen:]
+}
+
+// winZipCTR WinZip 使用的 CTR 模式，计数器为小端序且从 1 开始
+// 与 crypto/cipher 中的大端序 CTR 不兼容，因此单独实现
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newWinZipCTR(key []byte) (*winZipCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &winZipCTR{block: block, pos: aes.BlockSize}, nil
+}
+
+func (s *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.pos == aes.BlockSize {
+			for j := range s.counter {
+				s.counter[j]++
+				if s.counter[j] != 0 {
+					break
+				}
+			}
+			s.block.Encrypt(s.stream[:], s.counter[:])
+			s.pos = 0
+		}
+		dst[i] = src[i] ^ s.stream[s.pos]
+		s.pos++
+	}
+}
+
+// encryptWriter 加密写入的数据，并对密文计算认证码
+type encryptWriter struct {
+	w   io.Writer
+	ctr *winZipCTR
+	mac hash.Hash
+	buf []byte
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if cap(e.buf) < len(p) {
+		e.buf = make([]byte, len(p))
+	}
+	buf := e.buf[:len(p)]
+	e.ctr.XORKeyStream(buf, p)
+	e.mac.Write(buf)
+	return e.w.Write(buf)
+}
+
+// aesExtra 生成 WinZip AES 扩展字段，method 为加密前实际使用的压缩方法
+func aesExtra(method uint16) []byte {
+	b := make([]byte, 11)
+	binary.LittleEndian.PutUint16(b[0:], extraWinZipAES)
+	binary.LittleEndian.PutUint16(b[2:], 7)
+	binary.LittleEndian.PutUint16(b[4:], aesVersionAE2)
+	b[6], b[7] = 'A', 'E'
+	b[8] = aesStrength256
+	binary.LittleEndian.PutUint16(b[9:], method)
+	return b
+}
+
+// parseAESExtra 从扩展字段中解析加密强度和实际的压缩方法
+func parseAESExtra(extra []byte) (strength byte, method uint16, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == extraWinZipAES && size >= 7 {
+			return extra[4], binary.LittleEndian.Uint16(extra[5:]), true
+		}
+		extra = extra[size:]
+	}
+	return 0, 0, false
+}
+
+// writeEncryptedFile 压缩并加密文件 path，写入 zw
+// 加密数据先写入临时文件，得到压缩后的大小后再以原始数据写入 zip 包
+// deterministic 为 true 时 salt 由密码、文件名和文件内容生成，相同的文件加密结果相同，
+// 内容不同的文件 salt 不同，不会重复使用同一个密钥流
+func writeEncryptedFile(zw *zip.Writer, fh *zip.FileHeader, path, password string, deterministic bool) (err error) {
+	fr, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fr.Close() }()
+
+	tmp, err := os.CreateTemp("", "cfcd-aes-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	salt := make([]byte, 16)
+	if deterministic {
+		if salt, err = deterministicSalt(fr, fh.Name, password, len(salt)); err != nil {
+			return err
+		}
+	} else if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	encKey, macKey, pwv := deriveKeys(password, salt, 32)
+	ctr, err := newWinZipCTR(encKey)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(append(salt, pwv...)); err != nil {
+		return err
+	}
+
+	ew := &encryptWriter{w: tmp, ctr: ctr, mac: hmac.New(sha1.New, macKey)}
+	cw, err := flate.NewWriter(ew, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(cw, fr)
+	if err != nil {
+		return err
+	}
+	if err = cw.Close(); err != nil {
+		return err
+	}
+	if _, err = tmp.Write(ew.mac.Sum(nil)[:aesMacLen]); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	fh.Method = methodWinZipAES
+	fh.Flags |= 0x1 // 加密标识
+	if !isASCII(fh.Name) && utf8.ValidString(fh.Name) {
+		fh.Flags |= 0x800 // 文件名使用 UTF-8 编码，CreateRaw 不会自动设置
+	}
+	fh.CRC32 = 0
+	fh.UncompressedSize64 = uint64(n)
+	fh.CompressedSize64 = uint64(size)
+	fh.Extra = append(fh.Extra, aesExtra(zip.Deflate)...)
+
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, tmp)
+	return err
+}
+
+// deterministicSalt 根据文件名和文件内容生成 salt，读取完成后 fr 回到文件开头
+func deterministicSalt(fr io.ReadSeeker, name, password string, n int) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, fr); err != nil {
+		return nil, err
+	}
+	if _, err := fr.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(h.Sum(nil))
+	return mac.Sum(nil)[:n], nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEncrypted 判断压缩包中的文件是否已加密
+func IsEncrypted(f *zip.File) bool {
+	return f.Flags&0x1 != 0
+}
+
+// Open 打开压缩包中的文件，已加密的文件使用 password 解密
+// 对于 WinZip AES 加密的文件，读取到结尾时会校验认证码，校验失败返回 ErrAuthentication
+func Open(f *zip.File, password string) (io.ReadCloser, error) {
+	if !IsEncrypted(f) {
+		return f.Open()
+	}
+	if password == "" {
+		return nil, ErrEncrypted
+	}
+	strength, method, ok := parseAESExtra(f.Extra)
+	if f.Method != methodWinZipAES || !ok {
+		return nil, fmt.Errorf("archive: %s: unsupported encryption", f.Name)
+	}
+	keyLen, err := aesKeyLen(strength)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	saltLen := keyLen / 2
+	if f.CompressedSize64 < uint64(saltLen+aesPwvLen+aesMacLen) {
+		return nil, zip.ErrFormat
+	}
+	head := make([]byte, saltLen+aesPwvLen)
+	if _, err = io.ReadFull(raw, head); err != nil {
+		return nil, err
+	}
+	encKey, macKey, pwv := deriveKeys(password, head[:saltLen], keyLen)
+	if subtle.ConstantTimeCompare(pwv, head[saltLen:]) != 1 {
+		return nil, ErrPassword
+	}
+	ctr, err := newWinZipCTR(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dataLen := int64(f.CompressedSize64) - int64(len(head)) - aesMacLen
+	dr := &decryptReader{
+		r:   io.LimitReader(raw, dataLen),
+		raw: raw,
+		ctr: ctr,
+		mac: hmac.New(sha1.New, macKey),
+	}
+	switch method {
+	case zip.Store:
+		return &aesReadCloser{r: dr, dr: dr}, nil
+	case zip.Deflate:
+		fr := flate.NewReader(dr)
+		return &aesReadCloser{r: fr, dr: dr, c: fr}, nil
+	}
+	return nil, zip.ErrAlgorithm
+}
+
+// aesReadCloser 解压结束后读完剩余的加密数据，保证认证码被校验
+type aesReadCloser struct {
+	r  io.Reader
+	dr *decryptReader
+	c  io.Closer
+}
+
+func (a *aesReadCloser) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if err == io.EOF {
+		if _, derr := io.Copy(io.Discard, a.dr); derr != nil {
+			return n, derr
+		}
+	}
+	return n, err
+}
+
+func (a *aesReadCloser) Close() error {
+	if a.c != nil {
+		return a.c.Close()
+	}
+	return nil
+}
+
+// decryptReader 解密读取的数据，读取结束时校验认证码
+type decryptReader struct {
+	r    io.Reader
+	raw  io.Reader
+	ctr  *winZipCTR
+	mac  hash.Hash
+	done bool
+	err  error
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.done {
+		return 0, d.err
+	}
+	n, err := d.r.Read(p)
+	if n > 0 {
+		d.mac.Write(p[:n])
+		d.ctr.XORKeyStream(p[:n], p[:n])
+	}
+	if err == io.EOF {
+		d.done, d.err = true, io.EOF
+		code := make([]byte, aesMacLen)
+		if _, rerr := io.ReadFull(d.raw, code); rerr != nil {
+			d.err = rerr
+		} else if !bytes.Equal(code, d.mac.Sum(nil)[:aesMacLen]) {
+			d.err = ErrAuthentication
+		}
+		return n, d.err
+	}
+	return n, err
+}
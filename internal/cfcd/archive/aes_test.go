@@ -0,0 +1,351 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// referenceDecrypt 按 WinZip AES 规范独立实现的解密，不使用 aes.go 中的代码，用于校验加密结果
+// 返回解密并解压后的文件内容
+func referenceDecrypt(t *testing.T, f *zip.File, password string) []byte {
+	t.Helper()
+	if f.Method != 99 || f.Flags&0x1 == 0 {
+		t.Fatalf("%s: method %d flags %#x, want WinZip AES", f.Name, f.Method, f.Flags)
+	}
+
+	// 扩展字段：0x9901 | 长度 7 | 版本 | "AE" | 强度 | 实际的压缩方法
+	var extra []byte
+	for b := f.Extra; len(b) >= 4; {
+		id, size := binary.LittleEndian.Uint16(b), int(binary.LittleEndian.Uint16(b[2:]))
+		if id == 0x9901 {
+			extra = b[4 : 4+size]
+		}
+		b = b[4+size:]
+	}
+	if len(extra) != 7 || string(extra[2:4]) != "AE" {
+		t.Fatalf("%s: bad AES extra field %x", f.Name, extra)
+	}
+	if v := binary.LittleEndian.Uint16(extra); v != 2 {
+		t.Errorf("%s: vendor version %d, want AE-2", f.Name, v)
+	}
+	if extra[4] != 3 {
+		t.Errorf("%s: strength %d, want AES-256", f.Name, extra[4])
+	}
+	if f.CRC32 != 0 {
+		t.Errorf("%s: AE-2 CRC32 = %#x, want 0", f.Name, f.CRC32)
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, pwv := data[:16], data[16:18]
+	body, code := data[18:len(data)-10], data[len(data)-10:]
+
+	dk := pbkdf2.Key([]byte(password), salt, 1000, 66, sha1.New)
+	if !bytes.Equal(dk[64:], pwv) {
+		t.Fatalf("%s: password verification value mismatch", f.Name)
+	}
+	mac := hmac.New(sha1.New, dk[32:64])
+	mac.Write(body)
+	if !bytes.Equal(mac.Sum(nil)[:10], code) {
+		t.Fatalf("%s: authentication code mismatch", f.Name)
+	}
+
+	// AES-CTR，计数器为 128 位小端序整数，从 1 开始
+	block, err := aes.NewCipher(dk[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := make([]byte, len(body))
+	var counter, stream [16]byte
+	for i := 0; i < len(body); i += 16 {
+		lo := binary.LittleEndian.Uint64(counter[:8]) + 1
+		binary.LittleEndian.PutUint64(counter[:8], lo)
+		if lo == 0 {
+			binary.LittleEndian.PutUint64(counter[8:], binary.LittleEndian.Uint64(counter[8:])+1)
+		}
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < i+16 && j < len(body); j++ {
+			plain[j] = body[j] ^ stream[j-i]
+		}
+	}
+
+	if method := binary.LittleEndian.Uint16(extra[5:]); method == zip.Store {
+		return plain
+	}
+	content, err := io.ReadAll(flate.NewReader(bytes.NewReader(plain)))
+	if err != nil {
+		t.Fatalf("%s: inflate: %s", f.Name, err)
+	}
+	return content
+}
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func fileNamed(zr *zip.ReadCloser, name string) *zip.File {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func randomBytes(n int, seed int64) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestAESRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		password     string
+		reproducible bool
+		files        map[string][]byte
+	}{
+		{
+			name:     "small",
+			password: "secret",
+			files:    map[string][]byte{"a.txt": []byte("hello, world\n")},
+		},
+		{
+			name:     "empty file",
+			password: "secret",
+			files:    map[string][]byte{"empty.txt": {}},
+		},
+		{
+			// 超过 256 个块，计数器的低字节会进位
+			name:     "multi block",
+			password: "p@ss 密码",
+			files: map[string][]byte{
+				"dir/random.bin": randomBytes(300*16+7, 1),
+				"dir/text.txt":   bytes.Repeat([]byte("abcdefgh"), 4096),
+			},
+		},
+		{
+			name:         "reproducible",
+			password:     "secret",
+			reproducible: true,
+			files:        map[string][]byte{"中文.txt": []byte("你好")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src")
+			writeFiles(t, src, tt.files)
+			dst := filepath.Join(t.TempDir(), "out.zip")
+			if _, err := Zip(dst, src, Options{Password: tt.password, Reproducible: tt.reproducible}); err != nil {
+				t.Fatal(err)
+			}
+
+			zr, err := zip.OpenReader(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = zr.Close() }()
+
+			found := 0
+			for _, f := range zr.File {
+				if f.FileInfo().IsDir() {
+					continue
+				}
+				name := filepath.ToSlash(f.Name)
+				if name[0] == '/' {
+					name = name[1:]
+				}
+				want, ok := tt.files[name]
+				if !ok {
+					t.Errorf("unexpected file %s", f.Name)
+					continue
+				}
+				found++
+
+				if got := referenceDecrypt(t, f, tt.password); !bytes.Equal(got, want) {
+					t.Errorf("%s: reference decrypt = %d bytes, want %d bytes", name, len(got), len(want))
+				}
+
+				rc, err := Open(f, tt.password)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(rc)
+				_ = rc.Close()
+				if err != nil {
+					t.Fatalf("%s: Open: %s", name, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s: Open = %d bytes, want %d bytes", name, len(got), len(want))
+				}
+
+				if _, err = Open(f, tt.password+"x"); !errors.Is(err, ErrPassword) {
+					t.Errorf("%s: wrong password error = %v, want ErrPassword", name, err)
+				}
+				if _, err = Open(f, ""); !errors.Is(err, ErrEncrypted) {
+					t.Errorf("%s: empty password error = %v, want ErrEncrypted", name, err)
+				}
+			}
+			if found != len(tt.files) {
+				t.Errorf("found %d files, want %d", found, len(tt.files))
+			}
+		})
+	}
+}
+
+func TestAESAuthentication(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, src, map[string][]byte{"a.txt": bytes.Repeat([]byte("data"), 100)})
+	dst := filepath.Join(t.TempDir(), "out.zip")
+	if _, err := Zip(dst, src, Options{Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改加密数据中的一个字节
+	zr, err := zip.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, err := fileNamed(zr, "/a.txt").DataOffset()
+	_ = zr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset+16+2+1] ^= 0xff
+	if err = os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err = zip.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = zr.Close() }()
+	rc, err := Open(fileNamed(zr, "/a.txt"), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rc.Close() }()
+	if _, err = io.ReadAll(rc); err == nil {
+		t.Error("tampered data read without error")
+	}
+}
+
+// TestAESLibarchive 与独立实现的 WinZip AES 互相解密
+// testdata/libarchive-aes256.zip 由 libarchive 3.7.7 生成，密码为 pass 密码：
+// bsdtar --format zip --options zip:encryption=aes256 --passphrase 'pass 密码' -cf libarchive-aes256.zip hello.txt 工资.txt 子目录
+// 其中 hello.txt 小于 20 字节为 AE-2，其他文件为 AE-1
+func TestAESLibarchive(t *testing.T) {
+	const password = "pass 密码"
+	want := map[string]string{
+		"hello.txt":    "3cdd0edd4ac732057892e4024cb8a5d8ede98907331d5411af49ba3fdcd26e05",
+		"工资.txt":       "0411d22bf3860c8811e4b3fe7c0de303e3fe4429c1f229bafc5ad8c091c5d27c",
+		"子目录/data.bin": "241fe6cf400409c42db83729114b455474ff6b4284532e3daea31d0f4e9103e1",
+	}
+
+	t.Run("decrypt", func(t *testing.T) {
+		zr, err := zip.OpenReader(filepath.Join("testdata", "libarchive-aes256.zip"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = zr.Close() }()
+		for name, sum := range want {
+			f := fileNamed(zr, name)
+			if f == nil || !IsEncrypted(f) {
+				t.Fatalf("%s: missing or not encrypted", name)
+			}
+			rc, err := Open(f, password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rc)
+			_ = rc.Close()
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if got := sha256Hex(data); got != sum {
+				t.Errorf("%s: sha256 %s, want %s", name, got, sum)
+			}
+			if _, err = Open(f, "pass"); !errors.Is(err, ErrPassword) {
+				t.Errorf("%s: wrong password error = %v, want ErrPassword", name, err)
+			}
+		}
+	})
+
+	// bsdtar 解密 Zip 生成的压缩包，没有安装 bsdtar 时跳过
+	t.Run("bsdtar", func(t *testing.T) {
+		bsdtar, err := exec.LookPath("bsdtar")
+		if err != nil {
+			t.Skip("bsdtar not found")
+		}
+		files := map[string][]byte{
+			"hello.txt":    []byte("hello, WinZip AES\n"),
+			"工资.txt":       bytes.Repeat([]byte("工资条 2026-10\n"), 50),
+			"子目录/data.bin": randomBytes(100000, 7),
+		}
+		for _, reproducible := range []bool{false, true} {
+			src := filepath.Join(t.TempDir(), "src")
+			writeFiles(t, src, files)
+			dst := filepath.Join(t.TempDir(), "out.zip")
+			if _, err = Zip(dst, src, Options{Password: password, Reproducible: reproducible}); err != nil {
+				t.Fatal(err)
+			}
+			out := t.TempDir()
+			cmd := exec.Command(bsdtar, "-xf", dst, "-C", out, "--passphrase", password)
+			cmd.Env = append(os.Environ(), "LC_ALL=C.UTF-8")
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("bsdtar: %s\n%s", err, output)
+			}
+			for name, data := range files {
+				got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("reproducible=%v: %s extracted by bsdtar differs", reproducible, name)
+				}
+			}
+		}
+	})
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
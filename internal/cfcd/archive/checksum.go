@@ -0,0 +1,154 @@
+package archive
+
+// 校验和文件
+// 格式与 sha256sum 命令一致，每行为 校验和 + 两个空格 + 文件名，可以使用 sha256sum -c 校验
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SumsFileName 汇总的校验和文件名
+const SumsFileName = "SHA256SUMS"
+
+// SumFileExt 单个文件的校验和文件后缀
+const SumFileExt = ".sha256"
+
+// SumFile 计算文件的 SHA-256 校验和
+func SumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteChecksums 将 sums（文件名 -> 校验和）按文件名排序写入校验和文件 path
+func WriteChecksums(path string, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s  %s\n", sums[name], name)
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0644)
+}
+
+// ReadChecksums 读取校验和文件，返回文件名 -> 校验和
+func ReadChecksums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s: line %d: invalid checksum line", path, lineNum)
+		}
+		// 文件名前的 * 表示二进制模式
+		name := strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+		sums[name] = strings.ToLower(fields[0])
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// FindChecksums 读取目录 dir 中的 SHA256SUMS 和所有 .sha256 文件，返回文件名 -> 校验和
+func FindChecksums(dir string) (map[string]string, error) {
+	sums := make(map[string]string)
+	var sumFiles []string
+	if _, err := os.Stat(filepath.Join(dir, SumsFileName)); err == nil {
+		sumFiles = append(sumFiles, filepath.Join(dir, SumsFileName))
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+SumFileExt))
+	if err != nil {
+		return nil, err
+	}
+	sumFiles = append(sumFiles, matches...)
+
+	for _, sumFile := range sumFiles {
+		fileSums, err := ReadChecksums(sumFile)
+		if err != nil {
+			return nil, err
+		}
+		for name, sum := range fileSums {
+			sums[name] = sum
+		}
+	}
+	return sums, nil
+}
+
+// ErrChecksum 校验和不一致
+var ErrChecksum = errors.New("archive: checksum mismatch")
+
+// VerifyChecksum 校验文件的 SHA-256 校验和
+func VerifyChecksum(path, sum string) error {
+	actual, err := SumFile(path)
+	if err != nil {
+		return err
+	}
+	if actual != strings.ToLower(sum) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// VerifyArchive 读取压缩包中的所有文件，校验 CRC32（加密文件校验认证码）
+// 已加密的文件在未提供密码时无法校验，返回跳过的文件数量
+func VerifyArchive(path, password string) (skipped int, err error) {
+	r, err := OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = r.Close() }()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if IsEncrypted(f) && password == "" {
+			skipped++
+			continue
+		}
+		rc, err := Open(f, password)
+		if err != nil {
+			return skipped, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		_, err = io.Copy(io.Discard, rc)
+		_ = rc.Close()
+		if err != nil {
+			return skipped, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return skipped, nil
+}
@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sha256sum 命令计算的校验和
+const (
+	sumHello = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" // hello
+	sumEmpty = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" // 空文件
+)
+
+func TestWriteChecksums(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{"b.zip": []byte("hello"), "a.zip.001": nil})
+
+	sums := make(map[string]string)
+	for _, name := range []string{"b.zip", "a.zip.001"} {
+		sum, err := SumFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sums[name] = sum
+	}
+	if sums["b.zip"] != sumHello || sums["a.zip.001"] != sumEmpty {
+		t.Fatalf("SumFile = %v", sums)
+	}
+
+	path := filepath.Join(dir, SumsFileName)
+	if err := WriteChecksums(path, sums); err != nil {
+		t.Fatal(err)
+	}
+	// 与 sha256sum 的输出一致，按文件名排序
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sumEmpty + "  a.zip.001\n" + sumHello + "  b.zip\n"; string(data) != want {
+		t.Errorf("SHA256SUMS = %q, want %q", data, want)
+	}
+
+	got, err := ReadChecksums(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sums) {
+		t.Errorf("ReadChecksums = %v, want %v", got, sums)
+	}
+	for name, sum := range sums {
+		if err = VerifyChecksum(filepath.Join(dir, name), sum); err != nil {
+			t.Errorf("VerifyChecksum(%s) = %v", name, err)
+		}
+	}
+	if err = VerifyChecksum(filepath.Join(dir, "b.zip"), sumEmpty); !errors.Is(err, ErrChecksum) {
+		t.Errorf("VerifyChecksum with a wrong sum = %v, want ErrChecksum", err)
+	}
+	if err = VerifyChecksum(filepath.Join(dir, "c.zip"), sumEmpty); !os.IsNotExist(err) {
+		t.Errorf("VerifyChecksum of a missing file = %v, want not exist", err)
+	}
+}
+
+func TestReadChecksums(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"binary mode and comments", "# cfcd\n\n" + strings.ToUpper(sumHello) + " *b.zip\n" + sumEmpty + "  工资 2026.zip\n",
+			map[string]string{"b.zip": sumHello, "工资 2026.zip": sumEmpty}, false},
+		{"short sum", "2cf24dba  b.zip\n", nil, true},
+		{"no name", sumHello + "\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), SumsFileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadChecksums(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadChecksums error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadChecksums = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFindChecksums 合并 SHA256SUMS 和 .sha256 文件
+func TestFindChecksums(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteChecksums(filepath.Join(dir, SumsFileName), map[string]string{"a.zip": sumHello}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteChecksums(filepath.Join(dir, "b.zip"+SumFileExt), map[string]string{"b.zip": sumEmpty}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := FindChecksums(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a.zip": sumHello, "b.zip": sumEmpty}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindChecksums = %v, want %v", got, want)
+	}
+
+	got, err = FindChecksums(t.TempDir())
+	if err != nil || len(got) != 0 {
+		t.Errorf("FindChecksums of an empty dir = %v, %v", got, err)
+	}
+}
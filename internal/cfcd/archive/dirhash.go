@@ -0,0 +1,42 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// HashDir 计算目录内容的 SHA-256 校验和
+// 按文件名顺序遍历目录，依次计算每个文件的相对路径、类型、权限和内容，与文件的修改时间无关
+func HashDir(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, errBack error) error {
+		if errBack != nil {
+			return errBack
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", filepath.ToSlash(rel), fi.Mode())
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		fmt.Fprintf(h, "%d\x00", fi.Size())
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, dir string)
+		changed bool
+	}{
+		{"mtime", func(t *testing.T, dir string) {
+			mtime := time.Now().Add(-time.Hour)
+			if err := os.Chtimes(filepath.Join(dir, "sub", "b.txt"), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"content", func(t *testing.T, dir string) {
+			writeFiles(t, dir, map[string][]byte{"sub/b.txt": []byte("world!")})
+		}, true},
+		{"same size content", func(t *testing.T, dir string) {
+			writeFiles(t, dir, map[string][]byte{"sub/b.txt": []byte("World")})
+		}, true},
+		{"rename", func(t *testing.T, dir string) {
+			if err := os.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "c.txt")); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"new empty file", func(t *testing.T, dir string) {
+			writeFiles(t, dir, map[string][]byte{"empty.txt": nil})
+		}, true},
+		{"new empty dir", func(t *testing.T, dir string) {
+			if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"mode", func(t *testing.T, dir string) {
+			if err := os.Chmod(filepath.Join(dir, "a.txt"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string][]byte{"a.txt": []byte("hello"), "sub/b.txt": []byte("world")})
+			before, err := HashDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, dir)
+			after, err := HashDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (before != after) != tt.changed {
+				t.Errorf("hash changed = %v, want %v", before != after, tt.changed)
+			}
+		})
+	}
+
+	if _, err := HashDir(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("HashDir of a missing dir succeeded")
+	}
+}
@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Reader 压缩包读取，支持分卷压缩包
+type Reader struct {
+	*zip.Reader
+	Files []string // 压缩包的所有文件（分卷）
+	mf    *multiFile
+}
+
+// OpenReader 打开压缩包，分卷压缩包会按顺序组合后读取
+func OpenReader(name string) (*Reader, error) {
+	files, err := Volumes(name)
+	if err != nil {
+		return nil, err
+	}
+	mf, err := openMultiFile(files)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(mf, mf.size)
+	if err != nil {
+		_ = mf.Close()
+		return nil, err
+	}
+	return &Reader{Reader: zr, Files: files, mf: mf}, nil
+}
+
+// Close 关闭压缩包
+func (r *Reader) Close() error {
+	return r.mf.Close()
+}
+
+// Extract 将压缩包 src 解压到目录 dst，已加密的文件使用 password 解密
+func Extract(src, dst, password string) (err error) {
+	r, err := OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	for _, f := range r.File {
+		if err = extractFile(f, dst, password); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, dst, password string) (err error) {
+	// 压缩包中的文件名可能以 / 开头，统一处理成相对路径，并防止解压到 dst 之外
+	name := path.Clean("/" + strings.ReplaceAll(f.Name, `\`, "/"))
+	if name == "/" {
+		return nil
+	}
+	target := filepath.Join(dst, filepath.FromSlash(name[1:]))
+
+	if f.FileInfo().IsDir() {
+		return os.MkdirAll(target, os.ModePerm)
+	}
+	if err = os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	rc, err := Open(f, password)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+
+	perm := f.Mode().Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	fw, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := fw.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	if _, err = io.Copy(fw, rc); err != nil {
+		return err
+	}
+	log.Printf("成功解压文件： %s\n", name[1:])
+	return nil
+}
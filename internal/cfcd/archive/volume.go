@@ -0,0 +1,184 @@
+package archive
+
+// 分卷压缩
+// 压缩包按固定大小切分为 name.zip.001、name.zip.002 ……，与 7-Zip 的分卷格式一致
+// 将所有分卷按顺序拼接起来即为完整的 zip 包
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// volumeWriter 按大小将写入的数据切分到多个分卷文件中
+type volumeWriter struct {
+	base    string
+	size    int64
+	cur     *os.File
+	written int64
+	files   []string
+}
+
+func newVolumeWriter(base string, size int64) *volumeWriter {
+	return &volumeWriter{base: base, size: size}
+}
+
+// VolumeName 第 index 个分卷的文件名，index 从 1 开始
+func VolumeName(base string, index int) string {
+	return fmt.Sprintf("%s.%03d", base, index)
+}
+
+func (v *volumeWriter) next() error {
+	if v.cur != nil {
+		if err := v.cur.Close(); err != nil {
+			return err
+		}
+	}
+	name := VolumeName(v.base, len(v.files)+1)
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	v.cur = f
+	v.written = 0
+	v.files = append(v.files, name)
+	return nil
+}
+
+func (v *volumeWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if v.cur == nil || v.written >= v.size {
+			if err = v.next(); err != nil {
+				return
+			}
+		}
+		chunk := p
+		if rem := v.size - v.written; int64(len(chunk)) > rem {
+			chunk = chunk[:rem]
+		}
+		m, err := v.cur.Write(chunk)
+		n += m
+		v.written += int64(m)
+		p = p[m:]
+		if err != nil {
+			return n, err
+		}
+	}
+	return
+}
+
+// Close 关闭最后一个分卷
+// 如果只生成了一个分卷，则直接重命名为 base，不再使用分卷的文件名
+func (v *volumeWriter) Close() error {
+	if v.cur == nil {
+		return nil
+	}
+	if err := v.cur.Close(); err != nil {
+		return err
+	}
+	if len(v.files) == 1 {
+		if err := os.Rename(v.files[0], v.base); err != nil {
+			return err
+		}
+		v.files[0] = v.base
+	}
+	return nil
+}
+
+// Volumes 获取压缩包的所有文件
+// path 可以是完整的压缩包、第一个分卷 name.zip.001，或分卷的基础文件名 name.zip
+func Volumes(path string) ([]string, error) {
+	base := strings.TrimSuffix(path, ".001")
+	if base == path {
+		if _, err := os.Stat(path); err == nil {
+			return []string{path}, nil
+		}
+	}
+
+	var files []string
+	for i := 1; ; i++ {
+		name := VolumeName(base, i)
+		if _, err := os.Stat(name); err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("archive: %s: %w", path, os.ErrNotExist)
+	}
+	return files, nil
+}
+
+// multiFile 将多个分卷文件组合成一个 io.ReaderAt
+type multiFile struct {
+	files   []*os.File
+	offsets []int64 // 每个分卷在完整压缩包中的起始位置
+	size    int64
+}
+
+func openMultiFile(paths []string) (*multiFile, error) {
+	m := &multiFile{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			_ = m.Close()
+			return nil, err
+		}
+		m.files = append(m.files, f)
+		m.offsets = append(m.offsets, m.size)
+		m.size += fi.Size()
+	}
+	return m, nil
+}
+
+func (m *multiFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("archive: negative offset")
+	}
+	for len(p) > 0 {
+		if off >= m.size {
+			return n, io.EOF
+		}
+		// 找到 off 所在的分卷
+		i := sort.Search(len(m.offsets), func(i int) bool { return m.offsets[i] > off }) - 1
+		end := m.size
+		if i+1 < len(m.offsets) {
+			end = m.offsets[i+1]
+		}
+		chunk := p
+		if rem := end - off; int64(len(chunk)) > rem {
+			chunk = chunk[:rem]
+		}
+		k, err := m.files[i].ReadAt(chunk, off-m.offsets[i])
+		n += k
+		off += int64(k)
+		p = p[k:]
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if k < len(chunk) {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, nil
+}
+
+func (m *multiFile) Close() (err error) {
+	for _, f := range m.files {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumeExtract(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt":          []byte("hello, world\n"),
+		"dir/random.bin": randomBytes(20000, 2),
+		"dir/sub/b.txt":  bytes.Repeat([]byte("volume "), 1000),
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		volumeSize int64
+		open       string // 解压时传入的文件名，相对于压缩包 out.zip
+		volumes    int    // 至少生成的分卷数量，为 0 时只生成 out.zip
+	}{
+		{name: "no volumes", open: "out.zip"},
+		{name: "first volume", volumeSize: 4096, open: "out.zip.001", volumes: 5},
+		{name: "base name", volumeSize: 4096, open: "out.zip", volumes: 5},
+		{name: "encrypted", password: "secret", volumeSize: 1000, open: "out.zip.001", volumes: 20},
+		// 只有一个分卷时直接使用 out.zip
+		{name: "single volume", volumeSize: 1 << 20, open: "out.zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src")
+			writeFiles(t, src, files)
+			out := t.TempDir()
+			dst := filepath.Join(out, "out.zip")
+			written, err := Zip(dst, src, Options{Password: tt.password, VolumeSize: tt.volumeSize})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.volumes == 0 {
+				if len(written) != 1 || written[0] != dst {
+					t.Fatalf("written = %v, want [%s]", written, dst)
+				}
+			} else {
+				if len(written) < tt.volumes {
+					t.Fatalf("written %d volumes, want at least %d", len(written), tt.volumes)
+				}
+				for i, name := range written {
+					if want := VolumeName(dst, i+1); name != want {
+						t.Errorf("volume %d = %s, want %s", i+1, name, want)
+					}
+					fi, err := os.Stat(name)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if fi.Size() > tt.volumeSize {
+						t.Errorf("%s is %d bytes, larger than %d", name, fi.Size(), tt.volumeSize)
+					}
+				}
+			}
+
+			volumes, err := Volumes(filepath.Join(out, tt.open))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(volumes) != len(written) {
+				t.Errorf("Volumes = %v, want %v", volumes, written)
+			}
+
+			extracted := t.TempDir()
+			if err = Extract(filepath.Join(out, tt.open), extracted, tt.password); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range files {
+				got, err := os.ReadFile(filepath.Join(extracted, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s: extracted %d bytes, want %d bytes", name, len(got), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestVolumesMissing(t *testing.T) {
+	if _, err := Volumes(filepath.Join(t.TempDir(), "none.zip")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Volumes of a missing archive = %v, want not exist error", err)
+	}
+}
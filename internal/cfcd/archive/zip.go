@@ -0,0 +1,226 @@
+// Package archive cfcd 压缩实现库
+// zip 格式文档：https://pkware.cachefly.net/webdocs/casestudies/APPNOTE.TXT
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Options 压缩选项
+type Options struct {
+	// Password 不为空时，使用 WinZip AES-256（AE-2）加密压缩包中的文件
+	Password string
+	// VolumeSize 大于 0 时，按该大小（字节）分卷，生成 dst.001、dst.002 ……
+	VolumeSize int64
+	// Reproducible 可重现模式，同一个目录多次压缩生成的压缩包完全相同
+	// 文件按名称排序，修改时间统一为 ModTime，权限统一为 0644（可执行文件为 0755）、目录为 0755
+	// 加密时 salt 由密码、文件名和文件内容生成，而不是随机生成，相同的密码和文件多次加密得到相同的密文，可以据此判断文件是否变化
+	Reproducible bool
+	// ModTime 可重现模式下所有文件的修改时间，为零值时使用 1980-01-01 00:00:00 UTC
+	ModTime time.Time
+}
+
+// MinModTime zip 格式（MS-DOS 时间）能表示的最早时间
+var MinModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Zip 将目录 src 压缩成 zip 包 dst，返回生成的压缩包文件（分卷时为所有分卷）
+func Zip(dst, src string, opts Options) (files []string, err error) {
+	// https://learnku.com/articles/23434/golang-learning-notes-five-archivezip-to-achieve-compression-and-decompression
+	// https://stackoverflow.com/questions/49057032/recursively-zipping-a-directory-in-golang
+
+	// 创建准备写入的文件，分卷时写入到多个分卷文件中
+	fw, written, err := createOutput(dst, opts.VolumeSize)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { files = written() }()
+	defer func() {
+		if closeErr := fw.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	// 通过 fw 来创建 zip.Write
+	zw := zip.NewWriter(fw)
+	defer func() {
+		// 检测一下是否成功关闭
+		if closeErr := zw.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	// 下面来将文件写入 zw ，因为有可能会有很多个目录及文件，所以递归处理
+	return files, filepath.Walk(src, func(path string, fi os.FileInfo, errBack error) (err error) {
+		if errBack != nil {
+			return errBack
+		}
+
+		// 通过文件信息，创建 zip 的文件信息
+		fh, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return
+		}
+
+		// 替换文件信息中的文件名
+		fh.Name = strings.TrimPrefix(path, src)
+
+		// 可重现模式，使用统一的相对路径、修改时间和权限
+		// filepath.Walk 按文件名顺序遍历，保证了文件在压缩包中的顺序
+		if opts.Reproducible {
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			if rel == "." {
+				return nil
+			}
+			fh.Name = filepath.ToSlash(rel)
+			normalizeHeader(fh, fi.Mode(), opts.ModTime)
+		}
+
+		// 这步开始没有加，会发现解压的时候说它不是个目录
+		if fi.IsDir() {
+			fh.Name += "/"
+		}
+
+		// 检测，如果不是标准文件就只写入头信息，不写入文件数据
+		// 如目录，也没有数据需要写
+		if !fh.Mode().IsRegular() {
+			_, err = zw.CreateHeader(fh)
+			return
+		}
+
+		if err = writeFile(zw, fh, path, opts); err != nil {
+			return
+		}
+		// 输出压缩的内容
+		if opts.Password != "" {
+			log.Printf("成功压缩并加密文件： %s\n", fh.Name)
+		} else {
+			log.Printf("成功压缩文件： %s\n", fh.Name)
+		}
+		return nil
+	})
+}
+
+// File 压缩包中的一个文件
+type File struct {
+	Name string // 压缩包中的文件名，使用 / 分隔目录
+	Path string // 要压缩的文件
+}
+
+// ZipFiles 将多个文件压缩成 zip 包 dst，返回生成的压缩包文件（分卷时为所有分卷）
+// 与 Zip 不同，压缩包中的文件名由调用方指定，不会输出每个文件的压缩日志
+func ZipFiles(dst string, srcFiles []File, opts Options) (files []string, err error) {
+	fw, written, err := createOutput(dst, opts.VolumeSize)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { files = written() }()
+	defer func() {
+		if closeErr := fw.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	zw := zip.NewWriter(fw)
+	defer func() {
+		if closeErr := zw.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	for _, f := range srcFiles {
+		fi, err := os.Stat(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", f.Path)
+		}
+		fh, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return nil, err
+		}
+		fh.Name = f.Name
+		fh.Method = zip.Deflate
+		if opts.Reproducible {
+			normalizeHeader(fh, fi.Mode(), opts.ModTime)
+		}
+		if err = writeFile(zw, fh, f.Path, opts); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// createOutput 创建准备写入的文件，分卷时写入到多个分卷文件中，written 返回已生成的文件
+func createOutput(dst string, volumeSize int64) (fw io.WriteCloser, written func() []string, err error) {
+	if volumeSize > 0 {
+		vw := newVolumeWriter(dst, volumeSize)
+		return vw, func() []string { return vw.files }, nil
+	}
+	if fw, err = os.Create(dst); err != nil {
+		return nil, nil, err
+	}
+	return fw, func() []string { return []string{dst} }, nil
+}
+
+// writeFile 将普通文件写入压缩包，设置了密码时加密
+func writeFile(zw *zip.Writer, fh *zip.FileHeader, path string, opts Options) error {
+	// 需要加密的普通文件单独处理
+	if opts.Password != "" {
+		return writeEncryptedFile(zw, fh, path, opts.Password, opts.Reproducible)
+	}
+
+	// 写入文件信息，并返回一个 Write 结构
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+
+	// 打开要压缩的文件
+	fr, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fr.Close() }()
+
+	// 将打开的文件 Copy 到 w
+	_, err = io.Copy(w, fr)
+	return err
+}
+
+// normalizeHeader 统一文件的修改时间和权限
+func normalizeHeader(fh *zip.FileHeader, mode os.FileMode, modTime time.Time) {
+	if modTime.Before(MinModTime) {
+		modTime = MinModTime
+	}
+	// 使用 UTC 时间，避免不同时区生成的 MS-DOS 时间不一致
+	fh.Modified = modTime.UTC()
+	fh.ModifiedDate, fh.ModifiedTime = msDosTime(fh.Modified)
+
+	switch {
+	case mode.IsDir():
+		fh.SetMode(os.ModeDir | 0755)
+	case mode.IsRegular() && mode&0111 != 0:
+		fh.SetMode(0755)
+	case mode.IsRegular():
+		fh.SetMode(0644)
+	}
+}
+
+// msDosTime 将时间转换为 zip 文件头中的 MS-DOS 日期和时间
+// CreateRaw 不会根据 Modified 重新计算，因此需要手动设置
+func msDosTime(t time.Time) (date, tm uint16) {
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestReproducible 可重现模式下，文件的修改时间和权限变化后，压缩包的内容完全相同
+func TestReproducible(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"plain", Options{Reproducible: true}},
+		{"encrypted", Options{Reproducible: true, Password: "密码 secret"}},
+		{"volumes", Options{Reproducible: true, Password: "secret", VolumeSize: 4096}},
+		{"mod time", Options{Reproducible: true, ModTime: time.Date(2026, 10, 1, 8, 0, 0, 0, time.FixedZone("", 8*3600))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "工资")
+			writeFiles(t, src, map[string][]byte{
+				"a.txt":           []byte("hello"),
+				"sub/b.bin":       randomBytes(10000, 1),
+				"sub/deep/中文.txt": []byte("你好"),
+				"empty.txt":       nil,
+			})
+
+			first := zipBytes(t, src, tt.opts)
+
+			// 修改文件和目录的修改时间和权限
+			mtime := time.Now().Add(-48 * time.Hour)
+			for path, mode := range map[string]os.FileMode{
+				"a.txt":     0600,
+				"sub/b.bin": 0640,
+				"sub":       0700,
+				"sub/deep":  0750,
+				"empty.txt": 0444,
+			} {
+				path = filepath.Join(src, filepath.FromSlash(path))
+				if err := os.Chmod(path, mode); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Chtimes(src, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			second := zipBytes(t, src, tt.opts)
+			if len(first) != len(second) {
+				t.Fatalf("%d files, then %d files", len(first), len(second))
+			}
+			for i := range first {
+				if !bytes.Equal(first[i], second[i]) {
+					t.Errorf("file %d differs after changing mtimes and permissions", i)
+				}
+			}
+		})
+	}
+}
+
+// TestReproducibleContentChanged 文件内容变化后压缩包不同
+func TestReproducibleContentChanged(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string][]byte{"a.txt": []byte("hello")})
+	opts := Options{Reproducible: true, Password: "secret"}
+	first := zipBytes(t, src, opts)
+	writeFiles(t, src, map[string][]byte{"a.txt": []byte("hellp")})
+	if second := zipBytes(t, src, opts); bytes.Equal(first[0], second[0]) {
+		t.Error("archive unchanged after changing a file")
+	}
+}
+
+// zipBytes 将 src 压缩到新的临时目录中，返回每个生成的文件的内容
+func zipBytes(t *testing.T, src string, opts Options) [][]byte {
+	t.Helper()
+	files, err := Zip(filepath.Join(t.TempDir(), "out.zip"), src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data [][]byte
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b)
+	}
+	return data
+}
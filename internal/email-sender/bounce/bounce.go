@@ -0,0 +1,249 @@
+// Package bounce 解析退信
+// 标准的退信为 multipart/report; report-type=delivery-status（RFC 3464 DSN），
+// 其中包含失败的收件人、状态码和原邮件的邮件头；不标准的退信通过正文中的 Message-ID 匹配原邮件
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Recipient 一个收件人的投递状态
+type Recipient struct {
+	Address    string // 收件人邮箱
+	Action     string // failed、delayed、delivered、relayed、expanded
+	Status     string // 状态码，如 5.1.1
+	Diagnostic string // 服务器返回的错误信息
+}
+
+// Failed 是否为永久失败
+// 以 Action 为准，delayed、relayed 等即使状态码为 5.x.x 也不是失败；没有 Action 时根据状态码判断
+func (r Recipient) Failed() bool {
+	if r.Action != "" {
+		return strings.EqualFold(r.Action, "failed")
+	}
+	return strings.HasPrefix(r.Status, "5.")
+}
+
+// Report 一封退信
+type Report struct {
+	// MessageIDs 退信中引用的原邮件的 Message-ID
+	MessageIDs []string
+	// Recipients 退信中的收件人状态，不是标准的 DSN 时为空
+	Recipients []Recipient
+	// DSN 是否为标准的 multipart/report 退信
+	DSN     bool
+	Subject string
+}
+
+// Bounced 是否为退信，标准的 DSN 中至少有一个收件人投递失败，只有延迟投递等通知时不是退信
+// 不标准的退信无法获取收件人状态，总是作为退信
+func (r *Report) Bounced() bool {
+	if !r.DSN {
+		return true
+	}
+	for _, rcpt := range r.Recipients {
+		if rcpt.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse 解析退信，msg 不是退信时返回 nil
+func Parse(msg []byte) (*Report, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Subject: decodeHeader(m.Header.Get("Subject"))}
+	mediaType, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if strings.EqualFold(mediaType, "multipart/report") && strings.EqualFold(params["report-type"], "delivery-status") {
+		report.DSN = true
+		if err = report.parseDSN(m.Body, params["boundary"]); err != nil {
+			return nil, err
+		}
+		return report, nil
+	}
+	if !IsBounce(m.Header) {
+		return nil, nil
+	}
+	body, err := io.ReadAll(m.Body)
+	if err != nil {
+		return nil, err
+	}
+	report.MessageIDs = findMessageIDs(body)
+	return report, nil
+}
+
+// IsBounce 根据邮件头判断是否可能为退信
+func IsBounce(h mail.Header) bool {
+	mediaType, params, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if strings.EqualFold(mediaType, "multipart/report") && strings.EqualFold(params["report-type"], "delivery-status") {
+		return true
+	}
+	from := strings.ToLower(h.Get("From"))
+	for _, v := range []string{"mailer-daemon", "postmaster"} {
+		if strings.Contains(from, v) {
+			return true
+		}
+	}
+	return h.Get("Return-Path") == "<>"
+}
+
+func (r *Report) parseDSN(body io.Reader, boundary string) error {
+	if boundary == "" {
+		return fmt.Errorf("multipart/report without boundary")
+	}
+	mr := multipart.NewReader(body, boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		data, err := io.ReadAll(p)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(mediaType) {
+		case "message/delivery-status", "message/global-delivery-status":
+			if r.Recipients, err = parseDeliveryStatus(data); err != nil {
+				return err
+			}
+		case "text/rfc822-headers", "message/rfc822", "message/global", "message/global-headers":
+			h, err := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(data), strings.NewReader("\r\n\r\n")))).ReadMIMEHeader()
+			if err == nil && h.Get("Message-Id") != "" {
+				r.MessageIDs = append(r.MessageIDs, strings.TrimSpace(h.Get("Message-Id")))
+			}
+		}
+	}
+	return nil
+}
+
+// parseDeliveryStatus 解析 message/delivery-status，第一组字段为整封邮件的信息，之后每组为一个收件人
+func parseDeliveryStatus(data []byte) ([]Recipient, error) {
+	tp := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(data), strings.NewReader("\r\n\r\n"))))
+	var rcpts []Recipient
+	for i := 0; ; i++ {
+		h, err := tp.ReadMIMEHeader()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(h) == 0 {
+			if err == io.EOF || i > 0 {
+				break
+			}
+			continue
+		}
+		if rcpt := h.Get("Final-Recipient"); i > 0 || rcpt != "" {
+			if rcpt == "" {
+				rcpt = h.Get("Original-Recipient")
+			}
+			r := Recipient{
+				Address:    addressOf(rcpt),
+				Action:     strings.ToLower(strings.TrimSpace(h.Get("Action"))),
+				Diagnostic: diagnosticOf(h.Get("Diagnostic-Code")),
+			}
+			// 格式不正确的 DSN 可能没有 Status
+			if fields := strings.Fields(h.Get("Status")); len(fields) > 0 {
+				r.Status = fields[0]
+			}
+			rcpts = append(rcpts, r)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return rcpts, nil
+}
+
+// addressOf 去掉地址类型，如 rfc822; user@example.com
+func addressOf(v string) string {
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.Trim(strings.TrimSpace(v), "<>")
+}
+
+// diagnosticOf 去掉诊断信息类型，如 smtp; 550 5.1.1 User unknown
+func diagnosticOf(v string) string {
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.Join(strings.Fields(v), " ")
+}
+
+var messageIDRegexp = regexp.MustCompile(`(?i)Message-ID:\s*(<[^<>\s]+>)`)
+
+// findMessageIDs 在不标准的退信正文中查找原邮件的 Message-ID
+func findMessageIDs(body []byte) []string {
+	var ids []string
+	for _, m := range messageIDRegexp.FindAllSubmatch(body, -1) {
+		ids = append(ids, string(m[1]))
+	}
+	return ids
+}
+
+func decodeHeader(v string) string {
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(v); err == nil {
+		return decoded
+	}
+	return v
+}
+
+// NewDSN 生成一封标准的退信，用于测试
+// from 为退信的收件人（原邮件的发件人），orig 为原邮件，rcpts 为投递失败的收件人
+func NewDSN(reportingMTA, from string, orig []byte, rcpts []Recipient) ([]byte, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(orig))
+	if err != nil {
+		return nil, err
+	}
+	var headers bytes.Buffer
+	for k, vs := range m.Header {
+		for _, v := range vs {
+			fmt.Fprintf(&headers, "%s: %s\r\n", k, v)
+		}
+	}
+	boundary := fmt.Sprintf("dsn-%d", time.Now().UnixNano())
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: Mail Delivery System <MAILER-DAEMON@%s>\r\n", reportingMTA)
+	fmt.Fprintf(&b, "To: <%s>\r\n", from)
+	fmt.Fprintf(&b, "Subject: Undelivered Mail Returned to Sender\r\n")
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%d.dsn@%s>\r\n", time.Now().UnixNano(), reportingMTA)
+	fmt.Fprintf(&b, "Auto-Submitted: auto-replied\r\n")
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/report; report-type=delivery-status; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "Your message could not be delivered to the following recipients:\r\n\r\n")
+	for _, rcpt := range rcpts {
+		fmt.Fprintf(&b, "<%s>: %s\r\n", rcpt.Address, rcpt.Diagnostic)
+	}
+
+	fmt.Fprintf(&b, "\r\n--%s\r\nContent-Type: message/delivery-status\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "Reporting-MTA: dns; %s\r\nArrival-Date: %s\r\n", reportingMTA, time.Now().Format(time.RFC1123Z))
+	for _, rcpt := range rcpts {
+		fmt.Fprintf(&b, "\r\nFinal-Recipient: rfc822; %s\r\nAction: %s\r\nStatus: %s\r\nDiagnostic-Code: smtp; %s\r\n",
+			rcpt.Address, rcpt.Action, rcpt.Status, rcpt.Diagnostic)
+	}
+
+	fmt.Fprintf(&b, "\r\n--%s\r\nContent-Type: text/rfc822-headers\r\n\r\n", boundary)
+	b.Write(headers.Bytes())
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
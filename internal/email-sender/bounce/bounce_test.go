@@ -0,0 +1,192 @@
+package bounce
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file       string
+		nilReport  bool
+		dsn        bool
+		subject    string
+		messageIDs []string
+		recipients []Recipient
+		failed     []string // 投递失败的收件人
+		bounced    bool
+	}{
+		{
+			file:       "postfix.eml",
+			dsn:        true,
+			subject:    "Undelivered Mail Returned to Sender",
+			messageIDs: []string{"<1792404266.3b8c4966@example.com>"},
+			recipients: []Recipient{
+				{
+					Address:    "nobody@invalid.example",
+					Action:     "failed",
+					Status:     "5.1.1",
+					Diagnostic: "550 5.1.1 <nobody@invalid.example>: Recipient address rejected: User unknown",
+				},
+				{Address: "ok@example.net", Action: "delivered", Status: "2.0.0"},
+			},
+			failed:  []string{"nobody@invalid.example"},
+			bounced: true,
+		},
+		{
+			// 没有 Final-Recipient，原邮件为 message/rfc822
+			file:       "exchange.eml",
+			dsn:        true,
+			subject:    "无法传递: test",
+			messageIDs: []string{"<ex.1@example.com>"},
+			recipients: []Recipient{
+				{
+					Address:    "gone@example.org",
+					Action:     "failed",
+					Status:     "5.4.1",
+					Diagnostic: "550 5.4.1 Recipient address rejected: Access denied",
+				},
+			},
+			failed:  []string{"gone@example.org"},
+			bounced: true,
+		},
+		{
+			// 延迟投递通知，即使状态码为 5.x.x 也不是退信
+			file:       "delayed.eml",
+			dsn:        true,
+			subject:    "Delayed Mail (still being retried)",
+			messageIDs: []string{"<delay.1@example.com>"},
+			recipients: []Recipient{
+				{Address: "slow@example.net", Action: "delayed", Status: "5.0.0", Diagnostic: "mailbox temporarily unavailable"},
+				{Address: "relay@example.net", Action: "relayed", Status: "5.0.0"},
+			},
+			bounced: false,
+		},
+		{
+			// 缺少 Status 或 Action 的 DSN
+			file:       "nostatus.eml",
+			dsn:        true,
+			subject:    "failure notice",
+			messageIDs: []string{"<nostatus.1@example.com>"},
+			recipients: []Recipient{
+				{Address: "nostatus@example.net", Action: "failed"},
+				{Address: "noaction@example.net", Status: "5.2.2"},
+				{Address: "tempfail@example.net", Status: "4.2.2"},
+			},
+			failed:  []string{"nostatus@example.net", "noaction@example.net"},
+			bounced: true,
+		},
+		{
+			// 不标准的退信，从正文中查找 Message-ID
+			file:       "qmail.eml",
+			subject:    "failure notice",
+			messageIDs: []string{"<qmail.1@example.com>"},
+			bounced:    true,
+		},
+		{
+			// 普通邮件
+			file:      "reply.eml",
+			nilReport: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			msg, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			report, err := Parse(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.nilReport {
+				if report != nil {
+					t.Errorf("Parse = %+v, want nil", report)
+				}
+				return
+			}
+			if report == nil {
+				t.Fatal("Parse = nil")
+			}
+			if report.DSN != tt.dsn {
+				t.Errorf("DSN = %v, want %v", report.DSN, tt.dsn)
+			}
+			if report.Subject != tt.subject {
+				t.Errorf("Subject = %q, want %q", report.Subject, tt.subject)
+			}
+			if !reflect.DeepEqual(report.MessageIDs, tt.messageIDs) {
+				t.Errorf("MessageIDs = %q, want %q", report.MessageIDs, tt.messageIDs)
+			}
+			if !reflect.DeepEqual(report.Recipients, tt.recipients) {
+				t.Errorf("Recipients = %+v, want %+v", report.Recipients, tt.recipients)
+			}
+			var failed []string
+			for _, rcpt := range report.Recipients {
+				if rcpt.Failed() {
+					failed = append(failed, rcpt.Address)
+				}
+			}
+			if !reflect.DeepEqual(failed, tt.failed) {
+				t.Errorf("failed recipients = %q, want %q", failed, tt.failed)
+			}
+			if report.Bounced() != tt.bounced {
+				t.Errorf("Bounced = %v, want %v", report.Bounced(), tt.bounced)
+			}
+		})
+	}
+}
+
+func TestNewDSN(t *testing.T) {
+	orig := []byte("From: hr@example.com\r\nTo: a@example.org, b@example.org\r\nSubject: test\r\n" +
+		"Message-Id: <orig.1@example.com>\r\n\r\nhello\r\n")
+	rcpts := []Recipient{
+		{Address: "a@example.org", Action: "failed", Status: "5.1.1", Diagnostic: "550 5.1.1 User unknown"},
+		{Address: "b@example.org", Action: "failed", Status: "5.2.2", Diagnostic: "552 5.2.2 Mailbox full"},
+	}
+	dsn, err := NewDSN("sink.localhost", "hr@example.com", orig, rcpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report == nil || !report.DSN || !report.Bounced() {
+		t.Fatalf("Parse = %+v, want a bounced DSN", report)
+	}
+	if !reflect.DeepEqual(report.MessageIDs, []string{"<orig.1@example.com>"}) {
+		t.Errorf("MessageIDs = %q", report.MessageIDs)
+	}
+	if !reflect.DeepEqual(report.Recipients, rcpts) {
+		t.Errorf("Recipients = %+v, want %+v", report.Recipients, rcpts)
+	}
+}
+
+func TestRecipientFailed(t *testing.T) {
+	tests := []struct {
+		action, status string
+		want           bool
+	}{
+		{"failed", "5.1.1", true},
+		{"FAILED", "", true},
+		{"failed", "4.4.7", true},
+		{"delayed", "5.0.0", false},
+		{"relayed", "5.0.0", false},
+		{"delivered", "2.0.0", false},
+		{"", "5.1.1", true},
+		{"", "4.2.2", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		name := strings.TrimSpace(tt.action + " " + tt.status)
+		t.Run(name, func(t *testing.T) {
+			if got := (Recipient{Action: tt.action, Status: tt.status}).Failed(); got != tt.want {
+				t.Errorf("Failed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
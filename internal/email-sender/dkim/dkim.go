@@ -0,0 +1,354 @@
+// Package dkim DKIM 签名（RFC 6376），支持 rsa-sha256 和 ed25519-sha256（RFC 8463）
+// 使用 relaxed/relaxed 规范化算法
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultHeaders 默认签名的邮件头，邮件中不存在的邮件头不签名
+var DefaultHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-Id",
+	"Mime-Version", "Content-Type", "Content-Transfer-Encoding", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// Signer DKIM 签名
+type Signer struct {
+	Domain   string // 签名域名（d=），需要与发件人邮箱的域名一致才能通过 DMARC 检查
+	Selector string // 选择器（s=），公钥发布在 <selector>._domainkey.<domain> 的 TXT 记录中
+	Key      crypto.Signer
+	// Headers 签名的邮件头，为空时使用 DefaultHeaders
+	Headers []string
+}
+
+// NewSigner 读取私钥文件（PEM 格式，PKCS#1 或 PKCS#8），创建签名
+func NewSigner(domain, selector, keyFile string) (*Signer, error) {
+	if domain == "" || selector == "" {
+		return nil, errors.New("dkim domain and selector are required")
+	}
+	key, err := LoadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{Domain: domain, Selector: selector, Key: key}, nil
+}
+
+// LoadPrivateKey 读取 PEM 格式的 RSA 或 Ed25519 私钥
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found in %s", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key %s: %w", path, err)
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+func algorithm(key interface{}) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return "rsa-sha256", nil
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return "ed25519-sha256", nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+// Sign 对完整的邮件内容签名，返回添加了 DKIM-Signature 邮件头的邮件
+func (s *Signer) Sign(msg []byte) ([]byte, error) {
+	algo, err := algorithm(s.Key)
+	if err != nil {
+		return nil, err
+	}
+	headers, body, err := splitMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	names := s.Headers
+	if len(names) == 0 {
+		names = DefaultHeaders
+	}
+	var signed []string
+	for _, name := range names {
+		if _, ok := lastHeader(headers, name, nil); ok {
+			signed = append(signed, strings.ToLower(name))
+		}
+	}
+	if _, ok := lastHeader(headers, "From", nil); !ok {
+		return nil, errors.New("message has no From header")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	value := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n t=%d; h=%s;\r\n bh=%s;\r\n b=",
+		algo, s.Domain, s.Selector, time.Now().Unix(), strings.Join(signed, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+
+	sig, err := sign(s.Key, headerHash(headers, signed, "DKIM-Signature: "+value))
+	if err != nil {
+		return nil, err
+	}
+	value += fold(base64.StdEncoding.EncodeToString(sig))
+
+	var buf bytes.Buffer
+	buf.WriteString("DKIM-Signature: " + value + "\r\n")
+	buf.Write(msg)
+	return buf.Bytes(), nil
+}
+
+func sign(key crypto.Signer, hash []byte) ([]byte, error) {
+	if k, ok := key.(ed25519.PrivateKey); ok {
+		// RFC 8463：对 SHA-256 摘要进行 Ed25519 签名
+		return ed25519.Sign(k, hash), nil
+	}
+	return key.Sign(rand.Reader, hash, crypto.SHA256)
+}
+
+// fold 将签名折行，每行 72 个字符
+func fold(s string) string {
+	var b strings.Builder
+	for len(s) > 72 {
+		b.WriteString(s[:72] + "\r\n ")
+		s = s[72:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// header 一个邮件头，Raw 为原始内容（包括折行，不包括最后的 CRLF）
+type header struct {
+	Name string
+	Raw  string
+}
+
+// splitMessage 将邮件拆分为邮件头和正文
+func splitMessage(msg []byte) ([]header, []byte, error) {
+	msg = bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n"))
+	msg = bytes.ReplaceAll(msg, []byte("\n"), []byte("\r\n"))
+	end := bytes.Index(msg, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, nil, errors.New("message has no body")
+	}
+	var headers []header
+	for _, line := range strings.SplitAfter(string(msg[:end+2]), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].Raw += line
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, nil, fmt.Errorf("invalid header line %q", strings.TrimSpace(line))
+		}
+		headers = append(headers, header{Name: line[:i], Raw: line})
+	}
+	for i := range headers {
+		headers[i].Raw = strings.TrimSuffix(headers[i].Raw, "\r\n")
+	}
+	return headers, msg[end+4:], nil
+}
+
+// lastHeader 从下往上查找名为 name 且没有被使用过的邮件头（RFC 6376 5.4.2）
+func lastHeader(headers []header, name string, used map[int]bool) (int, bool) {
+	for i := len(headers) - 1; i >= 0; i-- {
+		if strings.EqualFold(headers[i].Name, name) && !used[i] {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// headerHash 计算签名的邮件头和 DKIM-Signature（b= 为空）规范化后的 SHA-256 摘要
+func headerHash(headers []header, signed []string, sigHeader string) []byte {
+	h := sha256.New()
+	used := make(map[int]bool)
+	for _, name := range signed {
+		i, ok := lastHeader(headers, name, used)
+		if !ok {
+			// 签名中包含但邮件中不存在的邮件头按空处理
+			continue
+		}
+		used[i] = true
+		h.Write([]byte(relaxedHeader(headers[i].Raw) + "\r\n"))
+	}
+	h.Write([]byte(relaxedHeader(sigHeader)))
+	return h.Sum(nil)
+}
+
+var wspRe = regexp.MustCompile(`[ \t]+`)
+
+// relaxedHeader relaxed 规范化邮件头：名称转小写，去掉折行，连续空白替换为一个空格，去掉冒号两边和末尾的空白
+func relaxedHeader(raw string) string {
+	i := strings.IndexByte(raw, ':')
+	name := strings.ToLower(strings.TrimSpace(raw[:i]))
+	value := strings.ReplaceAll(raw[i+1:], "\r\n", "")
+	value = strings.TrimSpace(wspRe.ReplaceAllString(value, " "))
+	return name + ":" + value
+}
+
+// relaxedBody relaxed 规范化正文：行内连续空白替换为一个空格，去掉行尾空白和末尾的空行
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(wspRe.ReplaceAllString(line, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// Verify 使用公钥校验邮件中的第一个 DKIM-Signature，不查询 DNS，用于离线检查签名
+// pub 为 *rsa.PublicKey 或 ed25519.PublicKey，可以使用 ParsePublicKeyRecord 从 DNS TXT 记录中解析
+func Verify(msg []byte, pub crypto.PublicKey) error {
+	headers, body, err := splitMessage(msg)
+	if err != nil {
+		return err
+	}
+	idx, ok := -1, false
+	for i, h := range headers {
+		if strings.EqualFold(h.Name, "DKIM-Signature") {
+			idx, ok = i, true
+			break
+		}
+	}
+	if !ok {
+		return errors.New("no DKIM-Signature header")
+	}
+	raw := headers[idx].Raw
+	tags := parseTags(raw[strings.IndexByte(raw, ':')+1:])
+
+	algo, err := algorithm(pub)
+	if err != nil {
+		return err
+	}
+	if tags["a"] != algo {
+		return fmt.Errorf("signature algorithm %q does not match the key %q", tags["a"], algo)
+	}
+	if tags["c"] != "relaxed/relaxed" {
+		return fmt.Errorf("unsupported canonicalization %q", tags["c"])
+	}
+	if _, ok := tags["l"]; ok {
+		return errors.New("body length tag is not supported")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		return errors.New("body hash mismatch")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	// 去掉 b= 的值
+	sigHeader := bTagRe.ReplaceAllString(raw, "${1}")
+	var signed []string
+	for _, name := range strings.Split(tags["h"], ":") {
+		signed = append(signed, strings.TrimSpace(name))
+	}
+	hash := headerHash(append(headers[:idx:idx], headers[idx+1:]...), signed, sigHeader)
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash, sig)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, hash, sig) {
+			err = errors.New("ed25519 verification failed")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("signature mismatch: %w", err)
+	}
+	return nil
+}
+
+var bTagRe = regexp.MustCompile(`((?:^|;)\s*b\s*=)[^;]*`)
+
+// parseTags 解析 tag=value 列表，值中的空白会被去掉
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		i := strings.IndexByte(part, '=')
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(part[:i])
+		value := strings.Join(strings.Fields(part[i+1:]), "")
+		tags[key] = value
+	}
+	return tags
+}
+
+// PublicKeyRecord 生成需要发布在 <selector>._domainkey.<domain> 的 DNS TXT 记录
+func PublicKeyRecord(key crypto.Signer) (string, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", err
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub), nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+// ParsePublicKeyRecord 从 DNS TXT 记录中解析公钥
+func ParsePublicKeyRecord(record string) (crypto.PublicKey, error) {
+	tags := parseTags(record)
+	data, err := base64.StdEncoding.DecodeString(tags["p"])
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid public key in record")
+	}
+	switch tags["k"] {
+	case "", "rsa":
+		pub, err := x509.ParsePKIXPublicKey(data)
+		if err != nil {
+			// 部分记录使用 PKCS#1 格式
+			return x509.ParsePKCS1PublicKey(data)
+		}
+		return pub, nil
+	case "ed25519":
+		if len(data) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 public key size")
+		}
+		return ed25519.PublicKey(data), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", tags["k"])
+}
@@ -0,0 +1,235 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rfc8463Message RFC 8463 附录 A.3 中使用 Ed25519 签名的邮件
+const rfc8463Message = `DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;
+ d=football.example.com; i=@football.example.com;
+ q=dns/txt; s=brisbane; t=1528637909; h=from : to :
+ subject : date : message-id : from : subject : date;
+ bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;
+ b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus
+ Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==
+From: Joe SixPack <joe@football.example.com>
+To: Suzie Q <suzie@shopping.example.net>
+Subject: Is dinner ready?
+Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)
+Message-ID: <20030712040037.46341.5F8J@football.example.com>
+
+Hi.
+
+We lost the game.  Are you hungry yet?
+
+Joe.
+`
+
+// rfc8463Record RFC 8463 附录 A.2 中发布的公钥
+const rfc8463Record = "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+
+const testMessage = "From: =?utf-8?q?=E4=BA=BA=E5=8A=9B=E8=B5=84=E6=BA=90=E9=83=A8?= <hr@example.com>\r\n" +
+	"To: you@example.com\r\n" +
+	"Subject: test\r\n" +
+	"Date: Mon, 19 Oct 2026 09:00:00 +0800\r\n" +
+	"Message-Id: <1.2@example.com>\r\n" +
+	"Mime-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"hello  world \r\n" +
+	"\r\n"
+
+func crlf(s string) []byte {
+	return []byte(strings.ReplaceAll(s, "\n", "\r\n"))
+}
+
+func TestVerifyRFC8463(t *testing.T) {
+	pub, err := ParsePublicKeyRecord(rfc8463Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Verify(crlf(rfc8463Message), pub); err != nil {
+		t.Errorf("Verify: %s", err)
+	}
+
+	// RFC 8463 附录 A.1 中的私钥生成的公钥与 DNS 记录一致
+	seed, _ := base64.StdEncoding.DecodeString("nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A=")
+	record, err := PublicKeyRecord(ed25519.NewKeyFromSeed(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record != rfc8463Record {
+		t.Errorf("PublicKeyRecord = %q, want %q", record, rfc8463Record)
+	}
+
+	tampered := strings.Replace(rfc8463Message, "We lost the game.", "We won the game.", 1)
+	if err = Verify(crlf(tampered), pub); err == nil {
+		t.Error("Verify of a tampered body succeeded")
+	}
+}
+
+func TestCanonicalization(t *testing.T) {
+	// RFC 6376 3.4.5 的示例
+	headers, body, err := splitMessage([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, h := range headers {
+		got = append(got, relaxedHeader(h.Raw))
+	}
+	if want := "a:X\r\nb:Y Z"; strings.Join(got, "\r\n") != want {
+		t.Errorf("relaxed headers = %q, want %q", strings.Join(got, "\r\n"), want)
+	}
+	if want := " C\r\nD E\r\n"; string(relaxedBody(body)) != want {
+		t.Errorf("relaxed body = %q, want %q", relaxedBody(body), want)
+	}
+	if got := relaxedBody([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Errorf("relaxed empty body = %q, want empty", got)
+	}
+}
+
+// writeKey 将私钥以 PEM 格式写入临时文件
+func writeKey(t *testing.T, key crypto.Signer, pkcs1 bool) string {
+	t.Helper()
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	if k, ok := key.(*rsa.PrivateKey); ok && pkcs1 {
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Bytes = der
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		key   crypto.Signer
+		pkcs1 bool
+		algo  string
+	}{
+		{"rsa pkcs1", rsaKey, true, "rsa-sha256"},
+		{"rsa pkcs8", rsaKey, false, "rsa-sha256"},
+		{"ed25519", edKey, false, "ed25519-sha256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSigner("example.com", "sel", writeKey(t, tt.key, tt.pkcs1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, err := s.Sign([]byte(testMessage))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sigHeader := string(signed[:len(signed)-len(testMessage)])
+			for _, tag := range []string{"a=" + tt.algo, "d=example.com", "s=sel",
+				"h=from:subject:date:to:message-id:mime-version:content-type"} {
+				if !strings.Contains(sigHeader, tag) {
+					t.Errorf("signature %q has no %s", sigHeader, tag)
+				}
+			}
+
+			record, err := PublicKeyRecord(s.Key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub, err := ParsePublicKeyRecord(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = Verify(signed, pub); err != nil {
+				t.Fatalf("Verify: %s", err)
+			}
+
+			// relaxed 规范化：邮件头大小写和空白、正文行尾空白和末尾空行的变化不影响签名
+			relaxed := strings.Replace(string(signed), "Subject: test", "SUBJECT:   test ", 1)
+			relaxed = strings.Replace(relaxed, "hello  world \r\n", "hello world\r\n", 1) + "\r\n\r\n"
+			if err = Verify([]byte(relaxed), pub); err != nil {
+				t.Errorf("Verify relaxed changes: %s", err)
+			}
+
+			// 以 LF 换行的邮件同样可以校验
+			if err = Verify([]byte(strings.ReplaceAll(string(signed), "\r\n", "\n")), pub); err != nil {
+				t.Errorf("Verify LF message: %s", err)
+			}
+
+			otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+			failures := []struct {
+				name string
+				msg  string
+				pub  crypto.PublicKey
+			}{
+				{"body changed", strings.Replace(string(signed), "hello", "HELLO", 1), pub},
+				{"signed header changed", strings.Replace(string(signed), "Subject: test", "Subject: other", 1), pub},
+				{"from added", "From: evil@example.net\r\n" + strings.Replace(string(signed), "\r\n\r\n", "\r\nFrom: x@example.net\r\n\r\n", 1), pub},
+				{"no signature", testMessage, pub},
+				{"wrong key", string(signed), otherKey},
+			}
+			for _, f := range failures {
+				if err = Verify([]byte(f.msg), f.pub); err == nil {
+					t.Errorf("Verify %s succeeded", f.name)
+				}
+			}
+		})
+	}
+}
+
+func TestSignerErrors(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		name     string
+		domain   string
+		selector string
+		keyFile  func(t *testing.T) string
+	}{
+		{"no domain", "", "sel", func(t *testing.T) string { return writeKey(t, edKey, false) }},
+		{"no selector", "example.com", "", func(t *testing.T) string { return writeKey(t, edKey, false) }},
+		{"missing key", "example.com", "sel", func(t *testing.T) string { return filepath.Join(t.TempDir(), "none.pem") }},
+		{"not pem", "example.com", "sel", func(t *testing.T) string {
+			path := filepath.Join(t.TempDir(), "key.pem")
+			_ = os.WriteFile(path, []byte("not a key"), 0600)
+			return path
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSigner(tt.domain, tt.selector, tt.keyFile(t)); err == nil {
+				t.Error("NewSigner succeeded")
+			}
+		})
+	}
+
+	s := &Signer{Domain: "example.com", Selector: "sel", Key: edKey}
+	if _, err := s.Sign([]byte("To: you@example.com\r\n\r\nbody\r\n")); err == nil {
+		t.Error("Sign of a message without From succeeded")
+	}
+}
@@ -0,0 +1,138 @@
+// Package httpsink 用于测试的 HTTP 邮件 API
+// 基于 httptest，接收并记录所有 JSON 请求，不会投递，可以校验 Bearer token 和模拟失败
+package httpsink
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request 接收到的请求
+type Request struct {
+	ID     string
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+	JSON   map[string]interface{} // 请求体解析后的内容
+	TLS    bool
+	Time   time.Time
+}
+
+// Server 测试用 HTTP 邮件 API，任意路径都可以接收请求
+type Server struct {
+	// Addr 监听地址，默认为 127.0.0.1:0（随机端口），Start 后为实际监听的地址
+	Addr string
+	// TLSConfig 不为空时使用 HTTPS
+	TLSConfig *tls.Config
+	// Token 不为空时要求请求头 Authorization: Bearer <Token>，否则返回 401
+	Token string
+	// Fail 返回不为 0 的状态码时拒绝该请求，用于模拟 API 错误，可以为 nil
+	Fail func(req Request) int
+	// OnRequest 接收请求后调用，可以为 nil
+	OnRequest func(req Request)
+
+	srv      *httptest.Server
+	mu       sync.Mutex
+	requests []Request
+}
+
+// Start 开始监听
+func (s *Server) Start() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.handle))
+	_ = s.srv.Listener.Close()
+	s.srv.Listener = ln
+	if s.TLSConfig != nil {
+		s.srv.TLS = s.TLSConfig
+		s.srv.StartTLS()
+	} else {
+		s.srv.Start()
+	}
+	s.Addr = ln.Addr().String()
+	return nil
+}
+
+// URL 服务器地址，如 http://127.0.0.1:8025
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close 停止监听
+func (s *Server) Close() error {
+	if s.srv != nil {
+		s.srv.Close()
+	}
+	return nil
+}
+
+// Requests 所有接收成功的请求
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "content type must be application/json"})
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	req := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Header: r.Header.Clone(),
+		Body:   body,
+		TLS:    r.TLS != nil,
+		Time:   time.Now(),
+	}
+	if err = json.Unmarshal(body, &req.JSON); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json: " + err.Error()})
+		return
+	}
+	if s.Fail != nil {
+		if code := s.Fail(req); code != 0 {
+			writeJSON(w, code, map[string]string{"error": http.StatusText(code)})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	req.ID = fmt.Sprintf("httpsink-%d", len(s.requests)+1)
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+	if s.OnRequest != nil {
+		s.OnRequest(req)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": req.ID})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,597 @@
+// Package imap 简单的 IMAP4rev1 客户端（RFC 3501）
+// 只实现了 email-sender 需要的命令：登录、选择邮箱、搜索、获取邮件和追加邮件
+package imap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/transport"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 连接加密方式，与 SMTP 相同
+const (
+	SecurityAuto     = transport.SecurityAuto // 993 端口使用 tls，其他端口使用 starttls
+	SecurityTLS      = transport.SecurityTLS
+	SecuritySTARTTLS = transport.SecuritySTARTTLS
+	SecurityNone     = transport.SecurityNone
+)
+
+// Config IMAP 连接配置
+type Config struct {
+	Addr     string // 服务器地址，格式为 host:port
+	Security string // 连接加密方式，默认为 auto
+	// Auth 认证方式：auto（LOGIN，用户名或密码包含非 ASCII 字符或换行时使用 AUTHENTICATE PLAIN 或 literal）、
+	// xoauth2（密码为 OAuth2 access token）
+	Auth     string
+	Username string
+	Password string
+
+	CAFile             string
+	InsecureSkipVerify bool
+	Timeout            time.Duration // 读写超时，服务器超过该时间没有响应时命令返回错误，默认为 30s
+}
+
+func (cfg *Config) host() string {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return cfg.Addr
+	}
+	return host
+}
+
+func (cfg *Config) security() string {
+	security := strings.ToLower(cfg.Security)
+	if security == "" || security == SecurityAuto {
+		if _, port, _ := net.SplitHostPort(cfg.Addr); port == "993" {
+			return SecurityTLS
+		}
+		return SecuritySTARTTLS
+	}
+	return security
+}
+
+// Error 服务器返回的 NO 或 BAD
+type Error struct {
+	Status string // NO 或 BAD
+	Text   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("imap: %s %s", e.Status, e.Text)
+}
+
+// Code 响应码，如 TRYCREATE，没有时为空
+func (e *Error) Code() string {
+	if !strings.HasPrefix(e.Text, "[") {
+		return ""
+	}
+	end := strings.IndexAny(e.Text, " ]")
+	if end < 0 {
+		return ""
+	}
+	return strings.ToUpper(e.Text[1:end])
+}
+
+// Client IMAP 客户端
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	tag  int
+	// Caps 服务器支持的扩展（CAPABILITY），大写
+	Caps []string
+}
+
+// Response 一行服务器响应，Literals 为行中 {n} 之后的内容
+type Response struct {
+	Line     string // 去掉 {n} 之后的文本，literal 的位置用 {n} 保留
+	Literals [][]byte
+}
+
+// idleConn 每次读写前设置超时，服务器停止响应时 APPEND、FETCH 等命令返回超时错误，
+// 传输很大的邮件时只要一直有数据就不会超时
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
+
+// Dial 连接 IMAP 服务器，完成加密和登录
+func Dial(cfg Config) (*Client, error) {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = transport.DefaultTimeout
+	}
+	tlsConfig, err := transport.TLSConfig(cfg.host(), cfg.CAFile, cfg.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	tcpConn, err := net.DialTimeout("tcp", cfg.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn = &idleConn{Conn: tcpConn, timeout: timeout}
+	security := cfg.security()
+	switch security {
+	case SecurityTLS, SecuritySTARTTLS, SecurityNone:
+	default:
+		_ = conn.Close()
+		return nil, fmt.Errorf("unsupported security %q", cfg.Security)
+	}
+	if security == SecurityTLS {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	c := newClient(conn)
+	greeting, err := c.readResponse()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.Line, "* OK") && !strings.HasPrefix(greeting.Line, "* PREAUTH") {
+		_ = conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting %q", greeting.Line)
+	}
+
+	if err = c.capability(); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	if security == SecuritySTARTTLS {
+		if !c.HasCap("STARTTLS") {
+			_ = c.Close()
+			return nil, errors.New("server does not support STARTTLS")
+		}
+		if _, err = c.Cmd("STARTTLS"); err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("starttls: %w", err)
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("starttls: %w", err)
+		}
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+		c.w = bufio.NewWriter(tlsConn)
+		// STARTTLS 之后需要重新获取服务器支持的扩展
+		if err = c.capability(); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	if err = c.login(cfg); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient(conn net.Conn) *Client {
+	return &Client{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+func (c *Client) login(cfg Config) error {
+	if strings.EqualFold(cfg.Auth, transport.AuthXOAuth2) {
+		resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", cfg.Username, cfg.Password)
+		if err := c.authenticate("XOAUTH2", resp); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+		return c.capability()
+	}
+	// quoted string 只能包含 ASCII 字符且不能换行，服务器支持时使用 AUTHENTICATE PLAIN（UTF-8），否则 LOGIN 使用 literal
+	if (!quotable(cfg.Username) || !quotable(cfg.Password)) && c.HasCap("AUTH=PLAIN") {
+		if err := c.authenticate("PLAIN", "\x00"+cfg.Username+"\x00"+cfg.Password); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+		return c.capability()
+	}
+	if c.HasCap("LOGINDISABLED") {
+		return errors.New("server disabled LOGIN on unencrypted connection")
+	}
+	tag, err := c.sendStrings("LOGIN", cfg.Username, cfg.Password)
+	if err == nil {
+		_, err = c.wait(tag)
+	}
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	// 登录后服务器支持的扩展可能会变化
+	return c.capability()
+}
+
+// authenticate 使用 SASL 机制 mech 认证，resp 为客户端的初始响应
+// 服务器支持 SASL-IR（RFC 4959）时初始响应随命令发送，否则等待服务器的继续请求后发送
+func (c *Client) authenticate(mech, resp string) error {
+	var tag string
+	var err error
+	if c.HasCap("SASL-IR") {
+		tag, err = c.send("AUTHENTICATE %s %s", mech, base64Encode(resp))
+	} else if tag, err = c.send("AUTHENTICATE %s", mech); err == nil {
+		if err = c.continuation(tag); err == nil {
+			err = c.writeLine(base64Encode(resp))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for {
+		r, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(r.Line, "+"):
+			// 认证失败时服务器可能通过继续请求发送错误信息（如 XOAUTH2），回复空行后服务器返回 NO
+			if err = c.writeLine(""); err != nil {
+				return err
+			}
+		case strings.HasPrefix(r.Line, tag+" "):
+			return tagged(tag, r.Line)
+		}
+	}
+}
+
+func (c *Client) capability() error {
+	resps, err := c.Cmd("CAPABILITY")
+	if err != nil {
+		return err
+	}
+	c.Caps = nil
+	for _, resp := range resps {
+		if fields := strings.Fields(resp.Line); len(fields) > 1 && strings.EqualFold(fields[1], "CAPABILITY") {
+			for _, cap := range fields[2:] {
+				c.Caps = append(c.Caps, strings.ToUpper(cap))
+			}
+		}
+	}
+	return nil
+}
+
+// HasCap 服务器是否支持扩展 name
+func (c *Client) HasCap(name string) bool {
+	for _, cap := range c.Caps {
+		if cap == strings.ToUpper(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cmd 发送命令，返回所有未标记的响应，服务器返回 NO 或 BAD 时返回 *Error
+func (c *Client) Cmd(format string, args ...interface{}) ([]Response, error) {
+	tag, err := c.send(format, args...)
+	if err != nil {
+		return nil, err
+	}
+	return c.wait(tag)
+}
+
+func (c *Client) send(format string, args ...interface{}) (string, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%04d", c.tag)
+	return tag, c.writeLine(tag + " " + fmt.Sprintf(format, args...))
+}
+
+// sendStrings 发送参数都是字符串的命令，不能使用 quoted string 的参数使用 literal 发送
+func (c *Client) sendStrings(cmd string, args ...string) (string, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%04d", c.tag)
+	line := tag + " " + cmd
+	for _, arg := range args {
+		if quotable(arg) {
+			line += " " + Quote(arg)
+			continue
+		}
+		// 发送 {n} 后等待服务器的继续请求 + 再发送 literal，literal 之后继续该行剩余的内容
+		if err := c.writeLine(fmt.Sprintf("%s {%d}", line, len(arg))); err != nil {
+			return "", err
+		}
+		if err := c.continuation(tag); err != nil {
+			return "", err
+		}
+		line = arg
+	}
+	return tag, c.writeLine(line)
+}
+
+func (c *Client) writeLine(line string) error {
+	if _, err := c.w.WriteString(line + "\r\n"); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// continuation 等待服务器的继续请求 +，之前可能有未标记的响应，如 * 3 EXISTS
+// 服务器拒绝命令时返回 *Error
+func (c *Client) continuation(tag string) error {
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(resp.Line, "+"):
+			return nil
+		case strings.HasPrefix(resp.Line, tag+" "):
+			if err = tagged(tag, resp.Line); err == nil {
+				err = fmt.Errorf("imap: unexpected Response %q", resp.Line)
+			}
+			return err
+		case !strings.HasPrefix(resp.Line, "* "):
+			return fmt.Errorf("imap: unexpected Response %q", resp.Line)
+		}
+	}
+}
+
+// tagged 解析 tag 对应的结束响应，NO 或 BAD 时返回 *Error
+func tagged(tag, line string) error {
+	status := strings.SplitN(line[len(tag)+1:], " ", 2)
+	if strings.EqualFold(status[0], "OK") {
+		return nil
+	}
+	text := ""
+	if len(status) > 1 {
+		text = status[1]
+	}
+	return &Error{Status: strings.ToUpper(status[0]), Text: text}
+}
+
+// wait 读取响应直到 tag 对应的结束响应
+func (c *Client) wait(tag string) ([]Response, error) {
+	var resps []Response
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(resp.Line, tag+" ") {
+			resps = append(resps, resp)
+			continue
+		}
+		return resps, tagged(tag, resp.Line)
+	}
+}
+
+// readResponse 读取一行响应，包括行中的 literal
+func (c *Client) readResponse() (Response, error) {
+	var resp Response
+	var b strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		b.WriteString(line)
+
+		// 行末为 {n} 时，后面是 n 字节的 literal，literal 之后继续读取该行剩余的内容
+		n, ok := literalSize(line)
+		if !ok {
+			break
+		}
+		literal := make([]byte, n)
+		if _, err = io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.Literals = append(resp.Literals, literal)
+	}
+	resp.Line = b.String()
+	return resp, nil
+}
+
+func literalSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	i := strings.LastIndexByte(line, '{')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[i+1:len(line)-1], "+"))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Select 选择邮箱，返回邮件数量，邮箱名称中的非 ASCII 字符会编码为修改过的 UTF-7
+func (c *Client) Select(mailbox string) (int, error) {
+	resps, err := c.Cmd("SELECT %s", quoteMailbox(mailbox))
+	if err != nil {
+		return 0, err
+	}
+	for _, resp := range resps {
+		fields := strings.Fields(resp.Line)
+		if len(fields) == 3 && strings.EqualFold(fields[2], "EXISTS") {
+			return strconv.Atoi(fields[1])
+		}
+	}
+	return 0, nil
+}
+
+// UIDSearch 搜索邮件，返回 UID，criteria 为 IMAP 搜索条件，如 SINCE 1-Jun-2022
+func (c *Client) UIDSearch(criteria string) ([]uint32, error) {
+	resps, err := c.Cmd("UID SEARCH %s", criteria)
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, resp := range resps {
+		fields := strings.Fields(resp.Line)
+		if len(fields) < 2 || !strings.EqualFold(fields[1], "SEARCH") {
+			continue
+		}
+		for _, f := range fields[2:] {
+			uid, err := strconv.ParseUint(f, 10, 32)
+			if err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// fetchBatch 每个 UID FETCH 命令最多获取的邮件数量，避免邮件很多时命令行过长被服务器拒绝
+const fetchBatch = 500
+
+// UIDFetch 获取邮件的内容，item 为 BODY.PEEK[] 或 BODY.PEEK[HEADER] 等，返回 uid -> 内容
+// 邮件很多时分多次获取，每次的 UID 合并为范围，如 1:500
+func (c *Client) UIDFetch(uids []uint32, item string) (map[uint32][]byte, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	sorted := append([]uint32(nil), uids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	result := make(map[uint32][]byte)
+	for start := 0; start < len(sorted); start += fetchBatch {
+		end := start + fetchBatch
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		if err := c.uidFetch(uidSet(sorted[start:end]), item, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// uidSet 将从小到大排列的 UID 转换为序列集合，连续的 UID 合并为范围，如 1:3,5,7:9
+func uidSet(uids []uint32) string {
+	var b strings.Builder
+	for i := 0; i < len(uids); {
+		j := i
+		for j+1 < len(uids) && uids[j+1] <= uids[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatUint(uint64(uids[i]), 10))
+		if uids[j] != uids[i] {
+			b.WriteByte(':')
+			b.WriteString(strconv.FormatUint(uint64(uids[j]), 10))
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+// uidFetch 获取序列集合 set 中的邮件，结果写入 result
+func (c *Client) uidFetch(set, item string, result map[uint32][]byte) error {
+	resps, err := c.Cmd("UID FETCH %s (UID %s)", set, item)
+	if err != nil {
+		return err
+	}
+	for _, resp := range resps {
+		upper := strings.ToUpper(resp.Line)
+		if !strings.Contains(upper, " FETCH ") || len(resp.Literals) == 0 {
+			continue
+		}
+		i := strings.Index(upper, "UID ")
+		if i < 0 {
+			continue
+		}
+		fields := strings.FieldsFunc(resp.Line[i+4:], func(r rune) bool { return r == ' ' || r == ')' })
+		if len(fields) == 0 {
+			continue
+		}
+		uid, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		result[uint32(uid)] = resp.Literals[0]
+	}
+	return nil
+}
+
+// Create 创建邮箱
+func (c *Client) Create(mailbox string) error {
+	_, err := c.Cmd("CREATE %s", quoteMailbox(mailbox))
+	return err
+}
+
+// Append 将邮件追加到邮箱中，邮箱不存在时返回响应码为 TRYCREATE 的 *Error，flags 如 \Seen
+func (c *Client) Append(mailbox string, flags []string, date time.Time, msg []byte) error {
+	args := quoteMailbox(mailbox)
+	if len(flags) > 0 {
+		args += " (" + strings.Join(flags, " ") + ")"
+	}
+	if !date.IsZero() {
+		args += " " + Quote(date.Format("02-Jan-2006 15:04:05 -0700"))
+	}
+	tag, err := c.send("APPEND %s {%d}", args, len(msg))
+	if err != nil {
+		return err
+	}
+	// 等待服务器的继续请求 + 后发送邮件内容
+	if err = c.continuation(tag); err != nil {
+		return err
+	}
+	if _, err = c.w.Write(msg); err != nil {
+		return err
+	}
+	if _, err = c.w.WriteString("\r\n"); err != nil {
+		return err
+	}
+	if err = c.w.Flush(); err != nil {
+		return err
+	}
+	_, err = c.wait(tag)
+	return err
+}
+
+// Logout 退出登录并关闭连接
+func (c *Client) Logout() error {
+	_, err := c.Cmd("LOGOUT")
+	_ = c.conn.Close()
+	return err
+}
+
+// Close 关闭连接
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Quote 将字符串转换为 IMAP 的 quoted string，s 中有 quotable 不允许的字符时需要使用 literal
+func Quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// quotable 字符串是否可以使用 quoted string，quoted string 只能包含 7 位 ASCII 字符，不能包含 NUL、CR、LF
+func quotable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 || s[i] == '\r' || s[i] == '\n' || s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func base64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
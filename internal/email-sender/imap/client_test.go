@@ -0,0 +1,353 @@
+package imap_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imap"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imapsink"
+)
+
+func TestMailboxEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"INBOX", "INBOX"},
+		{"Sent Items", "Sent Items"},
+		{"已发送", "&XfJT0ZAB-"},
+		// RFC 3501 5.1.3 的示例
+		{"~peter/mail/台北/日本語", "~peter/mail/&U,BTFw-/&ZeVnLIqe-"},
+		{"A&B", "A&-B"},
+		{"Entwürfe", "Entw&APw-rfe"},
+		{"😀", "&2D3eAA-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imap.EncodeMailbox(tt.name); got != tt.encoded {
+				t.Errorf("EncodeMailbox(%q) = %q, want %q", tt.name, got, tt.encoded)
+			}
+			got, err := imap.DecodeMailbox(tt.encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.name {
+				t.Errorf("DecodeMailbox(%q) = %q, want %q", tt.encoded, got, tt.name)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"&XfJT0ZAB", "&XfJT0ZA-", "已发送"} {
+		if _, err := imap.DecodeMailbox(invalid); err == nil {
+			t.Errorf("DecodeMailbox(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestAppendSink(t *testing.T) {
+	s := &imapsink.Server{Username: "me@example.com", Password: "secret"}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+
+	c, err := imap.Dial(imap.Config{Addr: s.Addr, Security: imap.SecurityNone, Username: "me@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Logout() }()
+
+	msg := []byte("From: me@example.com\r\nSubject: test\r\n\r\nhello\r\n")
+	date := time.Date(2026, 10, 19, 9, 0, 0, 0, time.FixedZone("", 8*3600))
+	err = c.Append("已发送", []string{`\Seen`}, date, msg)
+	if e, ok := err.(*imap.Error); !ok || e.Code() != "TRYCREATE" {
+		t.Fatalf("Append to a missing mailbox = %v, want TRYCREATE", err)
+	}
+	if err = c.Create("已发送"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Append("已发送", []string{`\Seen`}, date, msg); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.Select("已发送")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Select = %d, want 1", n)
+	}
+
+	msgs := s.Messages("已发送")
+	if len(msgs) != 1 {
+		t.Fatalf("mailbox has %d messages, want 1", len(msgs))
+	}
+	if string(msgs[0].Data) != string(msg) || !msgs[0].Date.Equal(date) || strings.Join(msgs[0].Flags, " ") != `\Seen` {
+		t.Errorf("message = %+v", msgs[0])
+	}
+}
+
+// TestUIDFetchBatches 邮件很多时分多次获取
+func TestUIDFetchBatches(t *testing.T) {
+	s := &imapsink.Server{}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	const total = 1203
+	for i := 1; i <= total; i++ {
+		s.Deliver("INBOX", []byte("Subject: "+strconv.Itoa(i)+"\r\n\r\nbody\r\n"))
+	}
+
+	c, err := imap.Dial(imap.Config{Addr: s.Addr, Security: imap.SecurityNone, Username: "u", Password: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Logout() }()
+	if _, err = c.Select("INBOX"); err != nil {
+		t.Fatal(err)
+	}
+	uids, err := c.UIDSearch("ALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uids) != total {
+		t.Fatalf("UIDSearch = %d uids, want %d", len(uids), total)
+	}
+
+	tests := []struct {
+		name string
+		uids []uint32
+	}{
+		{"all", uids},
+		{"gaps and unsorted", []uint32{1203, 3, 1, 700, 2, 501, 500, 499}},
+		{"one", []uint32{42}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, err := c.UIDFetch(tt.uids, "BODY.PEEK[HEADER]")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(headers) != len(tt.uids) {
+				t.Fatalf("UIDFetch = %d messages, want %d", len(headers), len(tt.uids))
+			}
+			for _, uid := range tt.uids {
+				want := "Subject: " + strconv.FormatUint(uint64(uid), 10) + "\r\n\r\n"
+				if string(headers[uid]) != want {
+					t.Errorf("uid %d header = %q, want %q", uid, headers[uid], want)
+				}
+			}
+		})
+	}
+}
+
+// TestAppendUntagged 服务器在继续请求 + 之前发送未标记的响应
+func TestAppendUntagged(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		r := bufio.NewReader(conn)
+		_, _ = io.WriteString(conn, "* OK ready\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return
+			}
+			tag := fields[0]
+			switch strings.ToUpper(fields[1]) {
+			case "CAPABILITY":
+				_, _ = io.WriteString(conn, "* CAPABILITY IMAP4rev1\r\n"+tag+" OK done\r\n")
+			case "APPEND":
+				last := fields[len(fields)-1]
+				n, _ := strconv.Atoi(strings.Trim(last, "{}"))
+				_, _ = io.WriteString(conn, "* 3 EXISTS\r\n* 1 RECENT\r\n+ go ahead\r\n")
+				data := make([]byte, n+2)
+				if _, err = io.ReadFull(r, data); err != nil {
+					return
+				}
+				received <- string(data[:n])
+				_, _ = io.WriteString(conn, "* 4 EXISTS\r\n"+tag+" OK APPEND completed\r\n")
+			default:
+				_, _ = io.WriteString(conn, tag+" OK done\r\n")
+			}
+		}
+	}()
+
+	c, err := imap.Dial(imap.Config{Addr: ln.Addr().String(), Security: imap.SecurityNone, Username: "u", Password: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	if err = c.Append("Sent", nil, time.Time{}, []byte("hello\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != "hello\r\n" {
+		t.Errorf("received %q, want %q", got, "hello\r\n")
+	}
+}
+
+// TestLogin 用户名和密码包含非 ASCII 字符或换行时使用 AUTHENTICATE PLAIN 或 literal，
+// 服务器不支持 SASL-IR 时等待继续请求后发送初始响应
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		caps     string // 服务器支持的认证扩展
+		auth     string
+		username string
+		password string
+	}{
+		{"quoted", "", "", "me@example.com", `se"cr\et`},
+		{"plain non-ascii", "", "", "me@example.com", "密码 secret"},
+		{"plain non-ascii username", "", "", "张三@example.com", "secret"},
+		{"plain crlf without sasl-ir", "AUTH=PLAIN", "", "me@example.com", "line1\r\nline2"},
+		{"literal non-ascii", "AUTH=XOAUTH2", "", "张三@example.com", "密码 secret"},
+		{"literal crlf", "AUTH=XOAUTH2", "", "me@example.com", "line1\r\nline2"},
+		{"xoauth2", "", "xoauth2", "me@example.com", "ya29.token"},
+		{"xoauth2 without sasl-ir", "AUTH=XOAUTH2", "xoauth2", "me@example.com", "ya29.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &imapsink.Server{Username: tt.username, Password: tt.password, Auth: tt.caps}
+			if err := s.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = s.Close() }()
+			cfg := imap.Config{Addr: s.Addr, Security: imap.SecurityNone, Auth: tt.auth,
+				Username: tt.username, Password: tt.password, Timeout: 5 * time.Second}
+
+			c, err := imap.Dial(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = c.Select("INBOX"); err != nil {
+				t.Errorf("Select after login: %s", err)
+			}
+			_ = c.Logout()
+
+			// 密码错误时返回服务器的错误，XOAUTH2 需要回复服务器发送的错误信息
+			cfg.Password += "x"
+			_, err = imap.Dial(cfg)
+			if e, ok := errors.Unwrap(err).(*imap.Error); !ok || e.Code() != "AUTHENTICATIONFAILED" {
+				t.Errorf("Dial with a wrong password = %v, want AUTHENTICATIONFAILED", err)
+			}
+		})
+	}
+}
+
+// stallServer 在收到 stallOn 命令时（为空时在连接后）停止响应的服务器，返回地址
+func stallServer(t *testing.T, stallOn string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		_ = ln.Close()
+	})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		if stallOn == "" {
+			<-done
+			return
+		}
+		r := bufio.NewReader(conn)
+		_, _ = io.WriteString(conn, "* OK ready\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return
+			}
+			tag, cmd := fields[0], strings.ToUpper(fields[1])
+			switch {
+			case cmd == stallOn:
+				<-done
+				return
+			case cmd == "CAPABILITY":
+				_, _ = io.WriteString(conn, "* CAPABILITY IMAP4rev1\r\n"+tag+" OK done\r\n")
+			case cmd == "SELECT":
+				_, _ = io.WriteString(conn, "* 1 EXISTS\r\n"+tag+" OK done\r\n")
+			default:
+				_, _ = io.WriteString(conn, tag+" OK done\r\n")
+			}
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// TestTimeout 服务器停止响应时命令超时返回，不会一直等待
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		stallOn string
+		run     func(c *imap.Client) error
+	}{
+		{"greeting", "", nil},
+		{"login", "LOGIN", nil},
+		{"select", "SELECT", func(c *imap.Client) error {
+			_, err := c.Select("INBOX")
+			return err
+		}},
+		{"fetch", "UID", func(c *imap.Client) error {
+			if _, err := c.Select("INBOX"); err != nil {
+				return err
+			}
+			_, err := c.UIDFetch([]uint32{1}, "BODY.PEEK[]")
+			return err
+		}},
+		{"append", "APPEND", func(c *imap.Client) error {
+			return c.Append("Sent", nil, time.Time{}, []byte("hello\r\n"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := imap.Config{Addr: stallServer(t, tt.stallOn), Security: imap.SecurityNone,
+				Username: "u", Password: "p", Timeout: 200 * time.Millisecond}
+			start := time.Now()
+			c, err := imap.Dial(cfg)
+			if err == nil {
+				defer func() { _ = c.Close() }()
+				if tt.run == nil {
+					t.Fatal("Dial succeeded")
+				}
+				err = tt.run(c)
+			}
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Errorf("error = %v, want a timeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("returned after %s", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package imap
+
+import "testing"
+
+func TestUIDSet(t *testing.T) {
+	tests := []struct {
+		uids []uint32
+		want string
+	}{
+		{[]uint32{7}, "7"},
+		{[]uint32{1, 2, 3}, "1:3"},
+		{[]uint32{1, 2, 3, 5, 7, 8, 9}, "1:3,5,7:9"},
+		{[]uint32{2, 4, 6}, "2,4,6"},
+		{[]uint32{1, 1, 2, 4, 4}, "1:2,4"},
+		{[]uint32{4294967294, 4294967295}, "4294967294:4294967295"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := uidSet(tt.uids); got != tt.want {
+				t.Errorf("uidSet(%v) = %q, want %q", tt.uids, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package imap
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 邮箱名称使用修改过的 UTF-7 编码（RFC 3501 5.1.3），base64 中使用 , 代替 /，并且没有填充
+var mailboxEncoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// EncodeMailbox 将邮箱名称编码为修改过的 UTF-7，如 已发送 编码为 &XfJT0ZAB-
+// 可打印的 ASCII 字符保持不变，& 编码为 &-，其他字符以 UTF-16BE 的 base64 编码并放在 & 和 - 之间
+func EncodeMailbox(name string) string {
+	var b strings.Builder
+	var pending []rune
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		units := utf16.Encode(pending)
+		buf := make([]byte, 0, len(units)*2)
+		for _, u := range units {
+			buf = append(buf, byte(u>>8), byte(u))
+		}
+		b.WriteByte('&')
+		b.WriteString(mailboxEncoding.EncodeToString(buf))
+		b.WriteByte('-')
+		pending = pending[:0]
+	}
+	for _, r := range name {
+		if r >= 0x20 && r <= 0x7e {
+			flush()
+			if r == '&' {
+				b.WriteString("&-")
+			} else {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		pending = append(pending, r)
+	}
+	flush()
+	return b.String()
+}
+
+// DecodeMailbox 解码修改过的 UTF-7 编码的邮箱名称
+func DecodeMailbox(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x20 || c > 0x7e {
+			return "", errors.New("imap: invalid character in mailbox name")
+		}
+		if c != '&' {
+			b.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(name[i+1:], '-')
+		if end < 0 {
+			return "", errors.New("imap: unterminated base64 in mailbox name")
+		}
+		encoded := name[i+1 : i+1+end]
+		i += end + 1
+		if encoded == "" {
+			b.WriteByte('&')
+			continue
+		}
+		buf, err := mailboxEncoding.DecodeString(encoded)
+		if err != nil || len(buf)%2 != 0 {
+			return "", errors.New("imap: invalid base64 in mailbox name")
+		}
+		units := make([]uint16, len(buf)/2)
+		for j := range units {
+			units[j] = uint16(buf[2*j])<<8 | uint16(buf[2*j+1])
+		}
+		for _, r := range utf16.Decode(units) {
+			if r == utf8.RuneError {
+				return "", errors.New("imap: invalid UTF-16 in mailbox name")
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), nil
+}
+
+// quoteMailbox 编码邮箱名称并转换为 quoted string
+func quoteMailbox(name string) string {
+	return Quote(EncodeMailbox(name))
+}
@@ -0,0 +1,705 @@
+// Package imapsink 用于测试的 IMAP 服务器
+// 邮件只保存在内存中，支持 LOGIN、STARTTLS 以及 SELECT、UID SEARCH、UID FETCH、APPEND 等常用命令
+package imapsink
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/imap"
+	"io"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message 邮箱中的一封邮件
+type Message struct {
+	UID   uint32
+	Flags []string
+	Date  time.Time // 收到邮件的时间（INTERNALDATE）
+	Data  []byte
+}
+
+type mailbox struct {
+	name    string
+	nextUID uint32
+	msgs    []Message
+}
+
+// Server 测试用 IMAP 服务器
+type Server struct {
+	// Addr 监听地址，默认为 127.0.0.1:0（随机端口），Start 后为实际监听的地址
+	Addr string
+	// TLSConfig 不为空时支持 STARTTLS，ImplicitTLS 为 true 时连接建立后直接进行 TLS 握手（IMAPS）
+	TLSConfig   *tls.Config
+	ImplicitTLS bool
+	// Username 和 Password 不为空时校验用户名和密码，否则任意用户名和密码都可以登录
+	Username string
+	Password string
+	// Auth 支持的认证扩展，为空时为 AUTH=PLAIN AUTH=XOAUTH2 SASL-IR，LOGIN 总是可以使用
+	// 没有 SASL-IR 时 AUTHENTICATE 不能带初始响应
+	Auth string
+	// OnAppend 客户端通过 APPEND 追加邮件时调用，可以为 nil
+	OnAppend func(mailbox string, msg Message)
+
+	ln        net.Listener
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	mailboxes map[string]*mailbox
+	active    map[net.Conn]struct{}
+}
+
+// Start 开始监听，在后台处理连接
+func (s *Server) Start() error {
+	if s.ImplicitTLS && s.TLSConfig == nil {
+		return errors.New("implicit tls requires TLSConfig")
+	}
+	s.mu.Lock()
+	if s.mailboxes == nil {
+		s.mailboxes = make(map[string]*mailbox)
+	}
+	// 默认的邮箱
+	for _, name := range []string{"INBOX", "Sent"} {
+		if s.mailboxes[strings.ToUpper(name)] == nil {
+			s.mailboxes[strings.ToUpper(name)] = &mailbox{name: name, nextUID: 1}
+		}
+	}
+	s.active = make(map[net.Conn]struct{})
+	s.mu.Unlock()
+
+	addr := s.Addr
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if s.ImplicitTLS {
+		ln = tls.NewListener(ln, s.TLSConfig)
+	}
+	s.ln = ln
+	s.Addr = ln.Addr().String()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.active[c] = struct{}{}
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(c)
+				s.mu.Lock()
+				delete(s.active, c)
+				s.mu.Unlock()
+			}()
+		}
+	}()
+	return nil
+}
+
+// Close 停止监听，关闭所有连接
+func (s *Server) Close() error {
+	if s.ln == nil {
+		return nil
+	}
+	err := s.ln.Close()
+	s.mu.Lock()
+	for c := range s.active {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Deliver 将邮件放入邮箱，邮箱不存在时创建
+func (s *Server) Deliver(name string, data []byte) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendLocked(s.mailboxLocked(name, true), nil, time.Now(), data)
+}
+
+// Messages 邮箱中的所有邮件
+func (s *Server) Messages(name string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb := s.mailboxLocked(name, false)
+	if mb == nil {
+		return nil
+	}
+	return append([]Message(nil), mb.msgs...)
+}
+
+// mailboxLocked 查找邮箱，邮箱名称不区分大小写，create 为 true 时不存在则创建
+func (s *Server) mailboxLocked(name string, create bool) *mailbox {
+	if s.mailboxes == nil {
+		s.mailboxes = make(map[string]*mailbox)
+	}
+	key := strings.ToUpper(name)
+	mb := s.mailboxes[key]
+	if mb == nil && create {
+		mb = &mailbox{name: name, nextUID: 1}
+		s.mailboxes[key] = mb
+	}
+	return mb
+}
+
+func (s *Server) appendLocked(mb *mailbox, flags []string, date time.Time, data []byte) uint32 {
+	uid := mb.nextUID
+	mb.nextUID++
+	mb.msgs = append(mb.msgs, Message{UID: uid, Flags: flags, Date: date, Data: data})
+	return uid
+}
+
+// session 一个 IMAP 连接的状态
+type session struct {
+	s        *Server
+	c        net.Conn
+	r        *bufio.Reader
+	w        *bufio.Writer
+	tls      bool
+	login    bool
+	selected string
+}
+
+func (s *Server) serve(c net.Conn) {
+	sess := &session{s: s, c: c, r: bufio.NewReader(c), w: bufio.NewWriter(c)}
+	defer func() { _ = sess.c.Close() }()
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		sess.tls = true
+	}
+
+	sess.printf("* OK [CAPABILITY %s] imapsink ready", sess.capability())
+	for {
+		_ = sess.c.SetDeadline(time.Now().Add(5 * time.Minute))
+		line, err := sess.readLine()
+		if err != nil {
+			return
+		}
+		args, err := sess.parseArgs(line)
+		if err != nil || len(args) < 2 {
+			// 能解析出 tag 时返回带 tag 的 BAD，客户端不需要等待超时
+			tag := "*"
+			if fields := strings.Fields(line); len(fields) > 1 {
+				tag = fields[0]
+			}
+			sess.printf("%s BAD invalid command", tag)
+			continue
+		}
+		tag, cmd := args[0], strings.ToUpper(args[1])
+		args = args[2:]
+		if cmd == "UID" && len(args) > 0 {
+			cmd, args = "UID "+strings.ToUpper(args[0]), args[1:]
+		}
+		if !sess.handle(tag, cmd, args) {
+			return
+		}
+	}
+}
+
+func (sess *session) printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(sess.w, format+"\r\n", args...)
+	_ = sess.w.Flush()
+}
+
+func (sess *session) readLine() (string, error) {
+	line, err := sess.r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (sess *session) capability() string {
+	auth := sess.s.Auth
+	if auth == "" {
+		auth = "AUTH=PLAIN AUTH=XOAUTH2 SASL-IR"
+	}
+	caps := "IMAP4rev1 " + auth
+	if !sess.tls && sess.s.TLSConfig != nil {
+		caps += " STARTTLS"
+	}
+	return caps
+}
+
+func (sess *session) hasCap(name string) bool {
+	for _, c := range strings.Fields(sess.capability()) {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handle 处理一条命令，返回 false 时关闭连接
+func (sess *session) handle(tag, cmd string, args []string) bool {
+	s := sess.s
+	needLogin := map[string]bool{"SELECT": true, "EXAMINE": true, "CREATE": true, "LIST": true,
+		"APPEND": true, "UID SEARCH": true, "UID FETCH": true, "SEARCH": true}
+	if needLogin[cmd] && !sess.login {
+		sess.printf("%s NO not authenticated", tag)
+		return true
+	}
+	needSelect := map[string]bool{"UID SEARCH": true, "UID FETCH": true, "SEARCH": true}
+	if needSelect[cmd] && sess.selected == "" {
+		sess.printf("%s BAD no mailbox selected", tag)
+		return true
+	}
+
+	switch cmd {
+	case "CAPABILITY":
+		sess.printf("* CAPABILITY %s", sess.capability())
+		sess.printf("%s OK CAPABILITY completed", tag)
+	case "NOOP":
+		sess.printf("%s OK NOOP completed", tag)
+	case "STARTTLS":
+		if sess.tls || s.TLSConfig == nil {
+			sess.printf("%s BAD STARTTLS not available", tag)
+			return true
+		}
+		sess.printf("%s OK begin TLS negotiation now", tag)
+		tlsConn := tls.Server(sess.c, s.TLSConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return false
+		}
+		sess.c, sess.tls = tlsConn, true
+		sess.r, sess.w = bufio.NewReader(tlsConn), bufio.NewWriter(tlsConn)
+	case "LOGIN":
+		if len(args) != 2 || !s.check(args[0], args[1]) {
+			sess.printf("%s NO [AUTHENTICATIONFAILED] invalid credentials", tag)
+			return true
+		}
+		sess.login = true
+		sess.printf("%s OK LOGIN completed", tag)
+	case "AUTHENTICATE":
+		sess.authenticate(tag, args)
+	case "SELECT", "EXAMINE":
+		if len(args) != 1 {
+			sess.printf("%s BAD invalid arguments", tag)
+			return true
+		}
+		s.mu.Lock()
+		mb := s.mailboxLocked(mailboxName(args[0]), false)
+		var exists int
+		var next uint32
+		if mb != nil {
+			exists, next = len(mb.msgs), mb.nextUID
+		}
+		s.mu.Unlock()
+		if mb == nil {
+			sess.printf("%s NO mailbox does not exist", tag)
+			return true
+		}
+		sess.selected = mailboxName(args[0])
+		sess.printf("* %d EXISTS", exists)
+		sess.printf("* FLAGS (\\Seen \\Answered \\Flagged \\Deleted \\Draft)")
+		sess.printf("* OK [UIDVALIDITY 1] UIDs valid")
+		sess.printf("* OK [UIDNEXT %d] predicted next UID", next)
+		sess.printf("%s OK [READ-WRITE] %s completed", tag, cmd)
+	case "CREATE":
+		if len(args) != 1 {
+			sess.printf("%s BAD invalid arguments", tag)
+			return true
+		}
+		s.mu.Lock()
+		name := mailboxName(args[0])
+		exists := s.mailboxLocked(name, false) != nil
+		if !exists {
+			s.mailboxLocked(name, true)
+		}
+		s.mu.Unlock()
+		if exists {
+			sess.printf("%s NO [ALREADYEXISTS] mailbox already exists", tag)
+			return true
+		}
+		sess.printf("%s OK CREATE completed", tag)
+	case "LIST":
+		s.mu.Lock()
+		for _, mb := range s.mailboxes {
+			sess.printf(`* LIST () "/" %s`, quote(imap.EncodeMailbox(mb.name)))
+		}
+		s.mu.Unlock()
+		sess.printf("%s OK LIST completed", tag)
+	case "APPEND":
+		sess.append(tag, args)
+	case "UID SEARCH", "SEARCH":
+		sess.search(tag, cmd, args)
+	case "UID FETCH":
+		sess.fetch(tag, args)
+	case "LOGOUT":
+		sess.printf("* BYE imapsink logging out")
+		sess.printf("%s OK LOGOUT completed", tag)
+		return false
+	default:
+		sess.printf("%s BAD command not implemented", tag)
+	}
+	return true
+}
+
+// authenticate 处理 AUTHENTICATE 命令，支持 PLAIN 和 XOAUTH2，XOAUTH2 的 token 作为密码校验
+func (sess *session) authenticate(tag string, args []string) {
+	if len(args) == 0 {
+		sess.printf("%s BAD invalid arguments", tag)
+		return
+	}
+	mech := strings.ToUpper(args[0])
+	if !sess.hasCap("AUTH=" + mech) {
+		sess.printf("%s NO unsupported authentication mechanism", tag)
+		return
+	}
+	resp := ""
+	if len(args) > 1 {
+		if !sess.hasCap("SASL-IR") {
+			sess.printf("%s BAD initial response requires SASL-IR", tag)
+			return
+		}
+		resp = args[1]
+	} else {
+		sess.printf("+ ")
+		line, err := sess.readLine()
+		if err != nil || line == "*" {
+			sess.printf("%s BAD authentication cancelled", tag)
+			return
+		}
+		resp = line
+	}
+	username, password, ok := decodeAuth(mech, resp)
+	if !ok {
+		sess.printf("%s BAD invalid authentication response", tag)
+		return
+	}
+	if !sess.s.check(username, password) {
+		if mech == "XOAUTH2" {
+			// XOAUTH2 认证失败时先通过继续请求发送错误信息，客户端回复空行后返回 NO
+			sess.printf("+ %s", base64.StdEncoding.EncodeToString([]byte(`{"status":"401","schemes":"bearer"}`)))
+			if _, err := sess.readLine(); err != nil {
+				return
+			}
+		}
+		sess.printf("%s NO [AUTHENTICATIONFAILED] invalid credentials", tag)
+		return
+	}
+	sess.login = true
+	sess.printf("%s OK AUTHENTICATE completed", tag)
+}
+
+// decodeAuth 解析 AUTHENTICATE 的回复，返回用户名和密码（XOAUTH2 为 token）
+func decodeAuth(mech, resp string) (username, password string, ok bool) {
+	b, err := base64.StdEncoding.DecodeString(resp)
+	if err != nil {
+		return "", "", false
+	}
+	switch mech {
+	case "PLAIN":
+		parts := strings.Split(string(b), "\x00")
+		if len(parts) != 3 {
+			return "", "", false
+		}
+		return parts[1], parts[2], true
+	case "XOAUTH2":
+		// user=xxx^Aauth=Bearer token^A^A
+		for _, kv := range strings.Split(string(b), "\x01") {
+			if strings.HasPrefix(kv, "user=") {
+				username = kv[len("user="):]
+			} else if strings.HasPrefix(kv, "auth=Bearer ") {
+				password = kv[len("auth=Bearer "):]
+			}
+		}
+		return username, password, username != ""
+	}
+	return "", "", false
+}
+
+func (s *Server) check(username, password string) bool {
+	if s.Username == "" {
+		return true
+	}
+	return username == s.Username && password == s.Password
+}
+
+// append 处理 APPEND 命令，邮件内容为命令最后的 literal
+func (sess *session) append(tag string, args []string) {
+	if len(args) < 2 {
+		sess.printf("%s BAD invalid arguments", tag)
+		return
+	}
+	data := []byte(args[len(args)-1])
+	var flags []string
+	date := time.Now()
+	for _, arg := range args[1 : len(args)-1] {
+		if strings.HasPrefix(arg, "(") {
+			flags = strings.Fields(strings.Trim(arg, "()"))
+		} else if t, err := time.Parse("02-Jan-2006 15:04:05 -0700", strings.TrimSpace(arg)); err == nil {
+			date = t
+		}
+	}
+	s := sess.s
+	s.mu.Lock()
+	mb := s.mailboxLocked(mailboxName(args[0]), false)
+	var uid uint32
+	if mb != nil {
+		uid = s.appendLocked(mb, flags, date, data)
+	}
+	s.mu.Unlock()
+	if mb == nil {
+		sess.printf("%s NO [TRYCREATE] mailbox does not exist", tag)
+		return
+	}
+	if s.OnAppend != nil {
+		s.OnAppend(mb.name, Message{UID: uid, Flags: flags, Date: date, Data: data})
+	}
+	sess.printf("%s OK [APPENDUID 1 %d] APPEND completed", tag, uid)
+}
+
+// search 处理 SEARCH 命令，支持 ALL、SINCE、BEFORE、FROM、SUBJECT、HEADER 条件
+func (sess *session) search(tag, cmd string, args []string) {
+	msgs := sess.s.Messages(sess.selected)
+	var result []string
+	for i, msg := range msgs {
+		ok, err := match(msg, args)
+		if err != nil {
+			sess.printf("%s BAD %s", tag, err)
+			return
+		}
+		if !ok {
+			continue
+		}
+		if cmd == "UID SEARCH" {
+			result = append(result, strconv.FormatUint(uint64(msg.UID), 10))
+		} else {
+			result = append(result, strconv.Itoa(i+1))
+		}
+	}
+	sess.printf("* SEARCH %s", strings.Join(result, " "))
+	sess.printf("%s OK SEARCH completed", tag)
+}
+
+// match 邮件是否满足所有搜索条件
+func match(msg Message, criteria []string) (bool, error) {
+	var header mail.Header
+	if m, err := mail.ReadMessage(strings.NewReader(string(msg.Data))); err == nil {
+		header = m.Header
+	}
+	for i := 0; i < len(criteria); i++ {
+		key := strings.ToUpper(criteria[i])
+		if key == "ALL" {
+			continue
+		}
+		n := map[string]int{"SINCE": 1, "BEFORE": 1, "FROM": 1, "SUBJECT": 1, "HEADER": 2}[key]
+		if n == 0 || i+n >= len(criteria) {
+			return false, fmt.Errorf("unsupported search criteria %s", criteria[i])
+		}
+		args := criteria[i+1 : i+1+n]
+		i += n
+		switch key {
+		case "SINCE", "BEFORE":
+			d, err := time.Parse("2-Jan-2006", args[0])
+			if err != nil {
+				return false, fmt.Errorf("invalid date %s", args[0])
+			}
+			date := time.Date(msg.Date.Year(), msg.Date.Month(), msg.Date.Day(), 0, 0, 0, 0, time.UTC)
+			if key == "SINCE" && date.Before(d) || key == "BEFORE" && !date.Before(d) {
+				return false, nil
+			}
+		case "FROM", "SUBJECT":
+			if !strings.Contains(strings.ToLower(header.Get(key)), strings.ToLower(args[0])) {
+				return false, nil
+			}
+		case "HEADER":
+			if !strings.Contains(strings.ToLower(header.Get(args[0])), strings.ToLower(args[1])) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// fetch 处理 UID FETCH 命令，支持 UID、FLAGS、INTERNALDATE、RFC822.SIZE、BODY[]、BODY[HEADER] 及其 PEEK
+func (sess *session) fetch(tag string, args []string) {
+	if len(args) < 2 {
+		sess.printf("%s BAD invalid arguments", tag)
+		return
+	}
+	items := strings.Fields(strings.ToUpper(strings.Trim(strings.Join(args[1:], " "), "()")))
+	for _, msg := range sess.s.Messages(sess.selected) {
+		if !inSet(args[0], msg.UID) {
+			continue
+		}
+		var parts []string
+		var literal []byte
+		for _, item := range items {
+			switch item {
+			case "UID":
+			case "FLAGS":
+				parts = append(parts, "FLAGS ("+strings.Join(msg.Flags, " ")+")")
+			case "INTERNALDATE":
+				parts = append(parts, "INTERNALDATE "+quote(msg.Date.Format("02-Jan-2006 15:04:05 -0700")))
+			case "RFC822.SIZE":
+				parts = append(parts, fmt.Sprintf("RFC822.SIZE %d", len(msg.Data)))
+			case "BODY[]", "BODY.PEEK[]", "RFC822":
+				literal = msg.Data
+				parts = append(parts, fmt.Sprintf("BODY[] {%d}", len(literal)))
+			case "BODY[HEADER]", "BODY.PEEK[HEADER]", "RFC822.HEADER":
+				literal = headerOf(msg.Data)
+				parts = append(parts, fmt.Sprintf("BODY[HEADER] {%d}", len(literal)))
+			default:
+				sess.printf("%s BAD unsupported fetch item %s", tag, item)
+				return
+			}
+		}
+		// literal 只能在最后
+		line := fmt.Sprintf("* %d FETCH (UID %d", msg.UID, msg.UID)
+		for _, p := range parts {
+			if !strings.HasSuffix(p, "}") {
+				line += " " + p
+			}
+		}
+		for _, p := range parts {
+			if strings.HasSuffix(p, "}") {
+				line += " " + p
+			}
+		}
+		_, _ = fmt.Fprintf(sess.w, "%s\r\n", line)
+		if literal != nil {
+			_, _ = sess.w.Write(literal)
+		}
+		sess.printf(")")
+	}
+	sess.printf("%s OK FETCH completed", tag)
+}
+
+// headerOf 邮件头，包括最后的空行
+func headerOf(data []byte) []byte {
+	s := string(data)
+	for _, sep := range []string{"\r\n\r\n", "\n\n"} {
+		if i := strings.Index(s, sep); i >= 0 {
+			return data[:i+len(sep)]
+		}
+	}
+	return data
+}
+
+// inSet uid 是否在序列集合中，如 1,3:5,7:*
+func inSet(set string, uid uint32) bool {
+	for _, r := range strings.Split(set, ",") {
+		lo, hi := r, r
+		if i := strings.IndexByte(r, ':'); i >= 0 {
+			lo, hi = r[:i], r[i+1:]
+		}
+		min, err := parseSeq(lo)
+		if err != nil {
+			continue
+		}
+		max, err := parseSeq(hi)
+		if err != nil {
+			continue
+		}
+		if min > max {
+			min, max = max, min
+		}
+		if uid >= min && uid <= max {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSeq(s string) (uint32, error) {
+	if s == "*" {
+		return ^uint32(0), nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint32(n), err
+}
+
+// parseArgs 解析命令的参数：atom、带引号的字符串、括号列表（作为一个参数保留括号）和 literal
+// 带引号的字符串只能包含 7 位 ASCII 字符；literal {n} 需要先回复 + 再读取 n 字节，之后继续读取该行剩余的内容
+func (sess *session) parseArgs(line string) ([]string, error) {
+	var args []string
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return args, nil
+		}
+		switch line[0] {
+		case '"':
+			var b strings.Builder
+			i := 1
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				if line[i] >= 0x80 {
+					return nil, errors.New("8-bit character in quoted string")
+				}
+				b.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, errors.New("unterminated quoted string")
+			}
+			args = append(args, b.String())
+			line = line[i+1:]
+		case '(':
+			i := strings.IndexByte(line, ')')
+			if i < 0 {
+				return nil, errors.New("unterminated list")
+			}
+			args = append(args, line[:i+1])
+			line = line[i+1:]
+		case '{':
+			i := strings.IndexByte(line, '}')
+			if i < 0 || i != len(line)-1 {
+				return nil, errors.New("invalid literal")
+			}
+			nonSync := strings.HasSuffix(line[1:i], "+")
+			n, err := strconv.Atoi(strings.TrimSuffix(line[1:i], "+"))
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid literal")
+			}
+			if !nonSync {
+				sess.printf("+ Ready for literal data")
+			}
+			data := make([]byte, n)
+			if _, err = io.ReadFull(sess.r, data); err != nil {
+				return nil, err
+			}
+			args = append(args, string(data))
+			if line, err = sess.readLine(); err != nil {
+				return nil, err
+			}
+		default:
+			i := strings.IndexByte(line, ' ')
+			if i < 0 {
+				i = len(line)
+			}
+			args = append(args, line[:i])
+			line = line[i:]
+		}
+	}
+}
+
+// mailboxName 解码客户端发送的修改过的 UTF-7 编码的邮箱名称，无法解码时原样使用
+func mailboxName(arg string) string {
+	if name, err := imap.DecodeMailbox(arg); err == nil {
+		return name
+	}
+	return arg
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,225 @@
+// Package journal 邮件发送日志
+// 每封邮件的发送状态以 JSON Lines 格式追加写入日志文件，程序中断后可以根据日志继续发送
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status 发送状态
+type Status string
+
+const (
+	StatusSent      Status = "sent"      // 发送成功
+	StatusFailed    Status = "failed"    // 发送失败
+	StatusScheduled Status = "scheduled" // 已确认发送，等待定时发送
+	StatusBounced   Status = "bounced"   // 发送成功后收到退信
+	StatusUnknown   Status = "unknown"   // 邮件提交后连接中断，发送结果未知，可能已经发送
+)
+
+// Entry 一条发送记录
+type Entry struct {
+	RunID     string    `json:"runId"` // 每次运行的 ID，同一次运行发送的邮件相同
+	Row       int       `json:"row"`   // Excel 行号
+	Key       string    `json:"key"`   // 邮件内容的标识，用于判断该行是否已经发送过
+	To        []string  `json:"to"`
+	Subject   string    `json:"subject"`
+	Status    Status    `json:"status"`
+	MessageID string    `json:"messageId,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+	// SendAt 定时发送的时间，仅 StatusScheduled 的记录有
+	SendAt *time.Time `json:"sendAt,omitempty"`
+	// Bounced 退信的收件人，仅 StatusBounced 的记录有，无法从退信中获取收件人时为空
+	Bounced []string `json:"bounced,omitempty"`
+}
+
+// Journal 发送日志
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	entries []Entry
+}
+
+// Open 打开发送日志，文件不存在时创建
+// 程序中断时最后一行可能没有写完整，打开时截断到最后一条完整的记录，之后追加的记录从新的一行开始
+func Open(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	entries, valid, err := read(f, path)
+	if err == nil {
+		err = repairTail(f, valid)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &Journal{path: path, f: f, entries: entries}, nil
+}
+
+// repairTail 删除最后一条完整记录之后的内容，valid 为完整记录的长度，最后一条记录没有换行时补上
+func repairTail(f *os.File, valid int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > valid {
+		if err = f.Truncate(valid); err != nil {
+			return err
+		}
+	}
+	if valid == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	if _, err = f.ReadAt(last, valid-1); err != nil {
+		return err
+	}
+	if last[0] != '\n' {
+		if _, err = f.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+// Read 读取发送日志中的所有记录
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	entries, _, err := read(f, path)
+	return entries, err
+}
+
+// read 读取所有记录，返回记录和完整记录的长度（字节），最后一行不完整时忽略
+func read(r io.Reader, path string) ([]Entry, int64, error) {
+	var entries []Entry
+	var valid int64
+	br := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e Entry
+			if jsonErr := json.Unmarshal(line, &e); jsonErr != nil {
+				// 程序中断时最后一行可能没有写完整，忽略
+				if _, peekErr := br.Peek(1); peekErr == io.EOF {
+					break
+				}
+				return nil, 0, fmt.Errorf("%s: line %d: %s", path, lineNum, jsonErr)
+			}
+			entries = append(entries, e)
+		}
+		valid += int64(len(line))
+		if err == io.EOF {
+			break
+		}
+	}
+	return entries, valid, nil
+}
+
+// Append 追加一条记录，写入后立即同步到磁盘
+func (j *Journal) Append(e Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err = j.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err = j.f.Sync(); err != nil {
+		return err
+	}
+	j.entries = append(j.entries, e)
+	return nil
+}
+
+// Sent 查找 key 对应的发送成功的记录
+func (j *Journal) Sent(key string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if j.entries[i].Key == key && j.entries[i].Status == StatusSent {
+			return j.entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// Scheduled 查找 key 对应的等待定时发送的记录，之后已经发送成功时返回 false
+func (j *Journal) Scheduled(key string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if j.entries[i].Key != key {
+			continue
+		}
+		switch j.entries[i].Status {
+		case StatusSent:
+			return Entry{}, false
+		case StatusScheduled:
+			return j.entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// Unknown 查找 key 对应的发送结果未知的记录，之后已经发送成功或发送失败时返回 false
+func (j *Journal) Unknown(key string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if j.entries[i].Key != key {
+			continue
+		}
+		switch j.entries[i].Status {
+		case StatusSent, StatusFailed:
+			return Entry{}, false
+		case StatusUnknown:
+			return j.entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// Entries 所有记录
+func (j *Journal) Entries() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Entry(nil), j.entries...)
+}
+
+// Path 日志文件路径
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Close 关闭日志文件
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
@@ -0,0 +1,124 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openJournal(t *testing.T, path string) *Journal {
+	t.Helper()
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = j.Close() })
+	return j
+}
+
+func TestAppendRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := openJournal(t, path)
+	sendAt := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{RunID: "r1", Row: 2, Key: "a", To: []string{"zhangsan@example.com"}, Subject: "工资条", Status: StatusFailed, Error: "timeout"},
+		{RunID: "r1", Row: 3, Key: "b", To: []string{"lisi@example.com"}, Subject: "工资条", Status: StatusScheduled, SendAt: &sendAt},
+		{RunID: "r2", Row: 2, Key: "a", To: []string{"zhangsan@example.com"}, Subject: "工资条", Status: StatusSent, MessageID: "<a@example.com>"},
+	}
+	for _, e := range entries {
+		if err := j.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("Read = %d entries, want %d", len(got), len(entries))
+	}
+	for i, e := range got {
+		if e.Key != entries[i].Key || e.Status != entries[i].Status || e.Time.IsZero() {
+			t.Errorf("entry %d = %+v", i, e)
+		}
+	}
+	if got[1].SendAt == nil || !got[1].SendAt.Equal(sendAt) {
+		t.Errorf("sendAt = %v, want %v", got[1].SendAt, sendAt)
+	}
+
+	reopened := openJournal(t, path)
+	if e, ok := reopened.Sent("a"); !ok || e.MessageID != "<a@example.com>" {
+		t.Errorf("Sent(a) = %+v, %v", e, ok)
+	}
+	if _, ok := reopened.Sent("b"); ok {
+		t.Error("Sent(b) = true")
+	}
+	if e, ok := reopened.Scheduled("b"); !ok || e.Row != 3 {
+		t.Errorf("Scheduled(b) = %+v, %v", e, ok)
+	}
+	if _, ok := reopened.Scheduled("a"); ok {
+		t.Error("Scheduled(a) = true")
+	}
+}
+
+// TestTruncatedTail 程序中断时最后一行没有写完整，之后追加的记录不能和它写在同一行
+func TestTruncatedTail(t *testing.T) {
+	tests := []struct {
+		name string
+		tail string
+		keys []string // 追加一条记录后的所有记录
+	}{
+		{"truncated line", `{"runId":"r1","row":3,"key":"b","sta`, []string{"a", "c"}},
+		{"missing newline", `{"runId":"r1","row":3,"key":"b","status":"sent"}`, []string{"a", "b", "c"}},
+		{"empty", "", []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.jsonl")
+			data := `{"runId":"r1","row":2,"key":"a","status":"sent"}` + "\n" + tt.tail
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			j, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = j.Append(Entry{RunID: "r2", Row: 4, Key: "c", Status: StatusSent}); err != nil {
+				t.Fatal(err)
+			}
+			_ = j.Close()
+
+			entries, err := Read(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, e := range entries {
+				keys = append(keys, e.Key)
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.keys, ",") {
+				t.Errorf("keys = %v, want %v", keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestCorruptLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	data := `{"runId":"r1","row":2,"key":"a","status":"sent"}` + "\n" + "not json\n" +
+		`{"runId":"r1","row":3,"key":"b","status":"sent"}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Open error = %v, want line 2", err)
+	}
+	// 打开失败时不修改文件
+	if got, _ := os.ReadFile(path); string(got) != data {
+		t.Errorf("file changed to %q", got)
+	}
+}
@@ -0,0 +1,218 @@
+// Package pgp OpenPGP 邮件加密（PGP/MIME，RFC 3156）
+// 公钥从本地文件夹中读取，按邮箱查找收件人的公钥
+package pgp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/yuchunyu97/toolset-golang/pkg/utils/sliceutil"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Keyring 公钥文件夹
+type Keyring struct {
+	Dir string
+	// keys 邮箱（小写）-> 公钥
+	keys map[string]*openpgp.Entity
+}
+
+// 公钥文件的扩展名，支持 ASCII Armor 和二进制格式
+var keyExts = []string{".asc", ".gpg", ".pgp", ".key"}
+
+// LoadKeyring 读取文件夹中的所有公钥，按公钥的 User ID 中的邮箱建立索引
+// 无法解析的文件通过 warn 返回，不影响其他公钥
+func LoadKeyring(dir string) (k *Keyring, warn []error, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	k = &Keyring{Dir: dir, keys: make(map[string]*openpgp.Entity)}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !sliceutil.HasString(keyExts, ext) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		list, err := readKeyFile(path)
+		if err != nil {
+			warn = append(warn, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		for _, e := range list {
+			for _, id := range e.Identities {
+				if id.UserId == nil || id.UserId.Email == "" {
+					continue
+				}
+				// 同一个邮箱有多个公钥时，优先使用可以加密的公钥
+				email := strings.ToLower(id.UserId.Email)
+				if old, ok := k.keys[email]; ok && canEncrypt(old) && !canEncrypt(e) {
+					continue
+				}
+				k.keys[email] = e
+			}
+		}
+	}
+	return k, warn, nil
+}
+
+func readKeyFile(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// Lookup 查找邮箱对应的公钥，address 可以包含显示名称
+func (k *Keyring) Lookup(address string) (*openpgp.Entity, bool) {
+	if addr, err := mail.ParseAddress(address); err == nil {
+		address = addr.Address
+	}
+	e, ok := k.keys[strings.ToLower(address)]
+	return e, ok
+}
+
+// Recipients 查找所有收件人的公钥，有收件人没有公钥或公钥不能用于加密时返回错误
+func (k *Keyring) Recipients(addresses []string) (openpgp.EntityList, error) {
+	var list openpgp.EntityList
+	var missing, unusable []string
+	for _, address := range addresses {
+		e, ok := k.Lookup(address)
+		switch {
+		case !ok:
+			missing = append(missing, address)
+		case !canEncrypt(e):
+			unusable = append(unusable, address)
+		default:
+			list = append(list, e)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("没有找到 %s 的 PGP 公钥", strings.Join(missing, "、"))
+	}
+	if len(unusable) > 0 {
+		return nil, fmt.Errorf("%s 的 PGP 公钥不能用于加密（已过期、已吊销或没有加密子密钥）", strings.Join(unusable, "、"))
+	}
+	return list, nil
+}
+
+// canEncrypt 公钥当前是否可以用于加密
+func canEncrypt(e *openpgp.Entity) bool {
+	_, ok := e.EncryptionKey(time.Now())
+	return ok
+}
+
+// 需要加密的邮件头，其余邮件头（发件人、收件人、主题等）保留在外层
+var contentHeaders = []string{"Content-Type", "Content-Transfer-Encoding", "Content-Disposition", "Content-Id"}
+
+// Encrypt 将完整的邮件内容加密为 PGP/MIME 格式（multipart/encrypted），使用 recipients 的公钥加密
+// 邮件正文、附件和 Content-* 邮件头会被加密，主题等其他邮件头不加密
+func Encrypt(msg []byte, recipients openpgp.EntityList) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	end := bytes.Index(msg, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, errors.New("message has no body")
+	}
+
+	// 内层：Content-* 邮件头和正文
+	var outer, inner bytes.Buffer
+	for _, field := range splitHeader(msg[:end+2]) {
+		name := field[:strings.IndexByte(field, ':')]
+		if isContentHeader(name) {
+			inner.WriteString(field)
+		} else if !strings.EqualFold(name, "Mime-Version") {
+			outer.WriteString(field)
+		}
+	}
+	inner.WriteString("\r\n")
+	inner.Write(msg[end+4:])
+
+	var encrypted bytes.Buffer
+	aw, err := armor.Encode(&encrypted, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+	pw, err := openpgp.Encrypt(aw, recipients, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = pw.Write(inner.Bytes()); err != nil {
+		return nil, err
+	}
+	if err = pw.Close(); err != nil {
+		return nil, err
+	}
+	if err = aw.Close(); err != nil {
+		return nil, err
+	}
+
+	// 外层：multipart/encrypted，第一部分为版本，第二部分为密文
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/pgp-encrypted"}})
+	if err != nil {
+		return nil, err
+	}
+	_, _ = part.Write([]byte("Version: 1\r\n"))
+	part, err = w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":        {`application/octet-stream; name="encrypted.asc"`},
+		"Content-Disposition": {`inline; filename="encrypted.asc"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, _ = part.Write(bytes.ReplaceAll(encrypted.Bytes(), []byte("\n"), []byte("\r\n")))
+	_, _ = part.Write([]byte("\r\n"))
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	outer.WriteString("Mime-Version: 1.0\r\n")
+	outer.WriteString(fmt.Sprintf("Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\";\r\n boundary=\"%s\"\r\n", w.Boundary()))
+	outer.WriteString("\r\n")
+	outer.WriteString("This is an OpenPGP/MIME encrypted message (RFC 4880 and 3156)\r\n")
+	outer.Write(body.Bytes())
+	return outer.Bytes(), nil
+}
+
+// splitHeader 将邮件头拆分为多个字段，每个字段包括折行和最后的 CRLF
+func splitHeader(header []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		if strings.IndexByte(line, ':') <= 0 {
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func isContentHeader(name string) bool {
+	for _, h := range contentHeaders {
+		if strings.EqualFold(strings.TrimSpace(name), h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package pgp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const testMessage = "From: hr@example.com\r\n" +
+	"To: zhangsan@example.com\r\n" +
+	"Subject: =?utf-8?q?=E5=B7=A5=E8=B5=84=E6=9D=A1?=\r\n" +
+	"Mime-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"=E5=9F=BA=E6=9C=AC=E5=B7=A5=E8=B5=84 10000\r\n"
+
+// newKey 生成 Ed25519 密钥，比 RSA 快
+func newKey(t *testing.T, email string) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity("", "", email, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// writePublicKey 将公钥以 ASCII Armor 格式写入 dir/name
+func writePublicKey(t *testing.T, dir, name string, e *openpgp.Entity) {
+	t.Helper()
+	var b bytes.Buffer
+	w, err := armor.Encode(&b, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, name), b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// decrypt 解密 PGP/MIME 邮件，返回外层邮件头和解密后的内层内容
+func decrypt(t *testing.T, msg []byte, key *openpgp.Entity) (mail.Header, []byte) {
+	t.Helper()
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/encrypted" || params["protocol"] != "application/pgp-encrypted" {
+		t.Fatalf("Content-Type = %q", m.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	var parts [][]byte
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(p)
+		parts = append(parts, data)
+	}
+	if len(parts) != 2 || !strings.Contains(string(parts[0]), "Version: 1") {
+		t.Fatalf("parts = %q", parts)
+	}
+	block, err := armor.Decode(bytes.NewReader(parts[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{key}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.Header, inner
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	zhangsan, hr := newKey(t, "zhangsan@example.com"), newKey(t, "hr@example.com")
+	dir := t.TempDir()
+	writePublicKey(t, dir, "zhangsan.asc", zhangsan)
+	writePublicKey(t, dir, "hr.asc", hr)
+	// 无法解析的公钥文件不影响其他公钥
+	if err := os.WriteFile(filepath.Join(dir, "broken.asc"), []byte("not a key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, warn, err := LoadKeyring(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warn) != 1 {
+		t.Errorf("warnings = %v, want 1", warn)
+	}
+	recipients, err := keyring.Recipients([]string{"张三 <ZhangSan@example.com>", "hr@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := Encrypt([]byte(testMessage), recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, []byte("=E5=9F=BA")) {
+		t.Error("encrypted message contains the plaintext body")
+	}
+
+	// 每个收件人都可以用自己的私钥解密
+	for _, key := range []*openpgp.Entity{zhangsan, hr} {
+		header, inner := decrypt(t, encrypted, key)
+		// 主题等邮件头不加密，Content-* 邮件头在内层
+		if header.Get("Subject") != "=?utf-8?q?=E5=B7=A5=E8=B5=84=E6=9D=A1?=" || header.Get("To") != "zhangsan@example.com" {
+			t.Errorf("outer header = %v", header)
+		}
+		want := "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+			"=E5=9F=BA=E6=9C=AC=E5=B7=A5=E8=B5=84 10000\r\n"
+		if string(inner) != want {
+			t.Errorf("inner = %q, want %q", inner, want)
+		}
+	}
+
+	// 不在收件人中的密钥无法解密
+	m, _ := mail.ReadMessage(bytes.NewReader(encrypted))
+	_, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	_, _ = mr.NextPart()
+	p, _ := mr.NextPart()
+	block, err := armor.Decode(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = openpgp.ReadMessage(block.Body, openpgp.EntityList{newKey(t, "other@example.com")}, nil, nil); err == nil {
+		t.Error("decrypt with another key succeeded")
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	dir := t.TempDir()
+	writePublicKey(t, dir, "zhangsan.asc", newKey(t, "zhangsan@example.com"))
+	keyring, _, err := LoadKeyring(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		addresses []string
+		wantErr   string
+	}{
+		{"all keys", []string{"zhangsan@example.com"}, ""},
+		{"missing key", []string{"zhangsan@example.com", "lisi@example.com"}, "lisi@example.com"},
+		{"all missing", []string{"lisi@example.com", "wangwu@example.com"}, "lisi@example.com、wangwu@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := keyring.Recipients(tt.addresses)
+			if tt.wantErr == "" {
+				if err != nil || len(list) != len(tt.addresses) {
+					t.Errorf("Recipients = %d keys, %v", len(list), err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Recipients error = %v, want %q", err, tt.wantErr)
+			}
+			if list != nil {
+				t.Errorf("Recipients returned %d keys with an error", len(list))
+			}
+		})
+	}
+
+	if _, err = Encrypt([]byte(testMessage), nil); err == nil {
+		t.Error("Encrypt without recipients succeeded")
+	}
+}
@@ -0,0 +1,165 @@
+// Package schedule 定时发送和发送时间段
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的时间格式，Excel 中的日期单元格按单元格格式读取，也可能是 1/2/06 15:04 等格式
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/1/2 15:04",
+	"1/2/06 15:04",
+	"01-02-06 15:04",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+}
+
+// ParseTime 解析发送时间，使用本地时区
+// 只有时分（如 09:00）时为 now 之后最近的该时刻
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if d, ok := parseClock(s); ok {
+		t := clockOn(now, d)
+		if t.Before(now) {
+			t = clockOn(now.AddDate(0, 0, 1), d)
+		}
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("时间 %q 格式错误，格式为 2006-01-02 15:04", s)
+}
+
+// Window 发送时间段，如 Mon-Fri 09:00-18:00
+type Window struct {
+	Days       [7]bool       // 星期几可以发送，下标为 time.Weekday
+	Start, End time.Duration // 开始和结束时刻（距离零点的时长），结束早于开始时表示跨过零点
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWindow 解析发送时间段，格式为 [星期] 开始-结束，星期可以是 Mon-Fri、Mon,Wed,Fri，省略时为每天
+// 例如 09:00-18:00、Mon-Fri 09:00-12:00、22:00-06:00
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return w, fmt.Errorf("发送时间段 %q 格式错误，格式为 [Mon-Fri] 09:00-18:00", s)
+	}
+
+	if len(fields) == 2 {
+		for _, part := range strings.Split(strings.ToLower(fields[0]), ",") {
+			from, to := part, part
+			if i := strings.Index(part, "-"); i >= 0 {
+				from, to = part[:i], part[i+1:]
+			}
+			start, ok1 := weekdays[from]
+			end, ok2 := weekdays[to]
+			if !ok1 || !ok2 {
+				return w, fmt.Errorf("发送时间段 %q 中的星期 %q 格式错误，应为 Mon、Tue、Wed、Thu、Fri、Sat、Sun", s, part)
+			}
+			for d := start; ; d = (d + 1) % 7 {
+				w.Days[d] = true
+				if d == end {
+					break
+				}
+			}
+		}
+	} else {
+		for i := range w.Days {
+			w.Days[i] = true
+		}
+	}
+
+	clock := strings.Split(fields[len(fields)-1], "-")
+	var ok1, ok2 bool
+	if len(clock) == 2 {
+		w.Start, ok1 = parseClock(clock[0])
+		w.End, ok2 = parseClock(clock[1])
+	}
+	if !ok1 || !ok2 || w.Start == w.End {
+		return w, fmt.Errorf("发送时间段 %q 格式错误，格式为 [Mon-Fri] 09:00-18:00", s)
+	}
+	return w, nil
+}
+
+// ParseWindows 解析多个发送时间段
+func ParseWindows(list []string) ([]Window, error) {
+	var windows []Window
+	for _, s := range list {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		w, err := ParseWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// Next 返回不早于 t 且在任意发送时间段内的最早时刻，没有设置发送时间段时返回 t
+func Next(t time.Time, windows []Window) time.Time {
+	if len(windows) == 0 {
+		return t
+	}
+	var next time.Time
+	// 从前一天开始查找，前一天开始的跨零点时间段可能包含 t
+	for i := -1; i <= 7; i++ {
+		day := startOfDay(t.AddDate(0, 0, i))
+		for _, w := range windows {
+			if !w.Days[day.Weekday()] {
+				continue
+			}
+			start := clockOn(day, w.Start)
+			end := clockOn(day, w.End)
+			if w.End < w.Start {
+				end = clockOn(day.AddDate(0, 0, 1), w.End)
+			}
+			if !t.Before(start) && t.Before(end) {
+				return t
+			}
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	return next
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// clockOn 返回 t 当天的 d 时刻（墙上时间），夏令时切换当天零点加时长会差一小时
+func clockOn(t time.Time, d time.Duration) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, t.Location())
+}
+
+// parseClock 解析时分，如 09:00、9:30、24:00
+func parseClock(s string) (time.Duration, bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, false
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, true
+}
@@ -0,0 +1,197 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var shanghai = time.FixedZone("CST", 8*3600)
+
+func date(day, hour, min int, loc *time.Location) time.Time {
+	// 2026-10-19 为星期一
+	return time.Date(2026, 10, day, hour, min, 0, 0, loc)
+}
+
+func TestParseTime(t *testing.T) {
+	now := date(19, 10, 30, shanghai)
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"2026-10-20 09:00", date(20, 9, 0, shanghai)},
+		{"2026/10/20 09:00:30", date(20, 9, 0, shanghai).Add(30 * time.Second)},
+		{"2026/1/2 09:00", time.Date(2026, 1, 2, 9, 0, 0, 0, shanghai)},
+		{"10/20/26 09:00", date(20, 9, 0, shanghai)},
+		{"2026-10-20", date(20, 0, 0, shanghai)},
+		// 带时区的时间使用其中的时区
+		{"2026-10-20T09:00:00Z", time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)},
+		// 只有时分：今天还没到时为今天，已经过了时为明天
+		{"18:00", date(19, 18, 0, shanghai)},
+		{" 9:00 ", date(20, 9, 0, shanghai)},
+		{"10:30", date(19, 10, 30, shanghai)},
+		{"24:00", date(20, 0, 0, shanghai)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.s, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q) error: %s", tt.s, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+
+	// 没有时区的时间使用 now 的时区
+	got, _ := ParseTime("2026-10-20 09:00", now.In(time.UTC))
+	if want := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("ParseTime in UTC = %s, want %s", got, want)
+	}
+	got, _ = ParseTime("09:00", now.In(time.UTC)) // UTC 02:30
+	if want := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("ParseTime(09:00) in UTC = %s, want %s", got, want)
+	}
+
+	for _, s := range []string{"", "tomorrow", "25:00", "09:60", "2026-13-01 09:00"} {
+		if _, err := ParseTime(s, now); err == nil {
+			t.Errorf("ParseTime(%q) succeeded", s)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	all := [7]bool{true, true, true, true, true, true, true}
+	tests := []struct {
+		s          string
+		days       [7]bool // 下标为 time.Weekday，0 为星期日
+		start, end time.Duration
+	}{
+		{"09:00-18:00", all, 9 * time.Hour, 18 * time.Hour},
+		{"22:00-06:00", all, 22 * time.Hour, 6 * time.Hour},
+		{"Mon-Fri 09:00-12:30", [7]bool{false, true, true, true, true, true, false}, 9 * time.Hour, 12*time.Hour + 30*time.Minute},
+		{"mon,WED,Fri 0:00-24:00", [7]bool{false, true, false, true, false, true, false}, 0, 24 * time.Hour},
+		// 跨过星期日
+		{"Fri-Mon 09:00-18:00", [7]bool{true, true, false, false, false, true, true}, 9 * time.Hour, 18 * time.Hour},
+		{"Sat-Sun,Wed 09:00-18:00", [7]bool{true, false, false, true, false, false, true}, 9 * time.Hour, 18 * time.Hour},
+		{"Sun-Sat 09:00-18:00", all, 9 * time.Hour, 18 * time.Hour},
+	}
+	for _, tt := range tests {
+		w, err := ParseWindow(tt.s)
+		if err != nil {
+			t.Errorf("ParseWindow(%q) error: %s", tt.s, err)
+			continue
+		}
+		if w.Days != tt.days || w.Start != tt.start || w.End != tt.end {
+			t.Errorf("ParseWindow(%q) = %+v, want days %v %s-%s", tt.s, w, tt.days, tt.start, tt.end)
+		}
+	}
+
+	for _, s := range []string{"", "09:00", "09:00-09:00", "09:00-25:00", "Mon-Fri", "Mon-Xyz 09:00-18:00", "Mon-Fri 09:00-18:00 extra"} {
+		if _, err := ParseWindow(s); err == nil {
+			t.Errorf("ParseWindow(%q) succeeded", s)
+		}
+	}
+
+	windows, err := ParseWindows([]string{"09:00-12:00", " ", "Sat 10:00-11:00"})
+	if err != nil || len(windows) != 2 {
+		t.Errorf("ParseWindows = %v, %v", windows, err)
+	}
+	if _, err = ParseWindows([]string{"09:00-12:00", "bad"}); err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Errorf("ParseWindows error = %v", err)
+	}
+}
+
+func TestNext(t *testing.T) {
+	parse := func(list ...string) []Window {
+		windows, err := ParseWindows(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return windows
+	}
+	tests := []struct {
+		name    string
+		windows []Window
+		t, want time.Time
+	}{
+		{"no window", nil, date(19, 3, 0, shanghai), date(19, 3, 0, shanghai)},
+		{"inside", parse("09:00-18:00"), date(19, 10, 0, shanghai), date(19, 10, 0, shanghai)},
+		{"at start", parse("09:00-18:00"), date(19, 9, 0, shanghai), date(19, 9, 0, shanghai)},
+		{"before", parse("09:00-18:00"), date(19, 7, 0, shanghai), date(19, 9, 0, shanghai)},
+		{"at end", parse("09:00-18:00"), date(19, 18, 0, shanghai), date(20, 9, 0, shanghai)},
+
+		// 跨零点的时间段
+		{"overnight before midnight", parse("22:00-06:00"), date(19, 23, 0, shanghai), date(19, 23, 0, shanghai)},
+		{"overnight after midnight", parse("22:00-06:00"), date(20, 5, 59, shanghai), date(20, 5, 59, shanghai)},
+		{"overnight daytime", parse("22:00-06:00"), date(20, 6, 0, shanghai), date(20, 22, 0, shanghai)},
+		// 星期五 22:00 开始的时间段包含星期六凌晨，星期六不在时间段内时不再开始新的时间段
+		{"overnight from friday", parse("Fri 22:00-06:00"), date(24, 3, 0, shanghai), date(24, 3, 0, shanghai)},
+		{"overnight weekday", parse("Fri 22:00-06:00"), date(24, 7, 0, shanghai), date(30, 22, 0, shanghai)},
+
+		// 跨过星期日的星期范围：星期六到星期一
+		{"weekend wrap saturday", parse("Sat-Mon 09:00-18:00"), date(24, 10, 0, shanghai), date(24, 10, 0, shanghai)},
+		{"weekend wrap monday", parse("Sat-Mon 09:00-18:00"), date(19, 10, 0, shanghai), date(19, 10, 0, shanghai)},
+		{"weekend wrap tuesday", parse("Sat-Mon 09:00-18:00"), date(20, 10, 0, shanghai), date(24, 9, 0, shanghai)},
+		{"weekdays on friday evening", parse("Mon-Fri 09:00-18:00"), date(23, 19, 0, shanghai), date(26, 9, 0, shanghai)},
+
+		// 多个时间段取最早的
+		{"multiple", parse("Mon-Fri 14:00-15:00", "Tue 10:00-11:00"), date(20, 8, 0, shanghai), date(20, 10, 0, shanghai)},
+		{"multiple later", parse("Mon-Fri 14:00-15:00", "Tue 10:00-11:00"), date(20, 12, 0, shanghai), date(20, 14, 0, shanghai)},
+	}
+	for _, tt := range tests {
+		if got := Next(tt.t, tt.windows); !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%s) = %s, want %s", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
+
+// TestNextLocation 发送时间段按 t 的时区计算
+func TestNextLocation(t *testing.T) {
+	windows, err := ParseWindows([]string{"Mon-Fri 09:00-18:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 上海时间星期一 10:00 是 UTC 星期一 02:00
+	at := date(19, 10, 0, shanghai)
+	if got := Next(at, windows); !got.Equal(at) {
+		t.Errorf("Next in CST = %s, want %s", got, at)
+	}
+	if got, want := Next(at.In(time.UTC), windows), time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next in UTC = %s, want %s", got, want)
+	}
+	// UTC 星期五 20:00 是上海时间星期六 04:00
+	at = time.Date(2026, 10, 23, 20, 0, 0, 0, time.UTC)
+	if got, want := Next(at.In(shanghai), windows), date(26, 9, 0, shanghai); !got.Equal(want) {
+		t.Errorf("Next of saturday in CST = %s, want %s", got, want)
+	}
+}
+
+// TestDaylightSaving 夏令时切换当天按墙上时间计算
+func TestDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 2026-03-08 02:00 开始夏令时，当天只有 23 小时
+	now := time.Date(2026, 3, 8, 1, 0, 0, 0, newYork)
+	got, err := ParseTime("09:00", now)
+	if want := time.Date(2026, 3, 8, 9, 0, 0, 0, newYork); err != nil || !got.Equal(want) {
+		t.Errorf("ParseTime(09:00) = %s, %v, want %s", got, err, want)
+	}
+	windows, err := ParseWindows([]string{"09:00-18:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Next(now, windows), time.Date(2026, 3, 8, 9, 0, 0, 0, newYork); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+	// 2026-11-01 02:00 结束夏令时，当天有 25 小时
+	now = time.Date(2026, 11, 1, 12, 0, 0, 0, newYork)
+	if got, want := Next(now.Add(6*time.Hour), windows), time.Date(2026, 11, 2, 9, 0, 0, 0, newYork); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+	if got := Next(now.Add(5*time.Hour+59*time.Minute), windows); !got.Equal(now.Add(5*time.Hour + 59*time.Minute)) {
+		t.Errorf("Next at 17:59 = %s", got)
+	}
+}
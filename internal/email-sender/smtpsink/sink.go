@@ -0,0 +1,388 @@
+// Package smtpsink 用于测试的 SMTP 服务器
+// 接收并记录所有邮件，不会投递，支持 STARTTLS、SMTPS 和 PLAIN、LOGIN、CRAM-MD5 认证
+package smtpsink
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message 接收到的邮件
+type Message struct {
+	From     string
+	To       []string
+	Data     []byte
+	Auth     string // 认证方式，未认证时为空
+	Username string // 认证的用户名
+	TLS      bool   // 是否通过加密连接发送
+	Time     time.Time
+}
+
+// Server 测试用 SMTP 服务器
+type Server struct {
+	// Addr 监听地址，默认为 127.0.0.1:0（随机端口），Start 后为实际监听的地址
+	Addr string
+	// TLSConfig 不为空时支持 STARTTLS，ImplicitTLS 为 true 时连接建立后直接进行 TLS 握手（SMTPS）
+	TLSConfig   *tls.Config
+	ImplicitTLS bool
+	// Username 和 Password 不为空时需要认证后才能发送邮件，否则认证可选，任意用户名和密码都可以通过认证
+	Username string
+	Password string
+	// Dir 不为空时将接收到的邮件保存为 .eml 文件
+	Dir string
+	// OnMessage 接收到邮件时调用，可以为 nil
+	OnMessage func(Message)
+
+	ln     net.Listener
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	msgs   []Message
+	conns  int
+	active map[net.Conn]struct{}
+}
+
+// Start 开始监听，在后台处理连接
+func (s *Server) Start() error {
+	if s.ImplicitTLS && s.TLSConfig == nil {
+		return errors.New("implicit tls requires TLSConfig")
+	}
+	if s.Dir != "" {
+		if err := os.MkdirAll(s.Dir, 0755); err != nil {
+			return err
+		}
+	}
+	addr := s.Addr
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if s.ImplicitTLS {
+		ln = tls.NewListener(ln, s.TLSConfig)
+	}
+	s.ln = ln
+	s.Addr = ln.Addr().String()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			if s.active == nil {
+				s.active = make(map[net.Conn]struct{})
+			}
+			s.active[c] = struct{}{}
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(c)
+				s.mu.Lock()
+				delete(s.active, c)
+				s.mu.Unlock()
+			}()
+		}
+	}()
+	return nil
+}
+
+// Close 停止监听，关闭所有连接
+func (s *Server) Close() error {
+	if s.ln == nil {
+		return nil
+	}
+	err := s.ln.Close()
+	s.mu.Lock()
+	for c := range s.active {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Messages 已接收到的所有邮件
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.msgs...)
+}
+
+// Conns 已建立的连接数量
+func (s *Server) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// session 一个 SMTP 连接的状态
+type session struct {
+	s        *Server
+	c        net.Conn
+	tp       *textproto.Conn
+	tls      bool
+	auth     string
+	username string
+	msg      *Message
+}
+
+func (s *Server) serve(c net.Conn) {
+	sess := &session{s: s, c: c, tp: textproto.NewConn(c)}
+	defer func() { _ = sess.c.Close() }()
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		sess.tls = true
+	}
+
+	sess.reply(220, "smtpsink ready")
+	for {
+		_ = sess.c.SetDeadline(time.Now().Add(5 * time.Minute))
+		line, err := sess.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if !sess.handle(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (sess *session) reply(code int, lines ...string) {
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		_ = sess.tp.PrintfLine("%d%s%s", code, sep, line)
+	}
+}
+
+// handle 处理一条命令，返回 false 时关闭连接
+func (sess *session) handle(cmd, arg string) bool {
+	s := sess.s
+	switch cmd {
+	case "HELO":
+		sess.reply(250, "smtpsink")
+	case "EHLO":
+		lines := []string{"smtpsink", "8BITMIME", "PIPELINING"}
+		if !sess.tls && s.TLSConfig != nil {
+			lines = append(lines, "STARTTLS")
+		}
+		lines = append(lines, "AUTH PLAIN LOGIN CRAM-MD5")
+		sess.reply(250, lines...)
+	case "STARTTLS":
+		if sess.tls || s.TLSConfig == nil {
+			sess.reply(502, "STARTTLS not available")
+			return true
+		}
+		sess.reply(220, "ready to start TLS")
+		tlsConn := tls.Server(sess.c, s.TLSConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return false
+		}
+		sess.c, sess.tls = tlsConn, true
+		sess.tp = textproto.NewConn(tlsConn)
+		sess.auth, sess.username, sess.msg = "", "", nil
+	case "AUTH":
+		sess.authenticate(arg)
+	case "MAIL":
+		if s.Username != "" && sess.auth == "" {
+			sess.reply(530, "authentication required")
+			return true
+		}
+		sess.msg = &Message{From: trimPath(arg, "FROM:"), Auth: sess.auth, Username: sess.username, TLS: sess.tls}
+		sess.reply(250, "ok")
+	case "RCPT":
+		if sess.msg == nil {
+			sess.reply(503, "need MAIL first")
+			return true
+		}
+		sess.msg.To = append(sess.msg.To, trimPath(arg, "TO:"))
+		sess.reply(250, "ok")
+	case "DATA":
+		if sess.msg == nil || len(sess.msg.To) == 0 {
+			sess.reply(503, "need RCPT first")
+			return true
+		}
+		sess.reply(354, "end data with <CR><LF>.<CR><LF>")
+		data, err := sess.tp.ReadDotBytes()
+		if err != nil {
+			return false
+		}
+		msg := *sess.msg
+		msg.Data, msg.Time, sess.msg = data, time.Now(), nil
+		if err = s.record(msg); err != nil {
+			sess.reply(451, err.Error())
+			return true
+		}
+		sess.reply(250, "queued")
+	case "RSET":
+		sess.msg = nil
+		sess.reply(250, "ok")
+	case "NOOP":
+		sess.reply(250, "ok")
+	case "QUIT":
+		sess.reply(221, "bye")
+		return false
+	default:
+		sess.reply(502, "command not implemented")
+	}
+	return true
+}
+
+// authenticate 处理 AUTH 命令
+func (sess *session) authenticate(arg string) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		sess.reply(501, "syntax error")
+		return
+	}
+	if sess.auth != "" {
+		sess.reply(503, "already authenticated")
+		return
+	}
+	mech := strings.ToUpper(fields[0])
+	var username string
+	var ok bool
+	switch mech {
+	case "PLAIN":
+		resp := ""
+		if len(fields) > 1 {
+			resp = fields[1]
+		} else if resp = sess.challenge(""); resp == "" {
+			return
+		}
+		b, err := base64.StdEncoding.DecodeString(resp)
+		parts := bytes.Split(b, []byte{0})
+		if err != nil || len(parts) != 3 {
+			sess.reply(501, "invalid PLAIN response")
+			return
+		}
+		username = string(parts[1])
+		ok = sess.s.check(username, string(parts[2]))
+	case "LOGIN":
+		u := sess.challenge("Username:")
+		if u == "" {
+			return
+		}
+		p := sess.challenge("Password:")
+		if p == "" {
+			return
+		}
+		ub, err1 := base64.StdEncoding.DecodeString(u)
+		pb, err2 := base64.StdEncoding.DecodeString(p)
+		if err1 != nil || err2 != nil {
+			sess.reply(501, "invalid LOGIN response")
+			return
+		}
+		username = string(ub)
+		ok = sess.s.check(username, string(pb))
+	case "CRAM-MD5":
+		nonce := make([]byte, 8)
+		_, _ = rand.Read(nonce)
+		challenge := fmt.Sprintf("<%s@smtpsink>", hex.EncodeToString(nonce))
+		resp := sess.challenge(challenge)
+		if resp == "" {
+			return
+		}
+		b, err := base64.StdEncoding.DecodeString(resp)
+		fields := strings.Fields(string(b))
+		if err != nil || len(fields) != 2 {
+			sess.reply(501, "invalid CRAM-MD5 response")
+			return
+		}
+		username = fields[0]
+		if sess.s.Username == "" {
+			ok = true
+		} else {
+			mac := hmac.New(md5.New, []byte(sess.s.Password))
+			mac.Write([]byte(challenge))
+			ok = username == sess.s.Username && hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(fields[1]))
+		}
+	default:
+		sess.reply(504, "unrecognized authentication type")
+		return
+	}
+	if !ok {
+		sess.reply(535, "authentication failed")
+		return
+	}
+	sess.auth, sess.username = mech, username
+	sess.reply(235, "authentication successful")
+}
+
+// challenge 发送 334 质询，返回客户端的回复，客户端取消认证时返回空
+func (sess *session) challenge(text string) string {
+	sess.reply(334, base64.StdEncoding.EncodeToString([]byte(text)))
+	resp, err := sess.tp.ReadLine()
+	if err != nil || resp == "*" {
+		sess.reply(501, "authentication cancelled")
+		return ""
+	}
+	return resp
+}
+
+func (s *Server) check(username, password string) bool {
+	if s.Username == "" {
+		return true
+	}
+	return username == s.Username && password == s.Password
+}
+
+// record 记录邮件，设置了 Dir 时保存为 .eml 文件
+func (s *Server) record(msg Message) error {
+	s.mu.Lock()
+	s.msgs = append(s.msgs, msg)
+	n := len(s.msgs)
+	s.mu.Unlock()
+
+	if s.Dir != "" {
+		name := filepath.Join(s.Dir, fmt.Sprintf("%s-%04d.eml", msg.Time.Format("20060102150405"), n))
+		if err := os.WriteFile(name, msg.Data, 0644); err != nil {
+			return err
+		}
+	}
+	if s.OnMessage != nil {
+		s.OnMessage(msg)
+	}
+	return nil
+}
+
+// trimPath 从 MAIL FROM:<addr> 和 RCPT TO:<addr> 中取出邮箱地址
+func trimPath(arg, prefix string) string {
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	// 去掉 SIZE=、BODY= 等参数
+	if i := strings.IndexByte(arg, '>'); i >= 0 {
+		arg = arg[:i+1]
+	}
+	return strings.Trim(strings.TrimSpace(arg), "<>")
+}
@@ -0,0 +1,170 @@
+package smtpsink_test
+
+import (
+	"errors"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/smtpsink"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/transport"
+)
+
+const testMessage = "From: me@example.com\r\nTo: you@example.com\r\nSubject: test\r\n\r\nhello\r\n.leading dot\r\n"
+
+// startServer 启动测试用 SMTP 服务器，返回服务器和客户端使用的 CA 证书文件
+func startServer(t *testing.T, security string, username, password string) (*smtpsink.Server, string) {
+	t.Helper()
+	s := &smtpsink.Server{Username: username, Password: password, Dir: t.TempDir()}
+	caFile := ""
+	if security != transport.SecurityNone {
+		tlsConfig, certPEM, err := smtpsink.SelfSignedTLS()
+		if err != nil {
+			t.Fatal(err)
+		}
+		caFile = filepath.Join(t.TempDir(), "ca.pem")
+		if err = os.WriteFile(caFile, certPEM, 0644); err != nil {
+			t.Fatal(err)
+		}
+		s.TLSConfig = tlsConfig
+		s.ImplicitTLS = security == transport.SecurityTLS
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s, caFile
+}
+
+func TestSendPath(t *testing.T) {
+	tests := []struct {
+		security string
+		auth     string
+	}{
+		{transport.SecuritySTARTTLS, transport.AuthPlain},
+		{transport.SecuritySTARTTLS, transport.AuthLogin},
+		{transport.SecuritySTARTTLS, transport.AuthCRAMMD5},
+		{transport.SecuritySTARTTLS, transport.AuthAuto},
+		{transport.SecurityTLS, transport.AuthPlain},
+		{transport.SecurityTLS, transport.AuthCRAMMD5},
+		{transport.SecurityNone, transport.AuthLogin},
+		{transport.SecurityNone, transport.AuthNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.security+"/"+tt.auth, func(t *testing.T) {
+			username, password := "me@example.com", "secret"
+			if tt.auth == transport.AuthNone {
+				username, password = "", ""
+			}
+			s, caFile := startServer(t, tt.security, username, password)
+
+			c, err := transport.NewSMTPClient(transport.Config{
+				Addr:     s.Addr,
+				Security: tt.security,
+				Auth:     tt.auth,
+				Username: username,
+				Password: password,
+				CAFile:   caFile,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 同一个连接发送两封邮件
+			for i := 0; i < 2; i++ {
+				if err = c.Send("me@example.com", []string{"you@example.com", "cc@example.com"}, []byte(testMessage)); err != nil {
+					t.Fatalf("send %d: %s", i+1, err)
+				}
+			}
+			if err = c.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			msgs := s.Messages()
+			if len(msgs) != 2 {
+				t.Fatalf("received %d messages, want 2", len(msgs))
+			}
+			if s.Conns() != 1 {
+				t.Errorf("conns = %d, want 1", s.Conns())
+			}
+			msg := msgs[0]
+			if msg.From != "me@example.com" || strings.Join(msg.To, ",") != "you@example.com,cc@example.com" {
+				t.Errorf("envelope = %s -> %v", msg.From, msg.To)
+			}
+			// DATA 以 textproto.DotReader 读取，换行统一为 \n，行首的 . 已还原
+			if want := strings.ReplaceAll(testMessage, "\r\n", "\n"); string(msg.Data) != want {
+				t.Errorf("data = %q, want %q", msg.Data, want)
+			}
+			if wantTLS := tt.security != transport.SecurityNone; msg.TLS != wantTLS {
+				t.Errorf("TLS = %v, want %v", msg.TLS, wantTLS)
+			}
+			if tt.auth != transport.AuthNone && tt.auth != transport.AuthAuto && !strings.EqualFold(msg.Auth, tt.auth) {
+				t.Errorf("auth = %q, want %q", msg.Auth, tt.auth)
+			}
+			if tt.auth != transport.AuthNone && msg.Username != username {
+				t.Errorf("username = %q, want %q", msg.Username, username)
+			}
+
+			files, err := filepath.Glob(filepath.Join(s.Dir, "*.eml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 2 {
+				t.Errorf("saved %d .eml files, want 2", len(files))
+			}
+		})
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     string
+		password string
+	}{
+		{"wrong password", transport.AuthPlain, "wrong"},
+		{"wrong password cram-md5", transport.AuthCRAMMD5, "wrong"},
+		{"no auth", transport.AuthNone, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, caFile := startServer(t, transport.SecuritySTARTTLS, "me@example.com", "secret")
+			c, err := transport.NewSMTPClient(transport.Config{
+				Addr:     s.Addr,
+				Security: transport.SecuritySTARTTLS,
+				Auth:     tt.auth,
+				Username: "me@example.com",
+				Password: tt.password,
+				CAFile:   caFile,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = c.Close() }()
+
+			err = c.Send("me@example.com", []string{"you@example.com"}, []byte(testMessage))
+			var tpErr *textproto.Error
+			if !errors.As(err, &tpErr) || tpErr.Code < 500 {
+				t.Errorf("send error = %v, want 5xx", err)
+			}
+			if n := len(s.Messages()); n != 0 {
+				t.Errorf("received %d messages, want 0", n)
+			}
+		})
+	}
+}
+
+func TestUntrustedCertificate(t *testing.T) {
+	s, _ := startServer(t, transport.SecuritySTARTTLS, "", "")
+	c, err := transport.NewSMTPClient(transport.Config{Addr: s.Addr, Security: transport.SecuritySTARTTLS, Auth: transport.AuthNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	if err = c.Send("me@example.com", []string{"you@example.com"}, []byte(testMessage)); err == nil {
+		t.Error("send with an untrusted certificate succeeded")
+	}
+}
@@ -0,0 +1,152 @@
+package transport
+
+// SMTP 认证方式
+// LOGIN 参考：https://izsk.me/2020/04/20/golang-restfulAPI-mail-server/
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// 认证方式
+const (
+	AuthAuto    = "auto" // 根据服务器支持的认证方式自动选择，优先级 PLAIN > LOGIN > CRAM-MD5
+	AuthNone    = "none"
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthXOAuth2 = "xoauth2" // 密码为 OAuth2 access token
+)
+
+type loginAuth struct {
+	username, password string
+	step               int
+}
+
+// LoginAuth LOGIN 认证
+// 服务器的提示不区分大小写，提示内容被重复 base64 编码时也可以识别，无法识别时按顺序依次发送用户名和密码
+func LoginAuth(username, password string) smtp.Auth {
+	return &loginAuth{username: username, password: password}
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	a.step = 0
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	a.step++
+
+	prompt := strings.TrimSpace(string(fromServer))
+	if decoded, err := base64.StdEncoding.DecodeString(prompt); err == nil && isPrintable(decoded) {
+		prompt = string(decoded)
+	}
+	prompt = strings.ToLower(prompt)
+
+	switch {
+	case strings.Contains(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.Contains(prompt, "pass"):
+		return []byte(a.password), nil
+	case a.step == 1:
+		return []byte(a.username), nil
+	case a.step == 2:
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge: %q", fromServer)
+}
+
+type xoauth2Auth struct {
+	username, token string
+}
+
+// XOAuth2Auth XOAUTH2 认证，token 为 OAuth2 access token
+// 文档：https://developers.google.com/gmail/imap/xoauth2-protocol
+func XOAuth2Auth(username, token string) smtp.Auth {
+	return &xoauth2Auth{username: username, token: token}
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, a.token)
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// 认证失败时服务器返回 JSON 格式的错误信息，需要回复空行后服务器才会返回错误码
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+func isPrintable(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// newAuth 根据认证方式创建 smtp.Auth，serverMechs 为服务器支持的认证方式（EHLO 返回的 AUTH 扩展）
+func newAuth(mechanism, host, username, password, serverMechs string) (smtp.Auth, error) {
+	mechanism = strings.ToLower(mechanism)
+	if mechanism == "" || mechanism == AuthAuto {
+		mechanism = chooseAuth(serverMechs)
+	}
+
+	switch mechanism {
+	case AuthPlain:
+		return smtp.PlainAuth("", username, password, host), nil
+	case AuthLogin:
+		return LoginAuth(username, password), nil
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(username, password), nil
+	case AuthXOAuth2:
+		return XOAuth2Auth(username, password), nil
+	case AuthNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported auth mechanism %q", mechanism)
+}
+
+// chooseAuth 根据服务器支持的认证方式选择，服务器没有返回时使用 LOGIN
+func chooseAuth(serverMechs string) string {
+	mechs := strings.Fields(strings.ToUpper(serverMechs))
+	has := func(mech string) bool {
+		for _, m := range mechs {
+			if m == mech {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has("PLAIN"):
+		return AuthPlain
+	case has("LOGIN"):
+		return AuthLogin
+	case has("CRAM-MD5"):
+		return AuthCRAMMD5
+	}
+	return AuthLogin
+}
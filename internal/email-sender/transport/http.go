@@ -0,0 +1,347 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultPayload 默认的请求体模板，发送完整的邮件内容（Base64 编码）
+const DefaultPayload = `{"from": {{json .From}}, "to": {{json .To}}, "raw": {{json .Raw}}}`
+
+// HTTPConfig HTTP 邮件 API 配置
+type HTTPConfig struct {
+	URL    string // API 地址
+	Method string // 请求方法，默认为 POST
+	// Headers 请求头，可以使用模板变量 {{.Username}} 和 {{.Password}}，如 Authorization: Bearer {{.Password}}
+	Headers map[string]string
+	// Payload 请求体模板（JSON），变量见 HTTPMessage，json 函数将变量转换为 JSON，为空时使用 DefaultPayload
+	Payload  string
+	Username string
+	Password string // API Key 或 access token
+
+	CAFile             string
+	InsecureSkipVerify bool
+	// Timeout 请求超时时间，默认为 30s
+	Timeout time.Duration
+}
+
+// HTTPMessage 请求体模板的变量
+// 邮件经过 PGP 加密或 DKIM 签名时，只有 Raw 和 MIME 是最终的邮件内容，Text、HTML 等为解析原始邮件得到的内容
+type HTTPMessage struct {
+	From string   // 发件人邮箱
+	To   []string // 所有收件人（包括抄送和密送）邮箱
+
+	Raw  string // 完整的邮件内容，Base64 编码
+	MIME string // 完整的邮件内容
+
+	// 以下为解析邮件得到的内容
+	Header      map[string]string // 邮件头，如 .Header.Subject
+	FromHeader  string            // From 邮件头，包括显示名称
+	ToHeader    []string          // To 邮件头中的邮箱
+	Cc          []string
+	Bcc         []string // 不在邮件头中的收件人
+	ReplyTo     []string
+	Subject     string
+	MessageID   string
+	Text        string
+	HTML        string
+	Attachments []HTTPAttachment
+}
+
+// HTTPAttachment 附件（包括内嵌图片）
+type HTTPAttachment struct {
+	Filename    string
+	ContentType string
+	ContentID   string // 内嵌图片的 Content-ID，不包括尖括号
+	Content     string // Base64 编码
+}
+
+// HTTPError API 返回的错误，429 和 5xx 为临时错误
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d %s", e.StatusCode, e.Body)
+}
+
+// Temporary 是否为临时错误，可以重试
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// HTTPClient 通过 HTTP 邮件 API 发送邮件，每封邮件发送一个 JSON 请求，2xx 为发送成功
+type HTTPClient struct {
+	cfg     HTTPConfig
+	payload *template.Template
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewHTTPClient 创建 HTTP 客户端，校验配置并解析模板
+func NewHTTPClient(cfg HTTPConfig) (*HTTPClient, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("API 地址 %q 错误，格式如 https://api.example.com/v1/send", cfg.URL)
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	if cfg.Payload == "" {
+		cfg.Payload = DefaultPayload
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	payload, err := template.New("payload").Funcs(template.FuncMap{"json": toJSON}).
+		Option("missingkey=error").Parse(cfg.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("请求体模板错误 %s", err)
+	}
+
+	// 请求头只渲染一次
+	headers := make(map[string]string, len(cfg.Headers))
+	vars := map[string]string{"Username": cfg.Username, "Password": cfg.Password}
+	for k, v := range cfg.Headers {
+		tmpl, err := template.New(k).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("请求头 %s 模板错误 %s", k, err)
+		}
+		var b strings.Builder
+		if err = tmpl.Execute(&b, vars); err != nil {
+			return nil, fmt.Errorf("请求头 %s 模板错误 %s", k, err)
+		}
+		headers[k] = b.String()
+	}
+
+	tlsConfig, err := TLSConfig(u.Hostname(), cfg.CAFile, cfg.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	httpTransport.TLSClientConfig = tlsConfig
+
+	return &HTTPClient{
+		cfg:     cfg,
+		payload: payload,
+		headers: headers,
+		client:  &http.Client{Transport: httpTransport, Timeout: cfg.Timeout},
+	}, nil
+}
+
+// Send 发送邮件
+func (h *HTTPClient) Send(from string, to []string, msg []byte) error {
+	body, err := h.Payload(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(h.cfg.Method, h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// 连接失败时请求没有发出，可以重试；请求发出后没有收到响应时服务器可能已经发送了邮件
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return err
+		}
+		return &UnknownError{Err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// 读取响应内容，错误时作为错误信息，成功时读完以便复用连接
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text := strings.TrimSpace(string(respBody))
+		if len(text) > 500 {
+			text = text[:500] + "..."
+		}
+		return &HTTPError{StatusCode: resp.StatusCode, Body: text}
+	}
+	return nil
+}
+
+// Payload 渲染请求体
+func (h *HTTPClient) Payload(from string, to []string, msg []byte) ([]byte, error) {
+	data, err := NewHTTPMessage(from, to, msg)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err = h.payload.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("请求体模板错误 %s", err)
+	}
+	if !json.Valid(b.Bytes()) {
+		return nil, errors.New("请求体不是合法的 JSON，请检查请求体模板，字符串变量请使用 json 函数转换，如 {{json .Subject}}")
+	}
+	return b.Bytes(), nil
+}
+
+// Close 关闭空闲连接
+func (h *HTTPClient) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// toJSON 模板函数，将变量转换为 JSON
+func toJSON(v interface{}) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// NewHTTPMessage 解析邮件，生成请求体模板的变量
+func NewHTTPMessage(from string, to []string, msg []byte) (*HTTPMessage, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		return nil, fmt.Errorf("解析邮件失败 %s", err)
+	}
+	dec := new(mime.WordDecoder)
+	decode := func(v string) string {
+		if decoded, err := dec.DecodeHeader(v); err == nil {
+			return decoded
+		}
+		return v
+	}
+	addresses := func(key string) []string {
+		list, err := m.Header.AddressList(key)
+		if err != nil {
+			return nil
+		}
+		result := make([]string, 0, len(list))
+		for _, addr := range list {
+			result = append(result, addr.Address)
+		}
+		return result
+	}
+
+	data := &HTTPMessage{
+		From:       from,
+		To:         to,
+		Raw:        base64.StdEncoding.EncodeToString(msg),
+		MIME:       string(msg),
+		Header:     make(map[string]string, len(m.Header)),
+		FromHeader: decode(m.Header.Get("From")),
+		ToHeader:   addresses("To"),
+		Cc:         addresses("Cc"),
+		ReplyTo:    addresses("Reply-To"),
+		Subject:    decode(m.Header.Get("Subject")),
+		MessageID:  m.Header.Get("Message-Id"),
+	}
+	for k := range m.Header {
+		data.Header[k] = decode(m.Header.Get(k))
+	}
+	// 密送的收件人不在邮件头中
+	inHeader := make(map[string]bool)
+	for _, v := range append(append([]string(nil), data.ToHeader...), data.Cc...) {
+		inHeader[strings.ToLower(v)] = true
+	}
+	for _, v := range to {
+		if !inHeader[strings.ToLower(v)] {
+			data.Bcc = append(data.Bcc, v)
+		}
+	}
+
+	if err = data.walk(m.Header, m.Body); err != nil {
+		return nil, fmt.Errorf("解析邮件失败 %s", err)
+	}
+	return data, nil
+}
+
+// partHeader 邮件和 multipart 中每一部分共用的邮件头
+type partHeader interface {
+	Get(key string) string
+}
+
+// walk 遍历邮件的每一部分，第一个 text/plain 和 text/html 为正文，其他为附件
+func (data *HTTPMessage) walk(h partHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := r.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err = data.walk(p.Header, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename != "" {
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+			filename = decoded
+		}
+	}
+
+	switch {
+	case disposition != "attachment" && filename == "" && mediaType == "text/plain" && data.Text == "":
+		data.Text = string(content)
+	case disposition != "attachment" && filename == "" && mediaType == "text/html" && data.HTML == "":
+		data.HTML = string(content)
+	default:
+		data.Attachments = append(data.Attachments, HTTPAttachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			ContentID:   strings.Trim(h.Get("Content-Id"), "<>"),
+			Content:     base64.StdEncoding.EncodeToString(content),
+		})
+	}
+	return nil
+}
+
+// decodeTransfer 按 Content-Transfer-Encoding 解码
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r) // 解码时忽略换行
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
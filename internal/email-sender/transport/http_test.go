@@ -0,0 +1,315 @@
+package transport_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/httpsink"
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/transport"
+)
+
+// testMessage 包含纯文本和 HTML 正文、附件和内嵌图片的邮件
+const testMessage = "From: =?utf-8?q?=E4=BA=BA=E5=8A=9B=E8=B5=84=E6=BA=90=E9=83=A8?= <hr@example.com>\r\n" +
+	"To: =?utf-8?q?=E5=BC=A0=E4=B8=89?= <zhangsan@example.com>\r\n" +
+	"Cc: cc@example.com\r\n" +
+	"Reply-To: reply@example.com\r\n" +
+	"Subject: =?utf-8?q?=E5=B7=A5=E8=B5=84=E6=9D=A1?=\r\n" +
+	"Message-Id: <1.2@example.com>\r\n" +
+	"Mime-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=mixed\r\n" +
+	"\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: multipart/related; boundary=related\r\n" +
+	"\r\n" +
+	"--related\r\n" +
+	"Content-Type: multipart/alternative; boundary=alt\r\n" +
+	"\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"=E4=BD=A0=E5=A5=BD\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"PHA+5L2g5aW9PC9wPg==\r\n" +
+	"--alt--\r\n" +
+	"--related\r\n" +
+	"Content-Type: image/png; name=logo.png\r\n" +
+	"Content-Id: <logo>\r\n" +
+	"Content-Disposition: inline; filename=logo.png\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw==\r\n" +
+	"--related--\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"=?utf-8?q?=E5=B7=A5=E8=B5=84.pdf?=\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0=\r\n" +
+	"--mixed--\r\n"
+
+var testRecipients = []string{"zhangsan@example.com", "CC@example.com", "bcc@example.com"}
+
+func TestNewHTTPMessage(t *testing.T) {
+	data, err := transport.NewHTTPMessage("hr@example.com", testRecipients, []byte(testMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"From", data.From, "hr@example.com"},
+		{"FromHeader", data.FromHeader, "人力资源部 <hr@example.com>"},
+		{"ToHeader", data.ToHeader, []string{"zhangsan@example.com"}},
+		{"Cc", data.Cc, []string{"cc@example.com"}},
+		// 收件人不区分大小写，只有不在邮件头中的是密送
+		{"Bcc", data.Bcc, []string{"bcc@example.com"}},
+		{"ReplyTo", data.ReplyTo, []string{"reply@example.com"}},
+		{"Subject", data.Subject, "工资条"},
+		{"Header.Subject", data.Header["Subject"], "工资条"},
+		{"MessageID", data.MessageID, "<1.2@example.com>"},
+		{"Text", data.Text, "你好"},
+		{"HTML", data.HTML, "<p>你好</p>"},
+		{"Raw", data.Raw, base64.StdEncoding.EncodeToString([]byte(testMessage))},
+		{"MIME", data.MIME, testMessage},
+		{"Attachments", data.Attachments, []transport.HTTPAttachment{
+			{Filename: "logo.png", ContentType: "image/png", ContentID: "logo", Content: "iVBORw=="},
+			{Filename: "工资.pdf", ContentType: "application/pdf", Content: "JVBERi0="},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, err = transport.NewHTTPMessage("hr@example.com", testRecipients, []byte("not a message")); err == nil {
+		t.Error("NewHTTPMessage of an invalid message succeeded")
+	}
+}
+
+// startSink 启动测试用 HTTP 邮件 API
+func startSink(t *testing.T, token string, fail func(req httpsink.Request) int) *httpsink.Server {
+	t.Helper()
+	s := &httpsink.Server{Token: token, Fail: fail}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestHTTPSend(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     transport.HTTPConfig
+		check   func(t *testing.T, req httpsink.Request)
+		wantErr int // 期望的 HTTP 状态码，0 为发送成功
+	}{
+		{
+			name: "default payload",
+			cfg:  transport.HTTPConfig{Password: "key"},
+			check: func(t *testing.T, req httpsink.Request) {
+				if req.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", req.Method)
+				}
+				if req.JSON["from"] != "hr@example.com" || req.JSON["raw"] != base64.StdEncoding.EncodeToString([]byte(testMessage)) {
+					t.Errorf("payload = %s", req.Body)
+				}
+				if to, _ := req.JSON["to"].([]interface{}); len(to) != len(testRecipients) {
+					t.Errorf("to = %v, want %v", req.JSON["to"], testRecipients)
+				}
+			},
+		},
+		{
+			name: "custom payload and headers",
+			cfg: transport.HTTPConfig{
+				Method:   "put",
+				Username: "api",
+				Password: "key",
+				Headers:  map[string]string{"X-Api-User": "{{.Username}}"},
+				Payload: `{"subject": {{json .Subject}}, "html": {{json .HTML}}, "bcc": {{json .Bcc}},` +
+					` "attachments": [{{range $i, $a := .Attachments}}{{if $i}},{{end}}{{json $a.Filename}}{{end}}]}`,
+			},
+			check: func(t *testing.T, req httpsink.Request) {
+				if req.Method != http.MethodPut {
+					t.Errorf("method = %s, want PUT", req.Method)
+				}
+				if req.Header.Get("X-Api-User") != "api" {
+					t.Errorf("X-Api-User = %q, want api", req.Header.Get("X-Api-User"))
+				}
+				want := `{"subject": "工资条", "html": "<p>你好</p>", "bcc": ["bcc@example.com"], "attachments": ["logo.png","工资.pdf"]}`
+				if string(req.Body) != want {
+					t.Errorf("payload = %s, want %s", req.Body, want)
+				}
+			},
+		},
+		{name: "wrong token", cfg: transport.HTTPConfig{Password: "wrong"}, wantErr: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startSink(t, "key", nil)
+			cfg := tt.cfg
+			cfg.URL = s.URL() + "/v1/send"
+			if cfg.Headers == nil {
+				cfg.Headers = map[string]string{}
+			}
+			cfg.Headers["Authorization"] = "Bearer {{.Password}}"
+			c, err := transport.NewHTTPClient(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = c.Close() }()
+
+			err = c.Send("hr@example.com", testRecipients, []byte(testMessage))
+			if tt.wantErr != 0 {
+				var httpErr *transport.HTTPError
+				if !errors.As(err, &httpErr) || httpErr.StatusCode != tt.wantErr {
+					t.Fatalf("Send = %v, want HTTP %d", err, tt.wantErr)
+				}
+				if len(s.Requests()) != 0 {
+					t.Errorf("received %d requests, want 0", len(s.Requests()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			reqs := s.Requests()
+			if len(reqs) != 1 {
+				t.Fatalf("received %d requests, want 1", len(reqs))
+			}
+			if reqs[0].Path != "/v1/send" || reqs[0].Header.Get("Content-Type") != "application/json" {
+				t.Errorf("request = %s %s", reqs[0].Path, reqs[0].Header.Get("Content-Type"))
+			}
+			tt.check(t, reqs[0])
+		})
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		temporary bool
+	}{
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusBadRequest, false},
+		{http.StatusForbidden, false},
+		{http.StatusUnprocessableEntity, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			s := startSink(t, "", func(httpsink.Request) int { return tt.status })
+			c, err := transport.NewHTTPClient(transport.HTTPConfig{URL: s.URL()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = c.Close() }()
+
+			err = c.Send("hr@example.com", testRecipients, []byte(testMessage))
+			var httpErr *transport.HTTPError
+			if !errors.As(err, &httpErr) || httpErr.StatusCode != tt.status {
+				t.Fatalf("Send = %v, want HTTP %d", err, tt.status)
+			}
+			if !strings.Contains(httpErr.Body, http.StatusText(tt.status)) {
+				t.Errorf("body = %q", httpErr.Body)
+			}
+			if transport.IsTemporary(err) != tt.temporary {
+				t.Errorf("IsTemporary = %v, want %v", transport.IsTemporary(err), tt.temporary)
+			}
+		})
+	}
+}
+
+func TestHTTPConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  transport.HTTPConfig
+	}{
+		{"no url", transport.HTTPConfig{}},
+		{"not http", transport.HTTPConfig{URL: "smtp://mail.example.com"}},
+		{"bad payload template", transport.HTTPConfig{URL: "https://api.example.com", Payload: `{"from": {{json .From}`}},
+		{"bad header template", transport.HTTPConfig{URL: "https://api.example.com", Headers: map[string]string{"Authorization": "Bearer {{.Token}}"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := transport.NewHTTPClient(tt.cfg); err == nil {
+				t.Error("NewHTTPClient succeeded")
+			}
+		})
+	}
+
+	// 字符串变量没有使用 json 函数转换，渲染后不是合法的 JSON
+	c, err := transport.NewHTTPClient(transport.HTTPConfig{URL: "https://api.example.com", Payload: `{"subject": "{{.Subject}}"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := strings.Replace(testMessage, "Subject: =?utf-8?q?=E5=B7=A5=E8=B5=84=E6=9D=A1?=", `Subject: say "hi"`, 1)
+	if _, err = c.Payload("hr@example.com", testRecipients, []byte(msg)); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("Payload = %v, want invalid JSON error", err)
+	}
+}
+
+func TestHTTPRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32 // 前几次请求返回的错误次数
+		status   int
+		attempts int
+		wantErr  bool
+	}{
+		{"recovers after 429", 2, http.StatusTooManyRequests, 3, false},
+		{"gives up after retries", 10, http.StatusServiceUnavailable, 4, true},
+		{"permanent error not retried", 10, http.StatusBadRequest, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n int32
+			s := startSink(t, "", func(httpsink.Request) int {
+				if atomic.AddInt32(&n, 1) <= tt.failures {
+					return tt.status
+				}
+				return 0
+			})
+			c, err := transport.NewHTTPClient(transport.HTTPConfig{URL: s.URL()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = c.Close() }()
+
+			var retries int
+			b := transport.Backoff{Retries: 3, Delay: time.Millisecond}
+			attempts, err := b.Retry(func() error {
+				return c.Send("hr@example.com", testRecipients, []byte(testMessage))
+			}, func(int, time.Duration, error) { retries++ })
+			if attempts != tt.attempts || retries != tt.attempts-1 {
+				t.Errorf("attempts = %d, retries = %d, want %d attempts", attempts, retries, tt.attempts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Retry error = %v, want error %v", err, tt.wantErr)
+			}
+			want := 1
+			if tt.wantErr {
+				want = 0
+			}
+			if len(s.Requests()) != want {
+				t.Errorf("received %d requests, want %d", len(s.Requests()), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter 令牌桶限流，防止发送过于频繁被服务器限流
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // 生成一个令牌的间隔
+	burst    float64       // 令牌桶容量，即最多可以连续发送的邮件数量
+	tokens   float64
+	last     time.Time
+	now      func() time.Time // 当前时间，测试时替换
+}
+
+// NewRateLimiter 创建限流器，perMinute 为每分钟最多发送的邮件数量，为 0 时不限流
+// burst 为最多可以连续发送的邮件数量，小于 1 时为 1
+func NewRateLimiter(perMinute float64, burst int) *RateLimiter {
+	return newRateLimiter(perMinute, burst, time.Now)
+}
+
+func newRateLimiter(perMinute float64, burst int, now func() time.Time) *RateLimiter {
+	if perMinute <= 0 {
+		return &RateLimiter{}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		interval: time.Duration(float64(time.Minute) / perMinute),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     now(),
+		now:      now,
+	}
+}
+
+// Wait 等待直到获取到一个令牌
+func (r *RateLimiter) Wait() {
+	time.Sleep(r.Reserve())
+}
+
+// Reserve 预定一个令牌，返回需要等待的时间
+func (r *RateLimiter) Reserve() time.Duration {
+	if r.interval == 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.tokens += float64(now.Sub(r.last)) / float64(r.interval)
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens * float64(r.interval))
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestRateLimiter(t *testing.T) {
+	type step struct {
+		advance time.Duration // 预定前时钟前进的时长
+		wait    time.Duration // 预定返回的等待时间
+	}
+	tests := []struct {
+		name      string
+		perMinute float64
+		burst     int
+		steps     []step
+	}{
+		// 默认每分钟 12 封，每 5 秒生成一个令牌
+		{"default 12/min", 12, 1, []step{
+			{0, 0},
+			{0, 5 * time.Second},
+			{0, 10 * time.Second},
+			// 等待结束后预定下一个
+			{10 * time.Second, 5 * time.Second},
+			{30 * time.Second, 0},
+			{time.Second, 4 * time.Second},
+		}},
+		{"burst", 12, 3, []step{
+			{0, 0},
+			{0, 0},
+			{0, 0},
+			{0, 5 * time.Second},
+			// 令牌最多积累到 burst 个
+			{time.Hour, 0},
+			{0, 0},
+			{0, 0},
+			{0, 5 * time.Second},
+		}},
+		{"refill", 12, 3, []step{
+			{0, 0},
+			{0, 0},
+			{0, 0},
+			{7500 * time.Millisecond, 0},
+			{0, 2500 * time.Millisecond},
+		}},
+		{"burst less than 1", 60, 0, []step{
+			{0, 0},
+			{0, time.Second},
+		}},
+		{"unlimited", 0, 1, []step{
+			{0, 0},
+			{0, 0},
+			{0, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)}
+			limiter := newRateLimiter(tt.perMinute, tt.burst, clock.now)
+			for i, s := range tt.steps {
+				clock.advance(s.advance)
+				if wait := limiter.Reserve(); wait != s.wait {
+					t.Errorf("step %d: wait %s, want %s", i+1, wait, s.wait)
+				}
+			}
+		})
+	}
+}
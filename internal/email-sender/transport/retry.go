@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"time"
+)
+
+// UnknownError 邮件已经提交给服务器（SMTP DATA 结束后、HTTP 请求已发出）后发生的网络错误，
+// 服务器可能已经接受了邮件，重试可能导致重复发送
+type UnknownError struct {
+	Err error
+}
+
+func (e *UnknownError) Error() string {
+	return "发送结果未知，邮件可能已经发送：" + e.Err.Error()
+}
+
+func (e *UnknownError) Unwrap() error {
+	return e.Err
+}
+
+// IsUnknown 判断发送错误是否为 UnknownError
+func IsUnknown(err error) bool {
+	var unknownErr *UnknownError
+	return errors.As(err, &unknownErr)
+}
+
+// IsTemporary 判断发送错误是否为临时错误，临时错误可以重试
+// SMTP 4xx 错误码（如 421 服务不可用、450 邮箱繁忙、451 处理错误、452 存储空间不足）和提交邮件前的网络错误为临时错误，
+// 5xx 错误码为永久错误，重试也不会成功；HTTP 邮件 API 返回 429 和 5xx 时为临时错误
+// 提交邮件后的网络错误（UnknownError）不是临时错误，不重试
+func IsTemporary(err error) bool {
+	if err == nil || IsUnknown(err) {
+		return false
+	}
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code >= 400 && tpErr.Code < 500
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary()
+	}
+	// 网络错误，如连接超时、连接被重置、服务器断开连接
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Backoff 指数退避
+type Backoff struct {
+	Retries int           // 最多重试次数
+	Delay   time.Duration // 第一次重试前等待的时间，之后每次翻倍
+	Max     time.Duration // 最长等待时间，为 0 时不限制
+}
+
+// Wait 第 attempt 次重试前需要等待的时间，attempt 从 1 开始
+func (b Backoff) Wait(attempt int) time.Duration {
+	d := b.Delay
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if b.Max > 0 && d >= b.Max {
+			return b.Max
+		}
+	}
+	return d
+}
+
+// Retry 执行 fn，返回临时错误时按指数退避重试，返回执行的次数和最后一次的错误
+// onRetry 在每次重试等待前调用，可以为 nil
+func (b Backoff) Retry(fn func() error, onRetry func(attempt int, wait time.Duration, err error)) (int, error) {
+	attempt := 0
+	for {
+		attempt++
+		err := fn()
+		if err == nil || !IsTemporary(err) || attempt > b.Retries {
+			return attempt, err
+		}
+		wait := b.Wait(attempt)
+		if onRetry != nil {
+			onRetry(attempt, wait, err)
+		}
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,234 @@
+package transport_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/yuchunyu97/toolset-golang/internal/email-sender/transport"
+)
+
+func TestIsTemporary(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"421 service unavailable", &textproto.Error{Code: 421, Msg: "try again later"}, true},
+		{"451 local error", fmt.Errorf("rcpt: %w", &textproto.Error{Code: 451, Msg: "local error"}), true},
+		{"550 user unknown", &textproto.Error{Code: 550, Msg: "user unknown"}, false},
+		{"HTTP 429", &transport.HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{"HTTP 503", &transport.HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"HTTP 400", &transport.HTTPError{StatusCode: http.StatusBadRequest}, false},
+		{"connection refused", refused, true},
+		{"EOF", io.EOF, true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"unknown after submit", &transport.UnknownError{Err: io.EOF}, false},
+		{"wrapped unknown", fmt.Errorf("send: %w", &transport.UnknownError{Err: refused}), false},
+		{"other", errors.New("PGP 加密失败"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transport.IsTemporary(tt.err); got != tt.want {
+				t.Errorf("IsTemporary(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff transport.Backoff
+		want    []time.Duration
+	}{
+		{"doubles", transport.Backoff{Delay: 30 * time.Second},
+			[]time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}},
+		{"capped", transport.Backoff{Delay: 30 * time.Second, Max: 3 * time.Minute},
+			[]time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}},
+		{"delay above max", transport.Backoff{Delay: time.Minute, Max: 45 * time.Second},
+			[]time.Duration{time.Minute, 45 * time.Second, 45 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.backoff.Wait(i + 1); got != want {
+					t.Errorf("Wait(%d) = %s, want %s", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error // 每次执行返回的错误，超出后返回 nil
+		attempts int
+		wantErr  bool
+	}{
+		{"success", nil, 1, false},
+		{"recovers", []error{io.EOF, &textproto.Error{Code: 421}}, 3, false},
+		{"gives up", []error{io.EOF, io.EOF, io.EOF, io.EOF, io.EOF}, 4, true},
+		{"permanent", []error{&textproto.Error{Code: 550}}, 1, true},
+		{"unknown not retried", []error{&transport.UnknownError{Err: io.EOF}}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n int
+			var waits []time.Duration
+			b := transport.Backoff{Retries: 3, Delay: time.Millisecond}
+			attempts, err := b.Retry(func() error {
+				n++
+				if n <= len(tt.errs) {
+					return tt.errs[n-1]
+				}
+				return nil
+			}, func(attempt int, wait time.Duration, err error) {
+				waits = append(waits, wait)
+			})
+			if attempts != tt.attempts || n != tt.attempts || len(waits) != tt.attempts-1 {
+				t.Errorf("attempts = %d, calls = %d, waits = %v, want %d attempts", attempts, n, waits, tt.attempts)
+			}
+			for i, wait := range waits {
+				if wait != b.Wait(i+1) {
+					t.Errorf("wait %d = %s, want %s", i+1, wait, b.Wait(i+1))
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Retry error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// smtpServer 按顺序回复 SMTP 命令的服务器，dropAfter 为收到该命令后直接断开连接，DATA 表示收到邮件内容之后
+func smtpServer(t *testing.T, dropAfter string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				r := textproto.NewReader(bufio.NewReader(conn))
+				_, _ = io.WriteString(conn, "220 ready\r\n")
+				for {
+					line, err := r.ReadLine()
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.Fields(line + " x")[0])
+					if cmd == dropAfter && cmd != "DATA" {
+						return
+					}
+					switch cmd {
+					case "EHLO":
+						_, _ = io.WriteString(conn, "250-localhost\r\n250 8BITMIME\r\n")
+					case "DATA":
+						_, _ = io.WriteString(conn, "354 go ahead\r\n")
+						if _, err = r.ReadDotBytes(); err != nil || dropAfter == "DATA" {
+							return
+						}
+						_, _ = io.WriteString(conn, "250 queued\r\n")
+					default:
+						_, _ = io.WriteString(conn, "250 ok\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// TestSubmittedNotRetried 提交邮件后连接中断时不重试，之前中断时可以重试
+func TestSubmittedNotRetried(t *testing.T) {
+	tests := []struct {
+		dropAfter string
+		temporary bool
+		unknown   bool
+	}{
+		{"MAIL", true, false},
+		{"RCPT", true, false},
+		{"DATA", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dropAfter, func(t *testing.T) {
+			c, err := transport.NewSMTPClient(transport.Config{Addr: smtpServer(t, tt.dropAfter), Security: transport.SecurityNone,
+				Auth: transport.AuthNone, Timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = c.Close() }()
+			err = c.Send("hr@example.com", []string{"zhangsan@example.com"}, []byte("Subject: test\r\n\r\nhello\r\n"))
+			if err == nil {
+				t.Fatal("Send succeeded")
+			}
+			if transport.IsTemporary(err) != tt.temporary || transport.IsUnknown(err) != tt.unknown {
+				t.Errorf("Send error %v: temporary = %v, unknown = %v", err, transport.IsTemporary(err), transport.IsUnknown(err))
+			}
+		})
+	}
+}
+
+// TestHTTPResponseLost 请求发出后没有收到响应时不重试，连接失败时可以重试
+func TestHTTPResponseLost(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	c, err := transport.NewHTTPClient(transport.HTTPConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	b := transport.Backoff{Retries: 3, Delay: time.Millisecond}
+	attempts, err := b.Retry(func() error {
+		return c.Send("hr@example.com", testRecipients, []byte(testMessage))
+	}, nil)
+	if !transport.IsUnknown(err) || attempts != 1 || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Retry = %d attempts, %d requests, error %v, want 1 unknown", attempts, atomic.LoadInt32(&requests), err)
+	}
+
+	// 端口没有监听，请求没有发出
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	c, err = transport.NewHTTPClient(transport.HTTPConfig{URL: "http://" + addr + "/send"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Send("hr@example.com", testRecipients, []byte(testMessage))
+	if !transport.IsTemporary(err) || transport.IsUnknown(err) {
+		t.Errorf("Send to a closed port = %v, want a temporary error", err)
+	}
+}
@@ -0,0 +1,285 @@
+// Package transport 邮件发送传输层
+// SMTP 文档：https://pkg.go.dev/net/smtp
+// 不允许 SMTP 出站连接时可以使用 HTTPClient 通过 HTTP 邮件 API 发送
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// 连接加密方式
+const (
+	SecurityAuto     = "auto"     // 465 端口使用 tls，其他端口使用 starttls
+	SecurityTLS      = "tls"      // SMTPS，连接建立后直接进行 TLS 握手，一般为 465 端口
+	SecuritySTARTTLS = "starttls" // 明文连接后通过 STARTTLS 命令升级为 TLS，一般为 587 端口
+	SecurityNone     = "none"     // 不加密，仅用于本地或内网服务器
+)
+
+// DefaultTimeout 默认的连接超时时间
+const DefaultTimeout = 30 * time.Second
+
+// Config SMTP 连接配置
+type Config struct {
+	Addr     string // 服务器地址，格式为 host:port
+	Security string // 连接加密方式，默认为 auto
+	Auth     string // 认证方式，默认为 auto
+	Username string
+	Password string // 使用 XOAUTH2 认证时为 OAuth2 access token
+
+	// CAFile 自定义的 CA 证书文件（PEM 格式），用于校验服务器证书
+	CAFile string
+	// InsecureSkipVerify 不校验服务器证书，存在中间人攻击的风险，仅在服务器使用自签名证书且无法提供 CA 证书时使用
+	InsecureSkipVerify bool
+	// Timeout 连接超时时间，默认为 30s
+	Timeout time.Duration
+}
+
+func (cfg *Config) host() string {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return cfg.Addr
+	}
+	return host
+}
+
+func (cfg *Config) security() string {
+	security := strings.ToLower(cfg.Security)
+	if security == "" || security == SecurityAuto {
+		if _, port, _ := net.SplitHostPort(cfg.Addr); port == "465" {
+			return SecurityTLS
+		}
+		return SecuritySTARTTLS
+	}
+	return security
+}
+
+// tlsConfig 生成 TLS 配置，默认校验服务器证书
+func (cfg *Config) tlsConfig() (*tls.Config, error) {
+	return TLSConfig(cfg.host(), cfg.CAFile, cfg.InsecureSkipVerify)
+}
+
+// TLSConfig 生成连接 host 使用的 TLS 配置，caFile 为自定义的 CA 证书文件（PEM 格式），为空时使用系统 CA 证书
+// IMAP 等其他协议也使用该配置
+func TLSConfig(host, caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in ca file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// Validate 检查配置
+func (cfg *Config) Validate() error {
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return fmt.Errorf("invalid server address %q: %s", cfg.Addr, err)
+	}
+	switch cfg.security() {
+	case SecurityTLS, SecuritySTARTTLS, SecurityNone:
+	default:
+		return fmt.Errorf("unsupported security %q", cfg.Security)
+	}
+	switch strings.ToLower(cfg.Auth) {
+	case "", AuthAuto, AuthNone, AuthPlain, AuthLogin, AuthCRAMMD5, AuthXOAuth2:
+	default:
+		return fmt.Errorf("unsupported auth mechanism %q", cfg.Auth)
+	}
+	if cfg.CAFile != "" {
+		if _, err := cfg.tlsConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dial 连接 SMTP 服务器，完成加密和认证
+func Dial(cfg Config) (*smtp.Client, error) {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", cfg.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	security := cfg.security()
+	if security == SecurityTLS {
+		tlsConn := tls.Client(conn, tlsConfig)
+		_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+		if err = tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+
+	c, err := smtp.NewClient(conn, cfg.host())
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if security == SecuritySTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			_ = c.Close()
+			return nil, errors.New("server does not support STARTTLS")
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if err = authenticate(c, cfg); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func authenticate(c *smtp.Client, cfg Config) error {
+	if strings.ToLower(cfg.Auth) == AuthNone {
+		return nil
+	}
+	ok, serverMechs := c.Extension("AUTH")
+	if !ok {
+		// 服务器不需要认证，且没有明确指定认证方式
+		if cfg.Auth == "" || strings.ToLower(cfg.Auth) == AuthAuto {
+			return nil
+		}
+		return errors.New("server does not support AUTH")
+	}
+	auth, err := newAuth(cfg.Auth, cfg.host(), cfg.Username, cfg.Password, serverMechs)
+	if err != nil {
+		return err
+	}
+	if err = c.Auth(auth); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	return nil
+}
+
+// SMTPClient 通过 SMTP 发送邮件
+// 连接建立后会被复用，每封邮件发送前使用 RSET 重置会话，连接断开或出错时重新连接
+type SMTPClient struct {
+	cfg Config
+	// MaxMessagesPerConn 每个连接最多发送的邮件数量，超过后重新连接，为 0 时不限制
+	MaxMessagesPerConn int
+
+	c     *smtp.Client
+	count int // 当前连接已发送的邮件数量
+}
+
+// NewSMTPClient 创建 SMTP 客户端
+func NewSMTPClient(cfg Config) (*SMTPClient, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &SMTPClient{cfg: cfg}, nil
+}
+
+// conn 获取可用的连接，已有连接时发送 RSET 确认连接可用
+func (s *SMTPClient) conn() (*smtp.Client, error) {
+	if s.c != nil && s.MaxMessagesPerConn > 0 && s.count >= s.MaxMessagesPerConn {
+		_ = s.Close()
+	}
+	if s.c != nil {
+		if err := s.c.Reset(); err == nil {
+			return s.c, nil
+		}
+		// 连接已断开，例如服务器空闲超时
+		_ = s.c.Close()
+		s.c = nil
+	}
+
+	c, err := Dial(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.c = c
+	s.count = 0
+	return c, nil
+}
+
+// Send 发送邮件，from 为发件人邮箱，to 为所有收件人（包括抄送和密送）邮箱，msg 为完整的邮件内容
+func (s *SMTPClient) Send(from string, to []string, msg []byte) error {
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	if err = sendMail(c, from, to, msg); err != nil {
+		// 服务器拒绝（如收件人不存在）时连接仍然可用，下次发送前会 RSET；网络错误时下次重新连接
+		var tpErr *textproto.Error
+		if !errors.As(err, &tpErr) {
+			_ = c.Close()
+			s.c = nil
+		}
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// Close 关闭连接
+func (s *SMTPClient) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	err := s.c.Quit()
+	if err != nil {
+		_ = s.c.Close()
+	}
+	s.c = nil
+	return err
+}
+
+func sendMail(c *smtp.Client, from string, to []string, msg []byte) error {
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	// 结束 DATA 后服务器可能已经接受了邮件，没有收到响应时无法确定是否发送成功
+	if err = w.Close(); err != nil {
+		var tpErr *textproto.Error
+		if !errors.As(err, &tpErr) {
+			return &UnknownError{Err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,20 @@
+package transport
+
+// 发送方式
+const (
+	KindSMTP = "smtp" // 通过 SMTP 服务器发送
+	KindHTTP = "http" // 通过 HTTP 邮件 API 发送，用于不允许 SMTP 出站连接的环境
+)
+
+// Transport 发送邮件的方式，SMTPClient 和 HTTPClient 都实现了该接口
+type Transport interface {
+	// Send 发送邮件，from 为发件人邮箱，to 为所有收件人（包括抄送和密送）邮箱，msg 为完整的邮件内容
+	Send(from string, to []string, msg []byte) error
+	// Close 关闭连接，之后仍然可以调用 Send，会重新连接
+	Close() error
+}
+
+var (
+	_ Transport = (*SMTPClient)(nil)
+	_ Transport = (*HTTPClient)(nil)
+)
@@ -0,0 +1,66 @@
+package xlsxtable
+
+import (
+	"github.com/xuri/excelize/v2"
+	"strings"
+)
+
+// indexedColors Excel 默认的索引颜色
+var indexedColors = []string{
+	"000000", "FFFFFF", "FF0000", "00FF00", "0000FF", "FFFF00", "FF00FF", "00FFFF",
+	"000000", "FFFFFF", "FF0000", "00FF00", "0000FF", "FFFF00", "FF00FF", "00FFFF",
+	"800000", "008000", "000080", "808000", "800080", "008080", "C0C0C0", "808080",
+	"9999FF", "993366", "FFFFCC", "CCFFFF", "660066", "FF8080", "0066CC", "CCCCFF",
+	"000080", "FF00FF", "FFFF00", "00FFFF", "800080", "800000", "008080", "0000FF",
+	"00CCFF", "CCFFFF", "CCFFCC", "FFFF99", "99CCFF", "FF99CC", "CC99FF", "FFCC99",
+	"3366FF", "33CCCC", "99CC00", "FFCC00", "FF9900", "FF6600", "666699", "969696",
+	"003366", "339966", "003300", "333300", "993300", "993366", "333399", "333333",
+}
+
+// themeOrder 主题颜色的索引对应主题中颜色的顺序，主题中的顺序为 dk1、lt1、dk2、lt2、accent1 ...，Excel 中 0 为 lt1、1 为 dk1
+var themeOrder = []int{1, 0, 3, 2, 4, 5, 6, 7, 8, 9, 10, 11}
+
+// color 将 Excel 颜色（RGB、主题颜色或索引颜色，tint 为亮度调整）转换为 CSS 颜色，如 #FF0000，无法识别的颜色返回空
+// xlsxColor 为 excelize 中未导出的类型，因此按字段传入
+func (s *Sheet) color(rgb string, theme *int, indexed int, tint float64) string {
+	base := ""
+	switch {
+	case rgb != "":
+		// ARGB 格式，如 FFFF0000
+		rgb = strings.TrimPrefix(strings.ToUpper(rgb), "#")
+		if len(rgb) == 8 {
+			rgb = rgb[2:]
+		}
+		if len(rgb) == 6 {
+			base = rgb
+		}
+	case theme != nil:
+		base = s.themeColor(*theme)
+	case indexed > 0 && indexed < len(indexedColors):
+		// 索引 0 与没有设置无法区分，64 和 65 为系统前景色和背景色，均不处理
+		base = indexedColors[indexed]
+	}
+	if base == "" {
+		return ""
+	}
+	return "#" + strings.TrimPrefix(excelize.ThemeColor(base, tint), "FF")
+}
+
+// themeColor 主题颜色，没有主题或索引超出范围时返回空
+func (s *Sheet) themeColor(index int) string {
+	if s.f.Theme == nil || index < 0 || index >= len(themeOrder) {
+		return ""
+	}
+	children := s.f.Theme.ThemeElements.ClrScheme.Children
+	if themeOrder[index] >= len(children) {
+		return ""
+	}
+	el := children[themeOrder[index]]
+	switch {
+	case el.SrgbClr != nil && el.SrgbClr.Val != nil:
+		return strings.ToUpper(*el.SrgbClr.Val)
+	case el.SysClr != nil:
+		return strings.ToUpper(el.SysClr.LastClr)
+	}
+	return ""
+}
@@ -0,0 +1,308 @@
+// Package xlsxtable 将 Excel 中的一行渲染为带样式的 HTML 表格，用作邮件正文
+// 单元格内容为 excelize 按数字格式格式化后的值，保留填充颜色、字体颜色、粗体、斜体、下划线、删除线、字号和水平对齐
+// 合并单元格中的单元格使用合并单元格的内容和样式
+// 样式使用内联 style 属性，邮件客户端一般不支持 <style> 标签
+package xlsxtable
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// 表格布局
+const (
+	LayoutHorizontal = "horizontal" // 第一行为标题，第二行为内容，与 Excel 中相同
+	LayoutVertical   = "vertical"   // 每列一行，左边为标题，右边为内容，列较多时便于在手机上阅读
+)
+
+// 表格和单元格的默认样式
+const (
+	tableStyle  = "border-collapse:collapse;font-size:14px"
+	cellStyle   = "border:1px solid #d0d7de;padding:4px 8px"
+	headerStyle = "background-color:#f2f2f2;font-weight:bold;text-align:left"
+)
+
+// Sheet 数据工作簿中的一个 Sheet，HeaderRow 行为标题行
+type Sheet struct {
+	f         *excelize.File
+	name      string
+	headerRow int
+	headers   []string       // 标题行
+	cols      map[string]int // 标题 -> 列号，从 1 开始
+	rows      [][]string     // 所有行，rows[0] 为 Excel 第 1 行
+	keys      map[string][]int
+	merged    []mergedRange
+}
+
+// mergedRange 合并单元格的范围，行号和列号从 1 开始
+type mergedRange struct {
+	startCol, startRow, endCol, endRow int
+}
+
+// Open 读取 Sheet，headerRow 为标题行的行号，从 1 开始
+func Open(f *excelize.File, sheet string, headerRow int) (*Sheet, error) {
+	if headerRow < 1 {
+		headerRow = 1
+	}
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < headerRow {
+		return nil, fmt.Errorf("Sheet %s 没有标题行（第 %d 行）", sheet, headerRow)
+	}
+	s := &Sheet{f: f, name: sheet, headerRow: headerRow, rows: rows, cols: map[string]int{}}
+	mergeCells, err := f.GetMergeCells(sheet)
+	if err != nil {
+		return nil, err
+	}
+	for _, mc := range mergeCells {
+		var r mergedRange
+		if r.startCol, r.startRow, err = excelize.CellNameToCoordinates(mc.GetStartAxis()); err != nil {
+			return nil, err
+		}
+		if r.endCol, r.endRow, err = excelize.CellNameToCoordinates(mc.GetEndAxis()); err != nil {
+			return nil, err
+		}
+		s.merged = append(s.merged, r)
+	}
+	for i, title := range rows[headerRow-1] {
+		title = strings.TrimSpace(title)
+		s.headers = append(s.headers, title)
+		if _, ok := s.cols[title]; title != "" && !ok {
+			s.cols[title] = i + 1
+		}
+	}
+	return s, nil
+}
+
+// Headers 标题行中的所有标题，按列的顺序，不包括空标题
+func (s *Sheet) Headers() []string {
+	var headers []string
+	for _, title := range s.headers {
+		if title != "" {
+			headers = append(headers, title)
+		}
+	}
+	return headers
+}
+
+// Find 在 column 列中查找内容为 value 的行，返回 Excel 行号，忽略首尾空格
+// 没有找到或找到多行时返回错误
+func (s *Sheet) Find(column, value string) (int, error) {
+	col, ok := s.cols[column]
+	if !ok {
+		return 0, fmt.Errorf("Sheet %s 中没有 %s 列", s.name, column)
+	}
+	if s.keys == nil {
+		s.keys = make(map[string][]int)
+		for i := s.headerRow; i < len(s.rows); i++ {
+			if col <= len(s.rows[i]) {
+				key := strings.TrimSpace(s.rows[i][col-1])
+				s.keys[key] = append(s.keys[key], i+1)
+			}
+		}
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("%s 为空", column)
+	}
+	nums := s.keys[value]
+	switch len(nums) {
+	case 0:
+		return 0, fmt.Errorf("Sheet %s 中没有 %s 为 %s 的行", s.name, column, value)
+	case 1:
+		return nums[0], nil
+	default:
+		rows := make([]string, 0, len(nums))
+		for _, num := range nums {
+			rows = append(rows, strconv.Itoa(num))
+		}
+		return 0, fmt.Errorf("Sheet %s 中有多行 %s 为 %s（第 %s 行）", s.name, column, value, strings.Join(rows, "、"))
+	}
+}
+
+// Render 将第 row 行（Excel 行号）中 columns 列渲染为 HTML 表格，columns 为标题，为空时使用所有列
+func (s *Sheet) Render(row int, columns []string, layout string) (string, error) {
+	if row <= s.headerRow || row > len(s.rows) {
+		return "", fmt.Errorf("Sheet %s 中没有第 %d 行", s.name, row)
+	}
+	if len(columns) == 0 {
+		columns = s.Headers()
+	}
+	if len(columns) == 0 {
+		return "", errors.New("没有需要显示的列")
+	}
+
+	type cell struct {
+		header, value       string
+		headerCSS, valueCSS string
+	}
+	cells := make([]cell, 0, len(columns))
+	var missing []string
+	for _, title := range columns {
+		col, ok := s.cols[strings.TrimSpace(title)]
+		if !ok {
+			missing = append(missing, title)
+			continue
+		}
+		_, headerAxis := s.cell(col, s.headerRow)
+		value, valueAxis := s.cell(col, row)
+		cells = append(cells, cell{
+			header:    s.headers[col-1],
+			value:     value,
+			headerCSS: s.cellCSS(headerAxis),
+			valueCSS:  s.cellCSS(valueAxis),
+		})
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("Sheet %s 中没有 %s 列", s.name, strings.Join(missing, "、"))
+	}
+
+	var b strings.Builder
+	th := func(c cell) {
+		fmt.Fprintf(&b, `<th style="%s">%s</th>`, joinCSS(cellStyle, headerStyle, c.headerCSS), escape(c.header))
+	}
+	td := func(c cell) {
+		fmt.Fprintf(&b, `<td style="%s">%s</td>`, joinCSS(cellStyle, c.valueCSS), escape(c.value))
+	}
+	fmt.Fprintf(&b, `<table cellspacing="0" cellpadding="0" style="%s">`, tableStyle)
+	b.WriteString("\n")
+	if layout == LayoutVertical {
+		for _, c := range cells {
+			b.WriteString("<tr>")
+			th(c)
+			td(c)
+			b.WriteString("</tr>\n")
+		}
+	} else {
+		b.WriteString("<tr>")
+		for _, c := range cells {
+			th(c)
+		}
+		b.WriteString("</tr>\n<tr>")
+		for _, c := range cells {
+			td(c)
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</table>\n")
+	return b.String(), nil
+}
+
+// cell 单元格的内容和单元格名称，在合并单元格中时返回合并单元格左上角的单元格
+func (s *Sheet) cell(col, row int) (string, string) {
+	for _, r := range s.merged {
+		if col >= r.startCol && col <= r.endCol && row >= r.startRow && row <= r.endRow {
+			col, row = r.startCol, r.startRow
+			break
+		}
+	}
+	axis, _ := excelize.CoordinatesToCellName(col, row)
+	value := ""
+	if row <= len(s.rows) && col <= len(s.rows[row-1]) {
+		value = s.rows[row-1][col-1]
+	}
+	return value, axis
+}
+
+// escape 转义 HTML，保留单元格中的换行
+func escape(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+// joinCSS 合并样式，后面的样式覆盖前面的同名样式
+func joinCSS(styles ...string) string {
+	var parts []string
+	for _, style := range styles {
+		if style != "" {
+			parts = append(parts, style)
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// cellCSS 单元格的样式，没有样式时返回空
+func (s *Sheet) cellCSS(axis string) string {
+	styles := s.f.Styles
+	id, err := s.f.GetCellStyle(s.name, axis)
+	if err != nil || styles == nil || styles.CellXfs == nil || id < 0 || id >= len(styles.CellXfs.Xf) {
+		return ""
+	}
+	xf := styles.CellXfs.Xf[id]
+	var css []string
+
+	// 纯色填充
+	if xf.FillID != nil && styles.Fills != nil && *xf.FillID < len(styles.Fills.Fill) {
+		if fill := styles.Fills.Fill[*xf.FillID]; fill != nil && fill.PatternFill != nil && fill.PatternFill.PatternType == "solid" {
+			if fg := fill.PatternFill.FgColor; fg != nil && !fg.Auto {
+				if color := s.color(fg.RGB, fg.Theme, fg.Indexed, fg.Tint); color != "" {
+					css = append(css, "background-color:"+color)
+				}
+			}
+		}
+	}
+
+	// 字体，与默认字体相同的设置不输出
+	if xf.FontID != nil && styles.Fonts != nil && *xf.FontID > 0 && *xf.FontID < len(styles.Fonts.Font) {
+		if font := styles.Fonts.Font[*xf.FontID]; font != nil && styles.Fonts.Font[0] != nil {
+			defaultFont := styles.Fonts.Font[0]
+			if font.B != nil && (font.B.Val == nil || *font.B.Val) {
+				css = append(css, "font-weight:bold")
+			}
+			if font.I != nil && (font.I.Val == nil || *font.I.Val) {
+				css = append(css, "font-style:italic")
+			}
+			var decorations []string
+			if font.U != nil && (font.U.Val == nil || *font.U.Val != "none") {
+				decorations = append(decorations, "underline")
+			}
+			if font.Strike != nil && (font.Strike.Val == nil || *font.Strike.Val) {
+				decorations = append(decorations, "line-through")
+			}
+			if len(decorations) > 0 {
+				css = append(css, "text-decoration:"+strings.Join(decorations, " "))
+			}
+			if c := font.Color; c != nil && !c.Auto {
+				color := s.color(c.RGB, c.Theme, c.Indexed, c.Tint)
+				defaultColor := ""
+				if d := defaultFont.Color; d != nil && !d.Auto {
+					defaultColor = s.color(d.RGB, d.Theme, d.Indexed, d.Tint)
+				}
+				if color != "" && color != defaultColor {
+					css = append(css, "color:"+color)
+				}
+			}
+			if font.Sz != nil && font.Sz.Val != nil &&
+				(defaultFont.Sz == nil || defaultFont.Sz.Val == nil || *font.Sz.Val != *defaultFont.Sz.Val) {
+				css = append(css, fmt.Sprintf("font-size:%gpt", *font.Sz.Val))
+			}
+		}
+	}
+
+	// 水平对齐，常规对齐时与 Excel 相同，数字右对齐
+	align := ""
+	if xf.Alignment != nil {
+		switch xf.Alignment.Horizontal {
+		case "left", "center", "right", "justify":
+			align = xf.Alignment.Horizontal
+		case "centerContinuous", "distributed":
+			align = "center"
+		}
+	}
+	if align == "" {
+		if raw, err := s.f.GetCellValue(s.name, axis, excelize.Options{RawCellValue: true}); err == nil {
+			if _, err = strconv.ParseFloat(strings.TrimSpace(raw), 64); err == nil {
+				align = "right"
+			}
+		}
+	}
+	if align != "" {
+		css = append(css, "text-align:"+align)
+	}
+	return strings.Join(css, ";")
+}
@@ -0,0 +1,226 @@
+package xlsxtable
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const testSheet = "工资"
+
+// newTestSheet 创建工作簿，第 1 行为标题，rows 从第 2 行开始
+func newTestSheet(t *testing.T, headers []interface{}, rows ...[]interface{}) *excelize.File {
+	t.Helper()
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", testSheet)
+	if err := f.SetSheetRow(testSheet, "A1", &headers); err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		row := row
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := f.SetSheetRow(testSheet, cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+// setStyle 设置单元格样式，modify 可以修改 excelize 生成的样式（如改为主题颜色或索引颜色）
+func setStyle(t *testing.T, f *excelize.File, axis string, style *excelize.Style, modify func(xf int)) {
+	t.Helper()
+	id, err := f.NewStyle(style)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modify != nil {
+		modify(id)
+	}
+	if err = f.SetCellStyle(testSheet, axis, axis, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func render(t *testing.T, f *excelize.File, row int, columns []string, layout string) string {
+	t.Helper()
+	s, err := Open(f, testSheet, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, err := s.Render(row, columns, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return html
+}
+
+// cells 表格中每个 <td> 的 style 和内容
+func cells(html string) (styles, values []string) {
+	for _, part := range strings.Split(html, "<td style=\"")[1:] {
+		end := strings.Index(part, "</td>")
+		style, value := part[:strings.Index(part, `">`)], part[strings.Index(part, `">`)+2:end]
+		styles = append(styles, style)
+		values = append(values, value)
+	}
+	return styles, values
+}
+
+func TestRenderLayout(t *testing.T) {
+	f := newTestSheet(t, []interface{}{"姓名", "部门", "基本工资"},
+		[]interface{}{"张三", "研发部", 10000},
+		[]interface{}{"李四", "市场部", 12000})
+
+	horizontal := render(t, f, 3, []string{"姓名", "基本工资"}, LayoutHorizontal)
+	want := `<table cellspacing="0" cellpadding="0" style="` + tableStyle + `">` + "\n" +
+		`<tr><th style="` + joinCSS(cellStyle, headerStyle) + `">姓名</th>` +
+		`<th style="` + joinCSS(cellStyle, headerStyle) + `">基本工资</th></tr>` + "\n" +
+		`<tr><td style="` + cellStyle + `">李四</td>` +
+		`<td style="` + joinCSS(cellStyle, "text-align:right") + `">12000</td></tr>` + "\n" +
+		"</table>\n"
+	if horizontal != want {
+		t.Errorf("horizontal =\n%s\nwant\n%s", horizontal, want)
+	}
+
+	vertical := render(t, f, 2, nil, LayoutVertical)
+	if n := strings.Count(vertical, "<tr>"); n != 3 {
+		t.Errorf("vertical has %d rows, want 3:\n%s", n, vertical)
+	}
+	if !strings.Contains(vertical, `部门</th><td style="`+cellStyle+`">研发部</td></tr>`) {
+		t.Errorf("vertical =\n%s", vertical)
+	}
+
+	s, err := Open(f, testSheet, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		row     int
+		columns []string
+		err     string
+	}{
+		{1, nil, "没有第 1 行"},
+		{4, nil, "没有第 4 行"},
+		{2, []string{"姓名", "奖金", "补贴"}, "没有 奖金、补贴 列"},
+	} {
+		if _, err = s.Render(tt.row, tt.columns, LayoutHorizontal); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Render(%d, %v) error = %v, want %q", tt.row, tt.columns, err, tt.err)
+		}
+	}
+}
+
+func TestRenderEscape(t *testing.T) {
+	f := newTestSheet(t, []interface{}{"<备注>", "链接"},
+		[]interface{}{`<script>alert("x")</script> & 'y'`, "第一行\n第二行"})
+	html := render(t, f, 2, nil, LayoutHorizontal)
+	if strings.Contains(html, "<script>") || strings.Contains(html, "<备注>") {
+		t.Fatalf("unescaped HTML:\n%s", html)
+	}
+	_, values := cells(html)
+	want := []string{"&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; &#39;y&#39;", "第一行<br>第二行"}
+	if strings.Join(values, "|") != strings.Join(want, "|") {
+		t.Errorf("values = %q, want %q", values, want)
+	}
+	if !strings.Contains(html, ">&lt;备注&gt;</th>") {
+		t.Errorf("header not escaped:\n%s", html)
+	}
+}
+
+func TestRenderMerged(t *testing.T) {
+	// 部门列第 2 到 4 行合并，第 5 行的 姓名 和 备注 列合并
+	f := newTestSheet(t, []interface{}{"部门", "姓名", "备注"},
+		[]interface{}{"研发部", "张三", "转正"},
+		[]interface{}{nil, "李四", ""},
+		[]interface{}{nil, "王五", ""},
+		[]interface{}{"市场部", "赵六（离职）", nil})
+	if err := f.MergeCell(testSheet, "A2", "A4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.MergeCell(testSheet, "B5", "C5"); err != nil {
+		t.Fatal(err)
+	}
+	setStyle(t, f, "A2", &excelize.Style{Font: &excelize.Font{Bold: true}}, nil)
+
+	tests := []struct {
+		row    int
+		values []string
+	}{
+		{2, []string{"研发部", "张三", "转正"}},
+		{3, []string{"研发部", "李四", ""}},
+		{4, []string{"研发部", "王五", ""}},
+		{5, []string{"市场部", "赵六（离职）", "赵六（离职）"}},
+	}
+	for _, tt := range tests {
+		styles, values := cells(render(t, f, tt.row, nil, LayoutHorizontal))
+		if strings.Join(values, "|") != strings.Join(tt.values, "|") {
+			t.Errorf("row %d values = %q, want %q", tt.row, values, tt.values)
+		}
+		// 合并单元格使用左上角单元格的样式
+		if tt.row <= 4 && !strings.Contains(styles[0], "font-weight:bold") {
+			t.Errorf("row %d merged cell style = %q, want bold", tt.row, styles[0])
+		}
+	}
+}
+
+func TestRenderColors(t *testing.T) {
+	f := newTestSheet(t, []interface{}{"RGB", "主题", "主题 tint", "索引", "默认"},
+		[]interface{}{"a", "b", "c", "d", "e"})
+	setStyle(t, f, "A2", &excelize.Style{
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#FFC7CE"}},
+		Font: &excelize.Font{Color: "#9C0006"},
+	}, nil)
+	// 主题颜色 4 为 accent1，默认主题中为 5B9BD5，tint 0.5 时调亮
+	theme := func(index int, tint float64) func(xf int) {
+		return func(xf int) {
+			fill := f.Styles.Fills.Fill[*f.Styles.CellXfs.Xf[xf].FillID].PatternFill.FgColor
+			fill.RGB, fill.Theme, fill.Tint = "", &index, tint
+		}
+	}
+	setStyle(t, f, "B2", &excelize.Style{Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#000000"}}}, theme(4, 0))
+	setStyle(t, f, "C2", &excelize.Style{Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"#000000"}}}, theme(4, 0.5))
+	// 索引颜色 10 为红色
+	setStyle(t, f, "D2", &excelize.Style{Font: &excelize.Font{Color: "#000000", Italic: true}}, func(xf int) {
+		color := f.Styles.Fonts.Font[*f.Styles.CellXfs.Xf[xf].FontID].Color
+		color.RGB, color.Indexed = "", 10
+	})
+
+	styles, _ := cells(render(t, f, 2, nil, LayoutHorizontal))
+	if len(styles) != 5 {
+		t.Fatalf("%d cells, want 5", len(styles))
+	}
+	want := []string{
+		joinCSS(cellStyle, "background-color:#FFC7CE;color:#9C0006"),
+		joinCSS(cellStyle, "background-color:#5B9BD5"),
+		joinCSS(cellStyle, "background-color:#ADCDEA"),
+		joinCSS(cellStyle, "font-style:italic;color:#FF0000"),
+		cellStyle,
+	}
+	for i := range want {
+		if styles[i] != want[i] {
+			t.Errorf("cell %d style = %q, want %q", i+1, styles[i], want[i])
+		}
+	}
+}
+
+func TestRenderNumberFormats(t *testing.T) {
+	f := newTestSheet(t, []interface{}{"入职日期", "完成率", "金额", "文本数字"},
+		[]interface{}{time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), 0.8567, 12345.6, "00123"})
+	dateFormat := "yyyy-mm-dd"
+	setStyle(t, f, "A2", &excelize.Style{CustomNumFmt: &dateFormat}, nil)
+	setStyle(t, f, "B2", &excelize.Style{NumFmt: 10}, nil) // 0.00%
+	setStyle(t, f, "D2", &excelize.Style{Alignment: &excelize.Alignment{Horizontal: "center"}}, nil)
+
+	styles, values := cells(render(t, f, 2, nil, LayoutHorizontal))
+	want := []string{"2026-10-19", "85.67%", "12345.6", "00123"}
+	if strings.Join(values, "|") != strings.Join(want, "|") {
+		t.Errorf("values = %q, want %q", values, want)
+	}
+	// 数字右对齐，设置了对齐方式时使用设置
+	wantAlign := []string{"text-align:right", "text-align:right", "text-align:right", "text-align:center"}
+	for i, align := range wantAlign {
+		if !strings.HasSuffix(styles[i], align) {
+			t.Errorf("cell %d style = %q, want %s", i+1, styles[i], align)
+		}
+	}
+}